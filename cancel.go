@@ -0,0 +1,249 @@
+package couac
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"github.com/apache/arrow-adbc/go/adbc"
+	"github.com/apache/arrow-go/v18/arrow/array"
+)
+
+// cancelStatement interrupts the execution of stmt. Statements opened
+// through the ADBC driver manager are cancelled with AdbcStatementCancel;
+// the Go drivermgr package does not expose it, so the C handle is read
+// from its statement wrapper. DuckDB's driver does not implement
+// AdbcStatementCancel, in which case the statement's DuckDB connection
+// is interrupted with duckdb_interrupt instead. Statements of other
+// drivers are cancelled through a Cancel method when they have one. It
+// returns an error wrapping [ErrCancelNotSupported] if none of these
+// applies.
+func cancelStatement(stmt adbc.Statement) error {
+	if c, ok := stmt.(interface{ Cancel() error }); ok {
+		return c.Cancel()
+	}
+	handle, err := statementHandle(stmt)
+	if err != nil {
+		return err
+	}
+	if handle == nil {
+		return ErrCancelNotSupported
+	}
+	err = adbcStatementCancel(handle)
+	var aerr adbc.Error
+	if errors.As(err, &aerr) && aerr.Code == adbc.StatusNotImplemented {
+		return duckdbInterrupt(handle)
+	}
+	return err
+}
+
+// drivermgrPkg is the import path of the ADBC driver manager bindings,
+// whose statements (type stmt) wrap a *C.struct_AdbcStatement in their
+// field st.
+const drivermgrPkg = "github.com/apache/arrow-adbc/go/adbc/drivermgr"
+
+// errStatementLayout is returned by statementHandle for driver manager
+// statements that no longer have the layout it reads.
+var errStatementLayout = fmt.Errorf("%w: unrecognized %s statement layout", ErrCancelNotSupported, drivermgrPkg)
+
+// statementHandle returns the C AdbcStatement of a driver manager
+// statement, or nil for statements of other implementations and closed
+// statements. It returns errStatementLayout if the driver manager's
+// statement no longer has the expected layout, e.g. after an
+// arrow-adbc upgrade.
+func statementHandle(stmt adbc.Statement) (unsafe.Pointer, error) {
+	v := reflect.ValueOf(stmt)
+	if v.Kind() != reflect.Pointer || v.IsNil() {
+		return nil, nil
+	}
+	e := v.Elem()
+	t := e.Type()
+	if t.PkgPath() != drivermgrPkg {
+		return nil, nil
+	}
+	if t.Kind() != reflect.Struct || t.Name() != "stmt" || t.NumField() == 0 {
+		return nil, errStatementLayout
+	}
+	if sf := t.Field(0); sf.Name != "st" || sf.Type.Kind() != reflect.Pointer ||
+		sf.Type.Elem().Name() != "_Ctype_struct_AdbcStatement" {
+		return nil, errStatementLayout
+	}
+	f := e.Field(0)
+	if f.IsNil() {
+		return nil, nil
+	}
+	return unsafe.Pointer(f.Pointer()), nil
+}
+
+// duckdbInterruptVersions are the DuckDB releases whose ADBC statement
+// wrapper is known to start with its duckdb_connection, which the
+// interrupt fallback relies on. Statements of other releases are not
+// interrupted: their results still stop at the next batch once the
+// context is done, but a running statement completes.
+var duckdbInterruptVersions = []string{"v1.0.", "v1.1.", "v1.2.", "v1.3.", "v1.4."}
+
+// duckdbInterruptSupported reports whether the DuckDB library version
+// is one of duckdbInterruptVersions.
+func duckdbInterruptSupported(version string) bool {
+	return slices.ContainsFunc(duckdbInterruptVersions, func(prefix string) bool {
+		return strings.HasPrefix(version, prefix)
+	})
+}
+
+// cancelWatch cancels a statement when its context is done, for as long
+// as the statement is in use. Call stop before closing the statement.
+type cancelWatch struct {
+	ctx context.Context
+	// mu serializes a cancel in flight with stop, so the statement is
+	// never cancelled after it has been closed.
+	mu      sync.Mutex
+	stmt    adbc.Statement
+	stopFn  func() bool
+	stopped bool
+	// cancelErr is the error of the cancel attempt, if one was made.
+	cancelErr error
+}
+
+// watchCancel starts cancelling stmt when ctx is done.
+func watchCancel(ctx context.Context, stmt adbc.Statement) *cancelWatch {
+	w := &cancelWatch{ctx: ctx, stmt: stmt}
+	if ctx.Done() != nil {
+		w.stopFn = context.AfterFunc(ctx, func() {
+			w.mu.Lock()
+			defer w.mu.Unlock()
+			if !w.stopped {
+				w.cancelErr = cancelStatement(w.stmt)
+			}
+		})
+	}
+	return w
+}
+
+// stop ends the watch, waiting for a cancel in flight to return.
+func (w *cancelWatch) stop() {
+	if w == nil {
+		return
+	}
+	if w.stopFn != nil {
+		w.stopFn()
+	}
+	w.mu.Lock()
+	w.stopped = true
+	w.mu.Unlock()
+}
+
+// err wraps err with the context's error when the context is done, so
+// callers can match [context.Canceled] or [context.DeadlineExceeded]
+// with errors.Is, and with the error of a failed cancel attempt, e.g.
+// [ErrCancelNotSupported]. The driver's own error is kept in the chain.
+// Call it after stop. A nil watch returns err unchanged.
+func (w *cancelWatch) err(err error) error {
+	if err == nil || w == nil {
+		return err
+	}
+	w.mu.Lock()
+	cerr := w.cancelErr
+	w.mu.Unlock()
+	if cerr != nil {
+		err = fmt.Errorf("%w (%w)", err, cerr)
+	}
+	return ctxErr(w.ctx, err)
+}
+
+// ctxErr wraps err with the error of ctx when ctx is done.
+func ctxErr(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	cerr := ctx.Err()
+	if cerr == nil || errors.Is(err, cerr) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", cerr, err)
+}
+
+// executeUpdate runs ExecuteUpdate on stmt, cancelling it if ctx is done
+// before it returns.
+func executeUpdate(ctx context.Context, stmt adbc.Statement) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return -1, err
+	}
+	w := watchCancel(ctx, stmt)
+	n, err := stmt.ExecuteUpdate(ctx)
+	w.stop()
+	return n, w.err(err)
+}
+
+// executeQuery runs ExecuteQuery on stmt and keeps cancelling it while
+// the returned reader is consumed. The reader stops at the first batch
+// after ctx is done and reports the context's error, even if the driver
+// cannot cancel the statement. The watch ends when the reader reaches
+// its end or fails, since interrupting DuckDB interrupts whatever the
+// connection runs next. Call stop on the returned watch before closing
+// stmt.
+func executeQuery(ctx context.Context, stmt adbc.Statement) (array.RecordReader, int64, *cancelWatch, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, -1, nil, err
+	}
+	w := watchCancel(ctx, stmt)
+	rr, n, err := stmt.ExecuteQuery(ctx)
+	if err != nil {
+		w.stop()
+		return nil, n, nil, w.err(err)
+	}
+	if ctx.Done() == nil {
+		return rr, n, w, nil
+	}
+	return &cancelReader{RecordReader: rr, ctx: ctx, watch: w}, n, w, nil
+}
+
+// cancelReader stops a RecordReader once its context is done, and ends
+// its statement's cancel watch once it is done reading.
+type cancelReader struct {
+	array.RecordReader
+	ctx   context.Context
+	watch *cancelWatch
+	err   error
+	done  bool
+}
+
+func (r *cancelReader) Next() bool {
+	if r.done {
+		return false
+	}
+	if err := r.ctx.Err(); err != nil {
+		r.finish()
+		r.err = r.wrap(err)
+		return false
+	}
+	if r.RecordReader.Next() {
+		return true
+	}
+	r.finish()
+	r.err = r.wrap(r.RecordReader.Err())
+	return false
+}
+
+// finish ends the reader and its cancel watch.
+func (r *cancelReader) finish() {
+	r.done = true
+	r.watch.stop()
+}
+
+// wrap wraps err with the errors of the reader's context and of its
+// cancel watch; readers of a bound stream have no watch.
+func (r *cancelReader) wrap(err error) error {
+	return ctxErr(r.ctx, r.watch.err(err))
+}
+
+func (r *cancelReader) Err() error {
+	if r.err != nil {
+		return r.err
+	}
+	return r.RecordReader.Err()
+}
@@ -0,0 +1,64 @@
+package couac
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/apache/arrow-adbc/go/adbc"
+)
+
+// TestStatementHandle_Layout fails when the driver manager's statement
+// wrapper changes, so an arrow-adbc upgrade does not silently disable
+// statement cancellation.
+func TestStatementHandle_Layout(t *testing.T) {
+	db, err := NewDuck(WithDriverName("duckdb"))
+	if err != nil {
+		t.Skipf("skipping: cannot open DuckDB (driver not found?): %v", err)
+	}
+	defer db.Close()
+	conn, err := db.Connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	stmt, err := conn.conn.NewStatement()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stmt.Close()
+	handle, err := statementHandle(stmt)
+	if err != nil {
+		t.Fatalf("statementHandle: %v", err)
+	}
+	if handle == nil {
+		t.Fatal("statementHandle returned no handle for a driver manager statement")
+	}
+}
+
+// goStatement is a statement of a driver written in Go.
+type goStatement struct{ adbc.Statement }
+
+func TestStatementHandle_OtherDrivers(t *testing.T) {
+	handle, err := statementHandle(&goStatement{})
+	if handle != nil || err != nil {
+		t.Errorf("expected no handle and no error, got %v, %v", handle, err)
+	}
+	if err := cancelStatement(&goStatement{}); !errors.Is(err, ErrCancelNotSupported) {
+		t.Errorf("expected ErrCancelNotSupported, got %v", err)
+	}
+}
+
+func TestDuckDBInterruptSupported(t *testing.T) {
+	for version, want := range map[string]bool{
+		"v1.1.3":  true,
+		"v1.4.0":  true,
+		"v1.10.0": false,
+		"v2.0.0":  false,
+		"":        false,
+	} {
+		if got := duckdbInterruptSupported(version); got != want {
+			t.Errorf("duckdbInterruptSupported(%q) = %v, want %v", version, got, want)
+		}
+	}
+}
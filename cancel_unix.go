@@ -0,0 +1,116 @@
+//go:build !windows
+
+package couac
+
+/*
+#cgo LDFLAGS: -ldl
+#define _GNU_SOURCE
+#include <dlfcn.h>
+#include <stdint.h>
+#include <stddef.h>
+
+// Declarations from arrow-adbc/adbc.h. AdbcStatementCancel is provided
+// by the ADBC driver manager linked in by the drivermgr package.
+struct AdbcError {
+	char* message;
+	int32_t vendor_code;
+	char sqlstate[5];
+	void (*release)(struct AdbcError*);
+	void* private_data;
+	void* private_driver;
+};
+struct AdbcStatement {
+	void* private_data;
+	void** private_driver;
+};
+uint8_t AdbcStatementCancel(struct AdbcStatement* statement, struct AdbcError* error);
+
+static uint8_t couacStatementCancel(void* statement) {
+	struct AdbcError err = {0};
+	uint8_t code = AdbcStatementCancel((struct AdbcStatement*)statement, &err);
+	if (err.release != NULL) {
+		err.release(&err);
+	}
+	return code;
+}
+
+// couacDuckDBLib opens the already loaded shared library that
+// implements the driver of a statement, found from its DatabaseInit
+// entry (the fourth member of struct AdbcDriver in the ADBC ABI). The
+// caller must dlclose it.
+static void* couacDuckDBLib(struct AdbcStatement* st) {
+	if (st->private_driver == NULL || st->private_driver[3] == NULL) {
+		return NULL;
+	}
+	Dl_info info;
+	if (!dladdr(st->private_driver[3], &info) || info.dli_fname == NULL) {
+		return NULL;
+	}
+	return dlopen(info.dli_fname, RTLD_LAZY | RTLD_NOLOAD);
+}
+
+// couacDuckDBVersion returns the DuckDB version of the library that
+// implements a statement's driver, or NULL if it is not DuckDB.
+static const char* couacDuckDBVersion(void* statement) {
+	void* lib = couacDuckDBLib((struct AdbcStatement*)statement);
+	if (lib == NULL) {
+		return NULL;
+	}
+	const char* (*version)(void) = (const char* (*)(void))dlsym(lib, "duckdb_library_version");
+	const char* v = version != NULL ? version() : NULL;
+	dlclose(lib);
+	return v;
+}
+
+// couacDuckDBInterrupt calls duckdb_interrupt on the connection of a
+// DuckDB ADBC statement. DuckDB's statement wrapper holds its
+// duckdb_connection in its first member; callers check the DuckDB
+// version first, as the wrapper is private to DuckDB.
+static int couacDuckDBInterrupt(void* statement) {
+	struct AdbcStatement* st = (struct AdbcStatement*)statement;
+	if (st->private_data == NULL) {
+		return 0;
+	}
+	void* lib = couacDuckDBLib(st);
+	if (lib == NULL) {
+		return 0;
+	}
+	void (*interrupt)(void*) = (void (*)(void*))dlsym(lib, "duckdb_interrupt");
+	void* conn = *(void**)st->private_data;
+	if (interrupt != NULL && conn != NULL) {
+		interrupt(conn);
+	}
+	dlclose(lib);
+	return interrupt != NULL && conn != NULL;
+}
+*/
+import "C"
+
+import (
+	"unsafe"
+
+	"github.com/apache/arrow-adbc/go/adbc"
+)
+
+// adbcStatementCancel calls AdbcStatementCancel on a C AdbcStatement.
+func adbcStatementCancel(handle unsafe.Pointer) error {
+	if code := adbc.Status(C.couacStatementCancel(handle)); code != adbc.StatusOK {
+		return adbc.Error{Code: code, Msg: "couac: statement cancel failed"}
+	}
+	return nil
+}
+
+// duckdbInterrupt interrupts the DuckDB connection running a C
+// AdbcStatement of DuckDB's ADBC driver, for the DuckDB releases whose
+// statement layout is known. It returns [ErrCancelNotSupported] for
+// other drivers and releases.
+func duckdbInterrupt(handle unsafe.Pointer) error {
+	v := C.couacDuckDBVersion(handle)
+	if v == nil || !duckdbInterruptSupported(C.GoString(v)) {
+		return ErrCancelNotSupported
+	}
+	if C.couacDuckDBInterrupt(handle) == 0 {
+		return ErrCancelNotSupported
+	}
+	return nil
+}
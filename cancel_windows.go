@@ -0,0 +1,51 @@
+//go:build windows
+
+package couac
+
+/*
+#include <stdint.h>
+#include <stddef.h>
+
+// Declarations from arrow-adbc/adbc.h. AdbcStatementCancel is provided
+// by the ADBC driver manager linked in by the drivermgr package.
+struct AdbcError {
+	char* message;
+	int32_t vendor_code;
+	char sqlstate[5];
+	void (*release)(struct AdbcError*);
+	void* private_data;
+	void* private_driver;
+};
+struct AdbcStatement;
+uint8_t AdbcStatementCancel(struct AdbcStatement* statement, struct AdbcError* error);
+
+static uint8_t couacStatementCancel(void* statement) {
+	struct AdbcError err = {0};
+	uint8_t code = AdbcStatementCancel((struct AdbcStatement*)statement, &err);
+	if (err.release != NULL) {
+		err.release(&err);
+	}
+	return code;
+}
+*/
+import "C"
+
+import (
+	"unsafe"
+
+	"github.com/apache/arrow-adbc/go/adbc"
+)
+
+// adbcStatementCancel calls AdbcStatementCancel on a C AdbcStatement.
+func adbcStatementCancel(handle unsafe.Pointer) error {
+	if code := adbc.Status(C.couacStatementCancel(handle)); code != adbc.StatusOK {
+		return adbc.Error{Code: code, Msg: "couac: statement cancel failed"}
+	}
+	return nil
+}
+
+// duckdbInterrupt is not implemented on Windows, where drivers that do
+// not support AdbcStatementCancel cannot be interrupted.
+func duckdbInterrupt(unsafe.Pointer) error {
+	return ErrCancelNotSupported
+}
@@ -7,33 +7,90 @@ import (
 )
 
 // Set sets a DuckDB configuration option. Most options are GLOBAL
-// (instance-wide); some are SESSION-scoped (connection-specific).
+// (instance-wide); some are SESSION-scoped (connection-specific). By
+// default the option is set in its own scope; pass [WithScope] to
+// choose it explicitly. Some GLOBAL options, such as default_null_order,
+// can also be set for the session only; others, such as threads, cannot.
 // Use [Conn.Setting] to read the current value, and
 // [Conn.Reset] to restore the default.
 //
+// The key must name a setting listed by duckdb_settings(), or one of
+// its aliases; otherwise Set returns an [UnknownSettingError]. value is
+// checked and quoted according to the setting's input type: booleans
+// accept the forms of [strconv.ParseBool], numbers must parse as such,
+// and lists (VARCHAR[]) are given as comma-separated elements or in
+// the bracketed form returned by [Conn.Setting]. On a
+// read-only database ([WithReadOnly]), setting an option globally
+// returns [ErrReadOnly].
+//
 // Example:
 //
 //	conn.Set(ctx, "memory_limit", "4GB")
 //	conn.Set(ctx, "threads", "8")
-func (q *Conn) Set(ctx context.Context, key, value string) error {
-	_, err := q.Exec(ctx, fmt.Sprintf("SET %s = '%s'", key, value))
-	return err
+//	conn.Set(ctx, "search_path", "main,staging", couac.WithScope(couac.ScopeSession))
+func (q *Conn) Set(ctx context.Context, key, value string, opts ...SetOption) error {
+	cfg, err := newSetConfig(opts)
+	if err != nil {
+		return err
+	}
+	s, err := q.lookupSetting(ctx, key)
+	if err != nil {
+		return err
+	}
+	global := cfg.global(s)
+	if q.parent != nil && q.parent.readOnly && global {
+		return fmt.Errorf("%w: %s is a global setting", ErrReadOnly, s.Name)
+	}
+	literal, err := settingLiteral(s, value)
+	if err != nil {
+		return err
+	}
+	if _, err := q.Exec(ctx, fmt.Sprintf("SET %s%s = %s", cfg.prefix(), s.Name, literal)); err != nil {
+		return err
+	}
+	return q.recordSetting(ctx, s, global, value)
 }
 
-// Reset restores a DuckDB configuration option to its default value.
-func (q *Conn) Reset(ctx context.Context, key string) error {
-	_, err := q.Exec(ctx, fmt.Sprintf("RESET %s", key))
-	return err
+// Reset restores a DuckDB configuration option to its default value,
+// in the scope given by [WithScope] if any. Unknown keys return an
+// [UnknownSettingError]. As with [Conn.Set], resetting an option
+// globally on a read-only database returns [ErrReadOnly].
+func (q *Conn) Reset(ctx context.Context, key string, opts ...SetOption) error {
+	cfg, err := newSetConfig(opts)
+	if err != nil {
+		return err
+	}
+	s, err := q.lookupSetting(ctx, key)
+	if err != nil {
+		return err
+	}
+	global := cfg.global(s)
+	if q.parent != nil && q.parent.readOnly && global {
+		return fmt.Errorf("%w: %s is a global setting", ErrReadOnly, s.Name)
+	}
+	if _, err := q.Exec(ctx, fmt.Sprintf("RESET %s%s", cfg.prefix(), s.Name)); err != nil {
+		return err
+	}
+	q.settingInputs.Delete(s.Name)
+	if q.parent != nil {
+		q.parent.settingInputs.Delete(s.Name)
+	}
+	return nil
 }
 
 // Setting reads the current value of a DuckDB configuration option.
+// Unknown keys return an [UnknownSettingError].
 //
 // Example:
 //
 //	threads, err := conn.Setting(ctx, "threads")
 //	memLimit, err := conn.Setting(ctx, "memory_limit")
 func (q *Conn) Setting(ctx context.Context, key string) (string, error) {
-	res, err := q.Query(ctx, fmt.Sprintf("SELECT current_setting('%s')", key))
+	s, err := q.lookupSetting(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	res, err := q.Query(ctx, fmt.Sprintf("SELECT current_setting(%s)", quoteString(s.Name)))
 	if err != nil {
 		return "", err
 	}
@@ -2,7 +2,13 @@ package couac_test
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/loicalleyne/couac"
 )
 
 func TestSet_Setting(t *testing.T) {
@@ -184,3 +190,255 @@ func TestReset(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestSet_Validated(t *testing.T) {
+	db, conn := newTestConn(t)
+	ctx := context.Background()
+
+	for key, tc := range map[string]struct{ value, want string }{
+		"home_directory":           {"/tmp/o'brien", "/tmp/o'brien"},
+		"preserve_insertion_order": {"0", "false"},
+		"worker_threads":           {" 3 ", "3"},
+		"timezone":                 {"Europe/Paris", "Europe/Paris"},
+		"allowed_directories":      {"/data, /tmp/it's", `["/data/","/tmp/it's/"]`},
+	} {
+		if err := conn.Set(ctx, key, tc.value); err != nil {
+			t.Fatalf("Set(%s): %v", key, err)
+		}
+		got, err := conn.Setting(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.want {
+			t.Errorf("%s = %q, want %q", key, got, tc.want)
+		}
+	}
+	for key, value := range map[string]string{
+		"preserve_insertion_order": "maybe",
+		"threads":                  "8; DROP TABLE t",
+		"index_scan_percentage":    "NaN",
+	} {
+		if err := conn.Set(ctx, key, value); err == nil {
+			t.Errorf("Set(%s, %q): expected an error", key, value)
+		}
+	}
+
+	if err := conn.Set(ctx, "default_null_order", "nulls_first", couac.WithScope(couac.ScopeSession)); err != nil {
+		t.Fatal(err)
+	}
+	other, err := db.Connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	for c, want := range map[*couac.Conn]string{conn: "NULLS_FIRST", other: "NULLS_LAST"} {
+		if got, err := c.Setting(ctx, "default_null_order"); err != nil || got != want {
+			t.Errorf("default_null_order = %q (%v), want %q", got, err, want)
+		}
+	}
+	if err := conn.Reset(ctx, "default_null_order", couac.WithScope(couac.ScopeSession)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := conn.Exec(ctx, "CREATE TABLE victim (x INT)"); err != nil {
+		t.Fatal(err)
+	}
+	bad := couac.WithScope("GLOBAL threads = 1; DROP TABLE victim; SET GLOBAL")
+	if err := conn.Set(ctx, "threads", "2", bad); err == nil {
+		t.Error("Set: expected an invalid scope to be rejected")
+	}
+	if err := conn.Reset(ctx, "threads", bad); err == nil {
+		t.Error("Reset: expected an invalid scope to be rejected")
+	}
+	if n := tableCount(t, conn, "victim"); n != 0 {
+		t.Errorf("expected victim to survive, got %d rows", n)
+	}
+}
+
+func TestSet_UnknownSetting(t *testing.T) {
+	_, conn := newTestConn(t)
+	ctx := context.Background()
+
+	err := conn.Set(ctx, "treads", "2")
+	var uerr *couac.UnknownSettingError
+	if !errors.Is(err, couac.ErrUnknownSetting) || !errors.As(err, &uerr) {
+		t.Fatalf("expected an UnknownSettingError, got %v", err)
+	}
+	if len(uerr.Suggestions) == 0 || uerr.Suggestions[0] != "threads" {
+		t.Errorf("expected threads to be suggested first, got %v", uerr.Suggestions)
+	}
+	if !strings.Contains(err.Error(), `did you mean`) {
+		t.Errorf("unexpected message %q", err)
+	}
+	for _, key := range []string{"threads = 1; DROP TABLE t; --", "memory limit"} {
+		if err := conn.Set(ctx, key, "1"); !errors.Is(err, couac.ErrUnknownSetting) {
+			t.Errorf("Set(%q): expected ErrUnknownSetting, got %v", key, err)
+		}
+	}
+	if _, err := conn.Setting(ctx, "treads"); !errors.Is(err, couac.ErrUnknownSetting) {
+		t.Errorf("Setting: expected ErrUnknownSetting, got %v", err)
+	}
+	if err := conn.Reset(ctx, "treads"); !errors.Is(err, couac.ErrUnknownSetting) {
+		t.Errorf("Reset: expected ErrUnknownSetting, got %v", err)
+	}
+}
+
+func TestWithSettings(t *testing.T) {
+	_, conn := newTestConn(t)
+	ctx := context.Background()
+
+	before, err := conn.SnapshotSettings(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	overrides := map[string]string{
+		"threads":                  "3",
+		"preserve_insertion_order": "false",
+		"log_query_path":           filepath.Join(t.TempDir(), "queries.log"),
+	}
+	err = conn.WithSettings(ctx, overrides, func(c *couac.Conn) error {
+		settings, err := c.Settings(ctx)
+		if err != nil {
+			return err
+		}
+		changed := map[string]string{}
+		for _, ch := range before.Diff(settings) {
+			changed[ch.Name] = *ch.New
+		}
+		for key, want := range overrides {
+			if changed[key] != want {
+				t.Errorf("expected %s to change to %q, got changes %v", key, want, changed)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := conn.Settings(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes := before.Diff(after); len(changes) != 0 {
+		t.Errorf("expected the settings to be restored, got %v", changes)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected the panic to propagate")
+			}
+		}()
+		conn.WithSettings(ctx, map[string]string{"threads": "5"}, func(*couac.Conn) error {
+			panic("boom")
+		})
+	}()
+	if v, err := conn.Setting(ctx, "threads"); err != nil || v != *before["threads"].Value {
+		t.Errorf("expected threads to be restored after a panic, got %q (%v)", v, err)
+	}
+
+	wantErr := errors.New("fail")
+	if err := conn.WithSettings(ctx, map[string]string{"threads": "5"}, func(*couac.Conn) error { return wantErr }); err != wantErr {
+		t.Errorf("expected fn's error, got %v", err)
+	}
+	if err := conn.WithSettings(ctx, map[string]string{"treads": "5"}, func(*couac.Conn) error { return nil }); !errors.Is(err, couac.ErrUnknownSetting) {
+		t.Errorf("expected ErrUnknownSetting, got %v", err)
+	}
+}
+
+func TestWithSettings_ExactRestore(t *testing.T) {
+	db := newTestDB(t, couac.WithConfig(couac.Config{MemoryLimit: "4GB"}))
+	conn, err := db.Connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ctx := context.Background()
+
+	// memory_limit is displayed rounded, e.g. "3.7 GiB" for 4GB: a
+	// restore must not drift by setting the rounded value back.
+	check := func(want string) {
+		t.Helper()
+		for range 3 {
+			if err := conn.WithSettings(ctx, map[string]string{"memory_limit": "1GB"}, func(*couac.Conn) error { return nil }); err != nil {
+				t.Fatal(err)
+			}
+			if got, err := conn.Setting(ctx, "memory_limit"); err != nil || got != want {
+				t.Fatalf("expected memory_limit %q after restore, got %q (%v)", want, got, err)
+			}
+		}
+	}
+	opened, err := conn.Setting(ctx, "memory_limit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(opened)
+
+	if err := conn.Set(ctx, "memory_limit", "3GB"); err != nil {
+		t.Fatal(err)
+	}
+	set, err := conn.Setting(ctx, "memory_limit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(set)
+	snap, err := conn.SnapshotSettings(ctx, "memory_limit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if in := snap["memory_limit"].Input; in == nil || *in != "3GB" {
+		t.Errorf("expected the snapshot to keep the input 3GB, got %+v", snap["memory_limit"])
+	}
+
+	// A setting at its default is reset rather than set.
+	snap, err = conn.SnapshotSettings(ctx, "checkpoint_threshold")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !snap["checkpoint_threshold"].Default {
+		t.Errorf("expected checkpoint_threshold to be at its default, got %+v", snap["checkpoint_threshold"])
+	}
+}
+
+func TestSnapshotSettings_JSON(t *testing.T) {
+	db, conn := newTestConn(t)
+	ctx := context.Background()
+
+	if err := conn.Set(ctx, "default_null_order", "nulls_first", couac.WithScope(couac.ScopeSession)); err != nil {
+		t.Fatal(err)
+	}
+	snap, err := conn.SnapshotSettings(ctx, "default_null_order", "log_query_path")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(snap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"default_null_order":{"value":"NULLS_FIRST","input":"nulls_first"},"log_query_path":{"value":null}}` {
+		t.Errorf("unexpected JSON %s", data)
+	}
+
+	var restored couac.SettingsSnapshot
+	if err := json.Unmarshal(data, &restored); err != nil {
+		t.Fatal(err)
+	}
+	other, err := db.Connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	if err := other.Set(ctx, "log_query_path", filepath.Join(t.TempDir(), "queries.log")); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.RestoreSettings(ctx, restored); err != nil {
+		t.Fatal(err)
+	}
+	settings, err := other.Settings(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes := restored.Diff(settings); len(changes) != 0 {
+		t.Errorf("expected the snapshot to be restored on another connection, got %v", changes)
+	}
+}
@@ -16,7 +16,7 @@ func (q *DB) Connect() (*Conn, error) {
 	if err := q.ensureOpen(); err != nil {
 		return nil, err
 	}
-	q.mu.RLock()
+	q.rlock()
 	defer q.mu.RUnlock()
 
 	qc := &Conn{}
@@ -54,7 +54,7 @@ func (q *DB) ConnectAs(catalog, schema string) (*Conn, error) {
 	if err := q.ensureOpen(); err != nil {
 		return nil, err
 	}
-	q.mu.RLock()
+	q.rlock()
 	defer q.mu.RUnlock()
 
 	qc := &Conn{
@@ -126,11 +126,16 @@ func (q *Conn) dbSchemaPtr() *string {
 // returns nil.
 //
 // It is important to close connections to allow DuckDB to properly
-// commit WAL file changes.
+// commit WAL file changes. An active transaction started with
+// [Conn.Begin] is rolled back.
 func (q *Conn) Close() error {
 	if q.closed.Swap(true) {
 		return nil // already closed
 	}
+	if q.borrowed {
+		return nil
+	}
+	q.rollbackOnClose()
 
 	// Remove from parent's tracking
 	if q.parent != nil {
@@ -170,3 +175,15 @@ func (q *Conn) ensureConnOpen() error {
 	}
 	return nil
 }
+
+// ensureWritable returns ErrConnectionClosed if this connection has
+// been closed, and ErrReadOnly if its database is read-only.
+func (q *Conn) ensureWritable() error {
+	if err := q.ensureConnOpen(); err != nil {
+		return err
+	}
+	if q.parent != nil && q.parent.readOnly {
+		return ErrReadOnly
+	}
+	return nil
+}
@@ -4,8 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
 
 	"github.com/apache/arrow-adbc/go/adbc"
@@ -16,7 +19,40 @@ import (
 // openDatabases tracks file-backed databases that are currently open
 // in this process. DuckDB only supports a single writer per file;
 // this prevents confusing ADBC errors by catching duplicates early.
-var openDatabases sync.Map // map[string]struct{}
+// Read-only databases may share a file with each other, but not with
+// a read-write one.
+var (
+	openMu        sync.Mutex
+	openDatabases = make(map[string]int) // path → read-only DBs, or -1 for a read-write one
+)
+
+// claimPath records that a DB is opening path, reporting false if that
+// conflicts with the DBs already open.
+func claimPath(path string, readOnly bool) bool {
+	openMu.Lock()
+	defer openMu.Unlock()
+	n, ok := openDatabases[path]
+	switch {
+	case !ok && !readOnly:
+		openDatabases[path] = -1
+	case readOnly && n >= 0:
+		openDatabases[path] = n + 1
+	default:
+		return false
+	}
+	return true
+}
+
+// releasePath undoes claimPath.
+func releasePath(path string) {
+	openMu.Lock()
+	defer openMu.Unlock()
+	if n := openDatabases[path]; n > 1 {
+		openDatabases[path] = n - 1
+	} else {
+		delete(openDatabases, path)
+	}
+}
 
 // WithPath sets the database file path. If omitted or empty, the
 // database is created in-memory.
@@ -80,6 +116,53 @@ func WithContext(ctx context.Context) Option {
 	}
 }
 
+// WithPool configures the default connection pool used by [DB.Do].
+func WithPool(opts ...PoolOption) Option {
+	return func(cfg config) {
+		cfg.poolOpts = opts
+	}
+}
+
+// WithRedactedSQL replaces string and numeric literals with ? in the
+// statement carried by [Error] values, and quoted values and numbers in
+// their message, so that errors can be logged without the data of the
+// statements that caused them.
+func WithRedactedSQL() Option {
+	return func(cfg config) {
+		cfg.redactSQL = true
+	}
+}
+
+// WithHooks installs hooks that observe, rewrite, or reject the
+// statements, ingests, and maintenance operations of the database (see
+// [Hook]). Hooks run in the order given; WithHooks may be repeated.
+func WithHooks(hooks ...Hook) Option {
+	return func(cfg config) {
+		cfg.hooks = append(cfg.hooks, hooks...)
+	}
+}
+
+// WithReadOnly opens the database file with access_mode READ_ONLY.
+// Any number of read-only DBs, in this process or others, may open
+// the same file; they see the data as of the last checkpoint when they
+// were opened, or were reopened with [DB.Reopen].
+//
+// The ingest methods, [DB.Compact], the checkpoint methods, and
+// [Conn.Set] on global settings return [ErrReadOnly] without reaching
+// DuckDB; other statements that write fail with an [Error] matching
+// it.
+//
+// DuckDB locks the file with an operating system lock: while a process
+// has it open read-write, other processes cannot open it, even
+// read-only. Within a process, read-only DBs cannot be opened while a
+// read-write DB is open on the file, and the reverse ([ErrPathAlreadyOpen]).
+// Read-only mode requires a database file ([WithPath]).
+func WithReadOnly() Option {
+	return func(cfg config) {
+		cfg.readOnly = true
+	}
+}
+
 // NewDuckDatabase is an alias for [NewDuck].
 //
 //go:fix inline
@@ -98,14 +181,18 @@ func NewDB(opts ...Option) (*DB, error) {
 
 // NewDuck opens a DuckDB database via ADBC.
 //
-// Options control the database file path, driver location, and default
-// context. If no driver option is provided, the driver name "duckdb" is
-// passed to the ADBC driver manager, which resolves it via TOML manifests
+// Options control the database file path, driver location, default
+// context, and the DuckDB settings applied at open ([WithConfig]). If
+// no driver option is provided, the driver name "duckdb" is passed to
+// the ADBC driver manager, which resolves it via TOML manifests
 // installed by the dbc CLI.
 //
 // For file-backed databases, only one [DB] may be open per file path
-// within a process. Attempting to open the same file twice returns
-// [ErrPathAlreadyOpen].
+// within a process, unless every DB of the file is read-only
+// ([WithReadOnly]). Attempting to open the same file twice returns
+// [ErrPathAlreadyOpen]. When another process holds the file, NewDuck
+// returns a [LockError], after waiting for the lock to be released if
+// [WithLockWait] is given.
 //
 // Example:
 //
@@ -130,6 +217,22 @@ func NewDuck(opts ...Option) (*DB, error) {
 	}
 	q.driverPath = driverPath
 
+	switch mode := AccessMode(strings.ToLower(string(q.dbConfig.AccessMode))); {
+	case mode == AccessModeReadOnly:
+		q.readOnly = true
+	case q.readOnly && mode != "":
+		return nil, fmt.Errorf("%w: access_mode %s conflicts with WithReadOnly", ErrInvalidConfig, mode)
+	case q.readOnly:
+		q.dbConfig.AccessMode = AccessModeReadOnly
+	}
+	if q.readOnly && q.path == "" {
+		return nil, fmt.Errorf("%w: read-only mode requires a database file", ErrInvalidConfig)
+	}
+	settings, err := q.dbConfig.options()
+	if err != nil {
+		return nil, err
+	}
+
 	if q.ctx == nil {
 		q.ctx = context.Background()
 	}
@@ -140,7 +243,7 @@ func NewDuck(opts ...Option) (*DB, error) {
 		if err == nil {
 			q.path = absPath
 		}
-		if _, loaded := openDatabases.LoadOrStore(q.path, struct{}{}); loaded {
+		if !claimPath(q.path, q.readOnly) {
 			return nil, ErrPathAlreadyOpen
 		}
 	}
@@ -150,17 +253,27 @@ func NewDuck(opts ...Option) (*DB, error) {
 		"driver":     driverPath,
 		"entrypoint": entrypoint,
 	}
+	maps.Copy(dbOpts, settings)
 	if q.path != "" {
 		dbOpts["path"] = q.path
 	}
 
-	q.db, err = q.drv.NewDatabase(dbOpts)
+	q.db, err = q.openDatabase(dbOpts)
 	if err != nil {
 		if q.path != "" {
-			openDatabases.Delete(q.path)
+			releasePath(q.path)
 		}
 		return nil, fmt.Errorf("couac: new database: %w", err)
 	}
+	q.dbOpts = dbOpts
+	if q.opened, err = q.loadOpenedSettings(q.ctx); err != nil {
+		q.db.Close()
+		if q.path != "" {
+			releasePath(q.path)
+		}
+		return nil, fmt.Errorf("couac: new database: load settings: %w", err)
+	}
+	q.startExporter()
 	return q, nil
 }
 
@@ -227,10 +340,22 @@ func (q *DB) Close() error {
 	if q.closed.Swap(true) {
 		return nil // already closed
 	}
+
+	q.stopExporter()
+
+	var errs []error
+	// Stop the default pool from being created, then close it before
+	// taking the write lock: closing its idle connections needs it.
+	q.poolOnce.Do(func() {})
+	if q.pool != nil {
+		if err := q.pool.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("couac: close pool: %w", err))
+		}
+	}
+
 	q.mu.Lock()
 	defer q.mu.Unlock()
 
-	var errs []error
 	for _, d := range q.ducklings {
 		if err := d.conn.Close(); err != nil {
 			errs = append(errs, fmt.Errorf("couac: close connection: %w", err))
@@ -244,12 +369,75 @@ func (q *DB) Close() error {
 	}
 
 	if q.path != "" {
-		openDatabases.Delete(q.path)
+		releasePath(q.path)
 	}
 
 	return errors.Join(errs...)
 }
 
+// Reopen opens the database file of a read-only DB ([WithReadOnly])
+// again, so that it sees the data checkpointed to the path since it
+// was opened. It returns nil without doing anything for other DBs,
+// which already see every change.
+//
+// As DuckDB keeps writers out of a file that readers have open, a
+// writer in another process typically publishes new data by writing a
+// copy of the database and renaming it over the path, as [DB.Compact]
+// does; readers keep the file they opened until they call Reopen.
+//
+// Reopen acquires the write lock, so it waits for any in-flight
+// operations to complete. It fails with [ErrResultsOpen] while a
+// [QueryResult] or database/sql rows are not closed, since their
+// readers stream from the connections being replaced. Open connections
+// are moved to the new database and remain valid, but lose their
+// session state: temporary tables, session settings, and attached
+// databases. Their active transactions end; the [Tx] handles return
+// [ErrTxDone]. If the file cannot be opened, the DB is left as it was.
+func (q *DB) Reopen() error {
+	if err := q.ensureOpen(); err != nil {
+		return err
+	}
+	if !q.readOnly {
+		return nil
+	}
+	q.lock()
+	defer q.mu.Unlock()
+	if n := q.openResults.Load(); n > 0 {
+		return fmt.Errorf("couac: reopen database: %w (%d)", ErrResultsOpen, n)
+	}
+
+	db, err := q.openDatabase(q.dbOpts)
+	if err != nil {
+		return fmt.Errorf("couac: reopen database: %w", err)
+	}
+	var errs []error
+	for _, d := range q.ducklings {
+		if err := d.conn.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("couac: close connection: %w", err))
+		}
+		if d.conn, err = db.Open(q.ctx); err != nil {
+			d.closed.Store(true)
+			errs = append(errs, fmt.Errorf("couac: reopen connection: %w", err))
+		}
+		// The transaction and session settings went with the old
+		// connection.
+		if tx := d.tx.Load(); tx != nil {
+			tx.mu.Lock()
+			tx.end()
+			tx.mu.Unlock()
+		}
+		d.sqlTx.Store(false)
+		d.settingInputs.Clear()
+	}
+	q.settingInputs.Clear()
+	q.ducklings = slices.DeleteFunc(q.ducklings, func(d *Conn) bool { return d.closed.Load() })
+	if err := q.db.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("couac: close database: %w", err))
+	}
+	q.db = db
+	return errors.Join(errs...)
+}
+
 // Path returns the path to the database file. An empty string indicates
 // an in-memory database.
 func (q *DB) Path() string { return q.path }
@@ -292,10 +480,9 @@ func (q *DB) DriverPath() string { return q.driverPath }
 
 // resetOpenDatabases is used by tests to clear the open-path guard.
 func resetOpenDatabases() {
-	openDatabases.Range(func(key, value any) bool {
-		openDatabases.Delete(key)
-		return true
-	})
+	openMu.Lock()
+	defer openMu.Unlock()
+	clear(openDatabases)
 }
 
 // ensureOpen returns ErrDatabaseClosed if the database has been closed.
@@ -0,0 +1,187 @@
+package couac
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// AccessMode is the access_mode of a database.
+type AccessMode string
+
+const (
+	// AccessModeAutomatic opens file-backed databases read-write.
+	AccessModeAutomatic AccessMode = "automatic"
+	// AccessModeReadOnly opens the database file read-only; DuckDB
+	// does not support it for in-memory databases.
+	AccessModeReadOnly AccessMode = "read_only"
+	// AccessModeReadWrite opens the database file read-write.
+	AccessModeReadWrite AccessMode = "read_write"
+)
+
+// Config holds DuckDB settings applied when the database is opened,
+// with [WithConfig]. Unlike [Conn.Set], they apply from the start and
+// include settings that cannot be changed afterwards, such as
+// AccessMode. Zero values keep DuckDB's defaults; the pointer fields
+// are for settings whose default is true.
+//
+// Example:
+//
+//	db, err := couac.NewDuck(
+//	    couac.WithPath("analytics.db"),
+//	    couac.WithConfig(couac.Config{
+//	        MemoryLimit:             "4GB",
+//	        Threads:                 8,
+//	        AutoloadKnownExtensions: new(false),
+//	    }),
+//	)
+type Config struct {
+	// MemoryLimit limits the buffer manager, e.g. "4GB" or "512MiB";
+	// "none" or "-1" removes the limit.
+	MemoryLimit string
+	// Threads is the number of threads used to run queries.
+	Threads int
+	// TempDirectory is the directory data is spilled to when memory is
+	// insufficient.
+	TempDirectory string
+	// MaxTempDirectorySize limits the temp directory, e.g. "50GB".
+	MaxTempDirectorySize string
+	// AccessMode opens the database read-only or read-write.
+	AccessMode AccessMode
+	// DefaultOrder is the direction of ORDER BY clauses that do not
+	// give one: "asc" or "desc".
+	DefaultOrder string
+	// PreserveInsertionOrder, when false, lets queries return rows in
+	// any order, which reduces memory use.
+	PreserveInsertionOrder *bool
+	// EnableExternalAccess, when false, prevents queries from reading
+	// or writing files and attaching databases.
+	EnableExternalAccess *bool
+	// AllowUnsignedExtensions allows loading extensions that are not
+	// signed by DuckDB.
+	AllowUnsignedExtensions bool
+	// AutoloadKnownExtensions and AutoinstallKnownExtensions control
+	// whether DuckDB loads, and installs, core extensions on first use.
+	AutoloadKnownExtensions    *bool
+	AutoinstallKnownExtensions *bool
+	// ExtensionDirectory is where extensions are installed.
+	ExtensionDirectory string
+	// Settings holds other DuckDB settings by name, as set with
+	// [WithSetting].
+	Settings map[string]string
+}
+
+// WithConfig applies cfg when the database is opened. Its Settings are
+// added to those of earlier WithConfig and [WithSetting] options; its
+// other fields replace those of an earlier WithConfig.
+func WithConfig(c Config) Option {
+	return func(cfg config) {
+		settings := cfg.dbConfig.Settings
+		cfg.dbConfig = c
+		cfg.dbConfig.Settings = settings
+		for k, v := range c.Settings {
+			WithSetting(k, v)(cfg)
+		}
+	}
+}
+
+// WithSetting applies the DuckDB setting key (see duckdb_settings())
+// when the database is opened. DuckDB checks the value when the
+// database is opened.
+//
+// Example:
+//
+//	couac.WithSetting("default_null_order", "nulls_last")
+func WithSetting(key, value string) Option {
+	return func(cfg config) {
+		if cfg.dbConfig.Settings == nil {
+			cfg.dbConfig.Settings = make(map[string]string)
+		}
+		cfg.dbConfig.Settings[strings.ToLower(key)] = value
+	}
+}
+
+// Config returns the configuration the database was opened with.
+func (q *DB) Config() Config {
+	c := q.dbConfig
+	c.Settings = maps.Clone(c.Settings)
+	return c
+}
+
+var (
+	// settingName matches the names of DuckDB settings.
+	settingName = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+	// sizeValue matches the memory sizes DuckDB accepts, including its
+	// forms for no limit.
+	sizeValue = regexp.MustCompile(`(?i)^(\d+(\.\d+)?\s*([kmgt]i?b|b|bytes)?|-1|none)$`)
+)
+
+// options validates c and returns the database options it sets.
+func (c Config) options() (map[string]string, error) {
+	opts := make(map[string]string)
+	set := func(key, value string) {
+		if value != "" {
+			opts[key] = value
+		}
+	}
+	setBool := func(key string, v *bool) {
+		if v != nil {
+			opts[key] = strconv.FormatBool(*v)
+		}
+	}
+	for key, v := range map[string]string{"memory_limit": c.MemoryLimit, "max_temp_directory_size": c.MaxTempDirectorySize} {
+		v = strings.TrimSpace(v)
+		if v != "" && !sizeValue.MatchString(v) {
+			return nil, fmt.Errorf("%w: %s: %q is not a size such as \"4GB\"", ErrInvalidConfig, key, v)
+		}
+		if strings.EqualFold(v, "none") {
+			// DuckDB only accepts it in lower case.
+			v = "none"
+		}
+		set(key, v)
+	}
+	switch {
+	case c.Threads < 0:
+		return nil, fmt.Errorf("%w: threads: %d is negative", ErrInvalidConfig, c.Threads)
+	case c.Threads > 0:
+		set("threads", strconv.Itoa(c.Threads))
+	}
+	switch mode := AccessMode(strings.ToLower(string(c.AccessMode))); mode {
+	case "":
+	case AccessModeAutomatic, AccessModeReadOnly, AccessModeReadWrite:
+		set("access_mode", string(mode))
+	default:
+		return nil, fmt.Errorf("%w: access_mode: unknown mode %q", ErrInvalidConfig, c.AccessMode)
+	}
+	switch order := strings.ToLower(c.DefaultOrder); order {
+	case "", "asc", "desc":
+		set("default_order", order)
+	default:
+		return nil, fmt.Errorf("%w: default_order: %q is not asc or desc", ErrInvalidConfig, c.DefaultOrder)
+	}
+	set("temp_directory", c.TempDirectory)
+	set("extension_directory", c.ExtensionDirectory)
+	setBool("preserve_insertion_order", c.PreserveInsertionOrder)
+	setBool("enable_external_access", c.EnableExternalAccess)
+	setBool("autoload_known_extensions", c.AutoloadKnownExtensions)
+	setBool("autoinstall_known_extensions", c.AutoinstallKnownExtensions)
+	if c.AllowUnsignedExtensions {
+		set("allow_unsigned_extensions", "true")
+	}
+
+	for key, v := range c.Settings {
+		switch {
+		case !settingName.MatchString(key):
+			return nil, fmt.Errorf("%w: %q is not a setting name", ErrInvalidConfig, key)
+		case key == "driver" || key == "entrypoint" || key == "path":
+			return nil, fmt.Errorf("%w: %s is set by couac", ErrInvalidConfig, key)
+		}
+		if _, ok := opts[key]; ok {
+			return nil, fmt.Errorf("%w: %s is set by both a Config field and WithSetting", ErrInvalidConfig, key)
+		}
+		opts[key] = v
+	}
+	return opts, nil
+}
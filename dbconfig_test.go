@@ -0,0 +1,123 @@
+package couac_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/loicalleyne/couac"
+)
+
+func TestWithConfig(t *testing.T) {
+	db := newTestDB(t,
+		couac.WithConfig(couac.Config{
+			MemoryLimit:             "1GB",
+			Threads:                 2,
+			DefaultOrder:            "DESC",
+			AutoloadKnownExtensions: new(false),
+		}),
+		couac.WithSetting("default_null_order", "nulls_first"),
+	)
+	conn, err := db.Connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ctx := context.Background()
+
+	for key, want := range map[string]string{
+		"threads":                   "2",
+		"default_order":             "DESC",
+		"default_null_order":        "NULLS_FIRST",
+		"autoload_known_extensions": "false",
+	} {
+		got, err := conn.Setting(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+	vals, err := couac.QueryAs[int64](ctx, conn, "SELECT range FROM range(3) ORDER BY range")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vals[0] != 2 {
+		t.Errorf("expected descending default order, got %v", vals)
+	}
+
+	cfg := db.Config()
+	if cfg.Threads != 2 || cfg.Settings["default_null_order"] != "nulls_first" {
+		t.Errorf("unexpected Config() %+v", cfg)
+	}
+	cfg.Settings["threads"] = "64"
+	if _, ok := db.Config().Settings["threads"]; ok {
+		t.Error("expected Config() to return a copy")
+	}
+}
+
+func TestWithConfig_NoMemoryLimit(t *testing.T) {
+	for _, limit := range []string{"none", "-1", "NONE"} {
+		db, err := couac.NewDuck(couac.WithDriverName("duckdb"), couac.WithConfig(couac.Config{
+			MemoryLimit:          limit,
+			MaxTempDirectorySize: limit,
+		}))
+		if errors.Is(err, couac.ErrInvalidConfig) {
+			t.Errorf("%s: %v", limit, err)
+			continue
+		}
+		if err != nil {
+			t.Skipf("skipping: cannot open DuckDB (driver not found?): %v", err)
+		}
+		db.Close()
+	}
+}
+
+func TestWithConfig_Invalid(t *testing.T) {
+	for name, opt := range map[string]couac.Option{
+		"size":      couac.WithConfig(couac.Config{MemoryLimit: "lots"}),
+		"threads":   couac.WithConfig(couac.Config{Threads: -1}),
+		"mode":      couac.WithConfig(couac.Config{AccessMode: "sometimes"}),
+		"order":     couac.WithConfig(couac.Config{DefaultOrder: "up"}),
+		"name":      couac.WithSetting("threads; DROP TABLE t", "1"),
+		"reserved":  couac.WithSetting("path", "/tmp/x.db"),
+		"duplicate": couac.WithConfig(couac.Config{Threads: 2, Settings: map[string]string{"threads": "4"}}),
+	} {
+		if _, err := couac.NewDuck(couac.WithDriverName("duckdb"), opt); !errors.Is(err, couac.ErrInvalidConfig) {
+			t.Errorf("%s: expected ErrInvalidConfig, got %v", name, err)
+		}
+	}
+	db, err := couac.NewDuck(couac.WithDriverName("duckdb"), couac.WithSetting("no_such_setting", "1"))
+	if err == nil {
+		db.Close()
+		t.Error("expected DuckDB to reject an unknown setting")
+	}
+}
+
+func TestWithConfig_ReadOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ro.db")
+	db := newTestDB(t, couac.WithPath(path))
+	conn, err := db.Connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Exec(context.Background(), "CREATE TABLE t AS SELECT 1 AS x"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	ro := newTestDB(t, couac.WithPath(path), couac.WithConfig(couac.Config{AccessMode: couac.AccessModeReadOnly}))
+	conn, err = ro.Connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if n := tableCount(t, conn, "t"); n != 1 {
+		t.Errorf("expected 1 row, got %d", n)
+	}
+	if _, err := conn.Exec(context.Background(), "INSERT INTO t VALUES (2)"); err == nil {
+		t.Error("expected a write to a read-only database to fail")
+	}
+}
@@ -0,0 +1,339 @@
+package couac
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/apache/arrow-adbc/go/adbc"
+)
+
+// Error is an error reported by DuckDB for a statement. It wraps the
+// underlying [adbc.Error], which remains reachable with errors.As, and
+// matches one of the error class sentinels ([ErrConstraintViolation],
+// [ErrTransactionConflict], [ErrCatalog], [ErrParser], [ErrBinder],
+// [ErrOutOfMemory], [ErrInterrupted]) with errors.Is when the error is
+// of that class. Statements rejected because the database is read-only
+// match [ErrReadOnly].
+//
+// Example:
+//
+//	_, err := conn.Exec(ctx, "INSERT INTO users VALUES (1, 'ann')")
+//	if errors.Is(err, couac.ErrConstraintViolation) {
+//	    // duplicate key
+//	}
+//	var derr *couac.Error
+//	if errors.As(err, &derr) {
+//	    log.Printf("%s error at %d in %s", derr.Type, derr.Position, derr.SQL)
+//	}
+type Error struct {
+	// Kind is the error class sentinel, or nil if the error is of a
+	// class without one (e.g. "Conversion" or "Invalid Input").
+	Kind error
+	// Type is DuckDB's error type, e.g. "Constraint" or "Catalog", or
+	// empty if the message carries none.
+	Type string
+	// Message is DuckDB's message without the type prefix and without
+	// the excerpt of the offending line. With [WithRedactedSQL], quoted
+	// values and numbers in it are replaced by ?.
+	Message string
+	// SQL is the statement that failed, with literals replaced by ? when
+	// the database was opened with [WithRedactedSQL]. It is empty for
+	// ingests.
+	SQL string
+	// Position is the byte offset in the original statement that DuckDB
+	// points to, or -1 if unknown.
+	Position int
+	// Code and SQLState are the ADBC status code and SQLSTATE.
+	Code     adbc.Status
+	SQLState [5]byte
+
+	err error
+	// text replaces the message of err when it is redacted.
+	text string
+}
+
+// Error returns the message of the wrapped error, so the text of errors
+// is the same as before classification. With [WithRedactedSQL], the
+// message is rebuilt from the redacted Message, without the excerpt of
+// the offending line; the wrapped [adbc.Error] keeps DuckDB's message.
+func (e *Error) Error() string {
+	if e.text != "" {
+		return e.text
+	}
+	return e.err.Error()
+}
+
+// Unwrap returns the wrapped error.
+func (e *Error) Unwrap() error { return e.err }
+
+// Is reports whether target is the error class sentinel of e.
+func (e *Error) Is(target error) bool { return e.Kind != nil && target == e.Kind }
+
+// errorTypes maps DuckDB error type prefixes to error class sentinels.
+var errorTypes = map[string]error{
+	"Constraint":    ErrConstraintViolation,
+	"Catalog":       ErrCatalog,
+	"Parser":        ErrParser,
+	"Binder":        ErrBinder,
+	"Out of Memory": ErrOutOfMemory,
+	"INTERRUPT":     ErrInterrupted,
+	"Interrupt":     ErrInterrupted,
+}
+
+// sqlStateClasses maps SQLSTATE codes, or their two-character class, to
+// error class sentinels for drivers that report them.
+var sqlStateClasses = map[string]error{
+	"23":    ErrConstraintViolation,
+	"40001": ErrTransactionConflict,
+	"42601": ErrParser,
+	"42P01": ErrCatalog,
+	"42703": ErrBinder,
+	"53200": ErrOutOfMemory,
+	"57014": ErrInterrupted,
+}
+
+// classifyError converts an error carrying an [adbc.Error] into an
+// [*Error] for query, redacting literals in query when redact is set.
+// Other errors, and errors already classified, are returned unchanged.
+func classifyError(err error, query string, redact bool) error {
+	if err == nil {
+		return nil
+	}
+	var derr *Error
+	if errors.As(err, &derr) {
+		return err
+	}
+	var aerr adbc.Error
+	if !errors.As(err, &aerr) {
+		return err
+	}
+
+	e := &Error{
+		Code:     aerr.Code,
+		SQLState: aerr.SqlState,
+		Position: -1,
+		err:      err,
+	}
+	msg := aerr.Msg
+	if typ, rest, ok := strings.Cut(msg, " Error: "); ok && !strings.ContainsAny(typ, ":\n") {
+		e.Type, msg = typ, rest
+	}
+	excerpt := ""
+	if i := strings.Index(msg, "\n\nLINE "); i >= 0 {
+		msg, excerpt = msg[:i], msg[i+2:]
+	}
+	e.Message = strings.TrimSpace(msg)
+	e.Position = errorPosition(query, excerpt)
+	e.Kind = errorKind(e.Type, e.Message, aerr)
+	if redact {
+		e.SQL = redactSQL(query)
+		e.Message = redactMessage(e.Message)
+		raerr := aerr
+		raerr.Msg = e.Message
+		if e.Type != "" {
+			raerr.Msg = e.Type + " Error: " + e.Message
+		}
+		e.text = strings.Replace(err.Error(), aerr.Error(), raerr.Error(), 1)
+	} else {
+		e.SQL = query
+	}
+	return e
+}
+
+// errorKind returns the error class sentinel for a DuckDB error type and
+// message, falling back to the SQLSTATE and ADBC status code.
+func errorKind(typ, msg string, aerr adbc.Error) error {
+	if kind, ok := errorTypes[typ]; ok {
+		return kind
+	}
+	if strings.HasPrefix(typ, "Transaction") && strings.Contains(strings.ToLower(msg), "conflict") {
+		return ErrTransactionConflict
+	}
+	if strings.Contains(msg, "read-only mode") {
+		return ErrReadOnly
+	}
+	state := strings.TrimRight(string(aerr.SqlState[:]), "\x00")
+	if kind, ok := sqlStateClasses[state]; ok {
+		return kind
+	}
+	if len(state) == 5 {
+		if kind, ok := sqlStateClasses[state[:2]]; ok {
+			return kind
+		}
+	}
+	switch aerr.Code {
+	case adbc.StatusIntegrity:
+		return ErrConstraintViolation
+	case adbc.StatusCancelled:
+		return ErrInterrupted
+	}
+	return nil
+}
+
+// errorPosition computes the byte offset in query pointed to by a DuckDB
+// error excerpt of the form
+//
+//	LINE 3:   bogus
+//	          ^
+//
+// DuckDB shortens long lines to a window marked by "...", so the shown
+// text is located in the statement line rather than assumed to start it.
+// It returns -1 if the excerpt does not match query.
+func errorPosition(query, excerpt string) int {
+	head, caretLine, ok := strings.Cut(excerpt, "\n")
+	if !ok {
+		return -1
+	}
+	num, shown, ok := strings.Cut(strings.TrimPrefix(head, "LINE "), ": ")
+	if !ok {
+		return -1
+	}
+	caret := strings.IndexByte(caretLine, '^') - (len(head) - len(shown))
+	if caret < 0 {
+		return -1
+	}
+	n := 0
+	for _, c := range num {
+		if c < '0' || c > '9' {
+			return -1
+		}
+		n = n*10 + int(c-'0')
+	}
+
+	lines := strings.SplitAfter(query, "\n")
+	if n < 1 || n > len(lines) {
+		return -1
+	}
+	start := 0
+	for _, l := range lines[:n-1] {
+		start += len(l)
+	}
+	line := strings.TrimRight(lines[n-1], "\r\n")
+
+	shown = strings.TrimSuffix(shown, "...")
+	if trimmed, ok := strings.CutPrefix(shown, "..."); ok {
+		shown = trimmed
+		caret -= 3
+	}
+	offset := strings.Index(line, shown)
+	if offset < 0 || caret < 0 || offset+caret > len(line) {
+		return -1
+	}
+	return start + offset + caret
+}
+
+// redactSQL replaces string and numeric literals in query with ?, so
+// that statements can be logged without the values they carry. Quoted
+// identifiers and comments are kept.
+func redactSQL(query string) string {
+	var b strings.Builder
+	b.Grow(len(query))
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == '\'':
+			// String literal; '' is an escaped quote.
+			j := i + 1
+			for j < len(query) {
+				if query[j] == '\'' {
+					if j+1 < len(query) && query[j+1] == '\'' {
+						j += 2
+						continue
+					}
+					break
+				}
+				j++
+			}
+			b.WriteByte('?')
+			i = j + 1
+		case c == '"':
+			j := strings.IndexByte(query[i+1:], '"')
+			if j < 0 {
+				b.WriteString(query[i:])
+				return b.String()
+			}
+			b.WriteString(query[i : i+j+2])
+			i += j + 2
+		case c == '-' && strings.HasPrefix(query[i:], "--"):
+			j := strings.IndexByte(query[i:], '\n')
+			if j < 0 {
+				b.WriteString(query[i:])
+				return b.String()
+			}
+			b.WriteString(query[i : i+j])
+			i += j
+		case c >= '0' && c <= '9' && (i == 0 || !isIdentByte(query[i-1])):
+			j := i
+			for j < len(query) && (isIdentByte(query[j]) || query[j] == '.') {
+				j++
+			}
+			b.WriteByte('?')
+			i = j
+		case isIdentByte(c):
+			j := i
+			for j < len(query) && isIdentByte(query[j]) {
+				j++
+			}
+			b.WriteString(query[i:j])
+			i = j
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String()
+}
+
+// redactMessage replaces quoted values and numbers in a DuckDB error
+// message with ?, as in
+//
+//	Duplicate key "ssn: 123-45-6789" violates primary key constraint
+//
+// Unlike in statements, double quotes in messages usually enclose values
+// rather than identifiers.
+func redactMessage(msg string) string {
+	var b strings.Builder
+	b.Grow(len(msg))
+	for i := 0; i < len(msg); {
+		c := msg[i]
+		switch {
+		case c == '\'' || c == '"':
+			j := strings.IndexByte(msg[i+1:], c)
+			if j < 0 {
+				b.WriteByte('?')
+				return b.String()
+			}
+			b.WriteByte('?')
+			i += j + 2
+		case c >= '0' && c <= '9' && (i == 0 || !isIdentByte(msg[i-1])):
+			j := i
+			for j < len(msg) && (isIdentByte(msg[j]) || msg[j] == '.') {
+				j++
+			}
+			b.WriteByte('?')
+			i = j
+		case isIdentByte(c):
+			j := i
+			for j < len(msg) && isIdentByte(msg[j]) {
+				j++
+			}
+			b.WriteString(msg[i:j])
+			i = j
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String()
+}
+
+// isIdentByte reports whether c can appear in an unquoted identifier.
+func isIdentByte(c byte) bool {
+	return c == '_' || c == '$' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80
+}
+
+// sqlError classifies an error returned while executing query on q.
+func (q *Conn) sqlError(err error, query string) error {
+	parent := q.parent
+	return classifyError(err, query, parent != nil && parent.redactSQL)
+}
@@ -0,0 +1,179 @@
+package couac_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow-adbc/go/adbc"
+	"github.com/loicalleyne/couac"
+)
+
+func TestError_Classes(t *testing.T) {
+	_, conn := newTestConn(t)
+	ctx := context.Background()
+	if _, err := conn.Exec(ctx, "CREATE TABLE k (id INT PRIMARY KEY, v INT NOT NULL)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Exec(ctx, "INSERT INTO k VALUES (1, 1)"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query string
+		kind  error
+		typ   string
+	}{
+		{"INSERT INTO k VALUES (1, 2)", couac.ErrConstraintViolation, "Constraint"},
+		{"INSERT INTO k VALUES (2, NULL)", couac.ErrConstraintViolation, "Constraint"},
+		{"SELECT * FROM nope", couac.ErrCatalog, "Catalog"},
+		{"SELEC 1", couac.ErrParser, "Parser"},
+		{"SELECT nope FROM k", couac.ErrBinder, "Binder"},
+		{"SELECT * FROM k WHERE id = 'x'", nil, "Conversion"},
+	}
+	for _, tt := range tests {
+		_, err := conn.Exec(ctx, tt.query)
+		var derr *couac.Error
+		if !errors.As(err, &derr) {
+			t.Errorf("%s: expected *couac.Error, got %v", tt.query, err)
+			continue
+		}
+		if tt.kind != nil && !errors.Is(err, tt.kind) {
+			t.Errorf("%s: expected errors.Is(%v), got kind %v", tt.query, tt.kind, derr.Kind)
+		}
+		if derr.Kind != tt.kind || derr.Type != tt.typ {
+			t.Errorf("%s: expected %v / %q, got %v / %q", tt.query, tt.kind, tt.typ, derr.Kind, derr.Type)
+		}
+		if derr.SQL != tt.query {
+			t.Errorf("expected SQL %q, got %q", tt.query, derr.SQL)
+		}
+		var aerr adbc.Error
+		if !errors.As(err, &aerr) {
+			t.Errorf("%s: expected the adbc.Error to stay reachable", tt.query)
+		}
+	}
+
+	// Query reports classified errors too.
+	if _, err := conn.Query(ctx, "SELECT * FROM nope"); !errors.Is(err, couac.ErrCatalog) {
+		t.Errorf("Query: expected ErrCatalog, got %v", err)
+	}
+}
+
+func TestError_Position(t *testing.T) {
+	_, conn := newTestConn(t)
+	ctx := context.Background()
+
+	query := "SELECT\n  1 AS a,\n  bogus\nFROM range(3)"
+	_, err := conn.Exec(ctx, query)
+	var derr *couac.Error
+	if !errors.As(err, &derr) {
+		t.Fatalf("expected *couac.Error, got %v", err)
+	}
+	if want := 19; derr.Position != want {
+		t.Errorf("expected position %d, got %d", want, derr.Position)
+	}
+	if !strings.HasPrefix(derr.Message, `Referenced column "bogus" not found`) {
+		t.Errorf("unexpected message %q", derr.Message)
+	}
+}
+
+func TestError_RedactedSQL(t *testing.T) {
+	db := newTestDB(t, couac.WithRedactedSQL())
+	conn, err := db.Connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	_, err = conn.Exec(context.Background(), `SELECT "secret col", 'hunter2', 42 FROM nope`)
+	var derr *couac.Error
+	if !errors.As(err, &derr) {
+		t.Fatalf("expected *couac.Error, got %v", err)
+	}
+	if want := `SELECT "secret col", ?, ? FROM nope`; derr.SQL != want {
+		t.Errorf("expected redacted SQL %q, got %q", want, derr.SQL)
+	}
+
+	ctx := context.Background()
+	if _, err := conn.Exec(ctx, "CREATE TABLE people (ssn VARCHAR PRIMARY KEY)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Exec(ctx, "INSERT INTO people VALUES ('123-45-6789')"); err != nil {
+		t.Fatal(err)
+	}
+	_, err = conn.Exec(ctx, "INSERT INTO people VALUES ('123-45-6789')")
+	if !errors.Is(err, couac.ErrConstraintViolation) {
+		t.Fatalf("expected ErrConstraintViolation, got %v", err)
+	}
+	if strings.Contains(err.Error(), "6789") {
+		t.Errorf("expected the key to be redacted, got %q", err)
+	}
+	if !strings.Contains(err.Error(), "Duplicate key ? violates primary key constraint") {
+		t.Errorf("unexpected redacted message %q", err)
+	}
+
+	_, err = conn.Exec(ctx, "SELECT 'hunter2' + bogus")
+	if err == nil || strings.Contains(err.Error(), "hunter2") || strings.Contains(err.Error(), "LINE") {
+		t.Errorf("expected the excerpt to be dropped, got %q", err)
+	}
+}
+
+func TestError_TransactionConflict(t *testing.T) {
+	db, conn := newTestConn(t)
+	ctx := context.Background()
+	if _, err := conn.Exec(ctx, "CREATE TABLE c (id INT, v INT)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Exec(ctx, "INSERT INTO c VALUES (1, 1)"); err != nil {
+		t.Fatal(err)
+	}
+	other, err := db.Connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	conn.Exec(ctx, "BEGIN TRANSACTION")
+	other.Exec(ctx, "BEGIN TRANSACTION")
+	if _, err := conn.Exec(ctx, "UPDATE c SET v = 2 WHERE id = 1"); err != nil {
+		t.Fatal(err)
+	}
+	_, err = other.Exec(ctx, "UPDATE c SET v = 3 WHERE id = 1")
+	if !errors.Is(err, couac.ErrTransactionConflict) {
+		t.Errorf("expected ErrTransactionConflict, got %v", err)
+	}
+	other.Exec(ctx, "ROLLBACK")
+	conn.Exec(ctx, "COMMIT")
+}
+
+func TestError_StdDB(t *testing.T) {
+	db := newTestDB(t)
+	sqlDB := db.StdDB()
+	defer sqlDB.Close()
+	ctx := context.Background()
+
+	if _, err := sqlDB.ExecContext(ctx, "SELEC 1"); !errors.Is(err, couac.ErrParser) {
+		t.Errorf("expected ErrParser, got %v", err)
+	}
+	stmt, err := sqlDB.PrepareContext(ctx, "SELECT * FROM nope WHERE id = ?")
+	if err == nil {
+		_, err = stmt.QueryContext(ctx, 1)
+		stmt.Close()
+	}
+	if !errors.Is(err, couac.ErrCatalog) {
+		t.Errorf("expected ErrCatalog, got %v", err)
+	}
+}
+
+func TestError_Interrupted(t *testing.T) {
+	_, conn := newTestConn(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	_, err := conn.Exec(ctx, slowQuery)
+	if !errors.Is(err, couac.ErrInterrupted) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected ErrInterrupted and context.DeadlineExceeded, got %v", err)
+	}
+}
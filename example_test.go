@@ -3,6 +3,8 @@ package couac_test
 import (
 	"context"
 	"fmt"
+	"os"
+	"path/filepath"
 
 	"github.com/apache/arrow-go/v18/arrow"
 	"github.com/apache/arrow-go/v18/arrow/array"
@@ -25,8 +27,15 @@ func ExampleNewDuck() {
 }
 
 func ExampleNewDuck_fileBacked() {
+	dir, err := os.MkdirTemp("", "couac-example")
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
 	// Open a file-backed DuckDB database.
-	db, err := couac.NewDuck(couac.WithPath("example.db"))
+	db, err := couac.NewDuck(couac.WithPath(filepath.Join(dir, "example.db")))
 	if err != nil {
 		fmt.Println("Error:", err)
 		return
@@ -127,6 +136,44 @@ func ExampleConn_Query() {
 	// red = #FF0000
 }
 
+func ExampleConn_QueryArgs() {
+	db, err := couac.NewDuck()
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	defer db.Close()
+
+	conn, err := db.Connect()
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	defer conn.Close()
+
+	ctx := context.Background()
+	conn.Exec(ctx, "CREATE TABLE pets (name VARCHAR, age INTEGER)")
+	conn.ExecArgs(ctx, "INSERT INTO pets VALUES (?, ?)", "rex", 3)
+	conn.ExecArgs(ctx, "INSERT INTO pets VALUES ($1, $2)", "tom's cat", 7)
+
+	// Parameters are bound, never formatted into the SQL text.
+	res, err := conn.QueryArgs(ctx, "SELECT name FROM pets WHERE age > ?", 5)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	defer res.Close()
+
+	for res.Reader.Next() {
+		rec := res.Reader.RecordBatch()
+		for i := 0; i < int(rec.NumRows()); i++ {
+			fmt.Println(rec.Column(0).ValueStr(i))
+		}
+	}
+	// Output:
+	// tom's cat
+}
+
 func ExampleConn_Ingest() {
 	db, err := couac.NewDuck()
 	if err != nil {
@@ -818,7 +865,7 @@ func ExampleConn_IngestMerge() {
 
 	conn.Ingest(ctx, "evolving", rec1)
 
-	// Second ingest: adds a new "email" column via UNION BY NAME.
+	// Second ingest: adds a new "email" column via ALTER TABLE ADD COLUMN.
 	schema2 := arrow.NewSchema([]arrow.Field{
 		{Name: "id", Type: arrow.PrimitiveTypes.Int64},
 		{Name: "name", Type: arrow.BinaryTypes.String},
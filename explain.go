@@ -0,0 +1,332 @@
+package couac
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ExplainFormat is the output format of EXPLAIN.
+type ExplainFormat string
+
+const (
+	// ExplainJSON is the default format; it is the only one
+	// [Conn.ExplainPlan] parses into an operator tree.
+	ExplainJSON ExplainFormat = "json"
+	// ExplainText is the box-drawing rendering returned by [Conn.Explain].
+	ExplainText ExplainFormat = "text"
+	// ExplainHTML and ExplainGraphviz render the plan for display.
+	ExplainHTML     ExplainFormat = "html"
+	ExplainGraphviz ExplainFormat = "graphviz"
+)
+
+// ExplainOptions configures [Conn.ExplainPlan].
+type ExplainOptions struct {
+	// Analyze runs the query (EXPLAIN ANALYZE) to record the actual
+	// cardinality and timing of each operator. The query's result is
+	// discarded, but its side effects, if any, are not.
+	Analyze bool
+	// Format is the format of Plan.Raw, one of the ExplainFormat
+	// constants. Operators are only parsed for ExplainJSON, the default.
+	Format ExplainFormat
+}
+
+// Plan is the physical plan of a query, as returned by
+// [Conn.ExplainPlan].
+type Plan struct {
+	// Analyzed reports whether the plan was recorded with EXPLAIN
+	// ANALYZE, and so carries actual cardinalities and timings.
+	Analyzed bool
+	// Latency is the time the query took when analyzed.
+	Latency time.Duration
+	// Operators are the roots of the operator tree, in JSON format.
+	Operators []*PlanNode
+	// Raw is the plan as DuckDB rendered it in the requested format.
+	Raw string
+}
+
+// PlanNode is an operator of a [Plan].
+type PlanNode struct {
+	// Name is the display name of the operator, such as "HASH_GROUP_BY"
+	// or "SEQ_SCAN".
+	Name string
+	// EstimatedCardinality is the number of rows the optimizer expected
+	// the operator to produce, or -1 if it did not report one.
+	EstimatedCardinality int64
+	// ActualCardinality is the number of rows the operator produced, or
+	// -1 if the plan was not analyzed.
+	ActualCardinality int64
+	// Timing is the time spent in the operator when analyzed.
+	Timing time.Duration
+	// ExtraInfo holds operator details, such as "Projections",
+	// "Filters", or "Table", without the estimated cardinality.
+	ExtraInfo map[string]string
+	// Children are the operators that feed this one.
+	Children []*PlanNode
+}
+
+// ExplainPlan returns the physical plan of query. With opts.Analyze,
+// the query is run and the plan records what each operator actually
+// produced.
+//
+// Example:
+//
+//	plan, err := conn.ExplainPlan(ctx, "SELECT ...", couac.ExplainOptions{Analyze: true})
+//	if err != nil {
+//	    return err
+//	}
+//	plan.Walk(func(n *couac.PlanNode, depth int) {
+//	    fmt.Println(strings.Repeat("  ", depth), n.Name, n.EstimatedCardinality, n.ActualCardinality)
+//	})
+func (q *Conn) ExplainPlan(ctx context.Context, query string, opts ExplainOptions) (*Plan, error) {
+	format := opts.Format
+	switch format {
+	case "":
+		format = ExplainJSON
+	case ExplainJSON, ExplainText, ExplainHTML, ExplainGraphviz:
+	default:
+		return nil, fmt.Errorf("couac: explain: unknown format %q", format)
+	}
+	var sb strings.Builder
+	sb.WriteString("EXPLAIN (")
+	if opts.Analyze {
+		sb.WriteString("ANALYZE, ")
+	}
+	fmt.Fprintf(&sb, "FORMAT %s) %s", strings.ToUpper(string(format)), query)
+
+	res, err := q.Query(ctx, sb.String())
+	if err != nil {
+		return nil, fmt.Errorf("couac: explain: %w", err)
+	}
+	defer res.Close()
+
+	// EXPLAIN returns explain_key, explain_value rows; with the
+	// explain_output setting, logical plans come before the physical
+	// one.
+	want := "physical_plan"
+	if opts.Analyze {
+		want = "analyzed_plan"
+	}
+	plan := &Plan{Analyzed: opts.Analyze}
+	found := false
+	for res.Reader.Next() {
+		rec := res.Reader.RecordBatch()
+		if rec.NumCols() < 2 {
+			continue
+		}
+		for i := 0; i < int(rec.NumRows()); i++ {
+			if rec.Column(0).ValueStr(i) == want {
+				plan.Raw = cloneStr(rec.Column(1).ValueStr(i))
+				found = true
+			}
+		}
+	}
+	if err := res.Reader.Err(); err != nil {
+		return nil, fmt.Errorf("couac: explain: %w", q.sqlError(err, sb.String()))
+	}
+	if !found {
+		return nil, fmt.Errorf("couac: explain: no %s returned", want)
+	}
+	if format != ExplainJSON {
+		return plan, nil
+	}
+
+	var roots []*profileJSON
+	if opts.Analyze {
+		var raw profileJSON
+		if err := json.Unmarshal([]byte(plan.Raw), &raw); err != nil {
+			return nil, fmt.Errorf("couac: parse plan: %w", err)
+		}
+		plan.Latency = seconds(raw.Latency)
+		roots = raw.Children
+		// Skip the EXPLAIN_ANALYZE operator that wraps the query.
+		if len(roots) == 1 && roots[0].OperatorType == "EXPLAIN_ANALYZE" {
+			roots = roots[0].Children
+		}
+	} else if err := json.Unmarshal([]byte(plan.Raw), &roots); err != nil {
+		return nil, fmt.Errorf("couac: parse plan: %w", err)
+	}
+	for _, r := range roots {
+		plan.Operators = append(plan.Operators, r.planNode(opts.Analyze))
+	}
+	return plan, nil
+}
+
+func (r *profileJSON) planNode(analyzed bool) *PlanNode {
+	n := &PlanNode{
+		Name:                 strings.TrimSpace(cmp.Or(r.OperatorName, r.Name)),
+		EstimatedCardinality: -1,
+		ActualCardinality:    -1,
+		ExtraInfo:            extraInfo(r.ExtraInfo),
+	}
+	if analyzed {
+		n.ActualCardinality, n.Timing = r.OperatorCardinality, seconds(r.OperatorTiming)
+	}
+	if est, ok := n.ExtraInfo["Estimated Cardinality"]; ok {
+		if v, err := strconv.ParseInt(strings.TrimLeft(est, "~"), 10, 64); err == nil {
+			n.EstimatedCardinality = v
+		}
+		delete(n.ExtraInfo, "Estimated Cardinality")
+	}
+	for _, c := range r.Children {
+		n.Children = append(n.Children, c.planNode(analyzed))
+	}
+	return n
+}
+
+// Walk calls fn for every operator of the plan, parents before
+// children, with the depth of the operator in the tree.
+func (p *Plan) Walk(fn func(n *PlanNode, depth int)) {
+	var walk func(nodes []*PlanNode, depth int)
+	walk = func(nodes []*PlanNode, depth int) {
+		for _, n := range nodes {
+			fn(n, depth)
+			walk(n.Children, depth+1)
+		}
+	}
+	walk(p.Operators, 0)
+}
+
+// PlanChangeKind classifies a [PlanChange].
+type PlanChangeKind int
+
+const (
+	// PlanOperatorAdded is an operator, with its subtree, that only the
+	// new plan has.
+	PlanOperatorAdded PlanChangeKind = iota
+	// PlanOperatorRemoved is an operator, with its subtree, that only
+	// the old plan has.
+	PlanOperatorRemoved
+	// PlanOperatorReplaced is an operator of a different kind at the
+	// same position; its subtrees are not compared.
+	PlanOperatorReplaced
+	// PlanDetailChanged is a change in the ExtraInfo of an operator,
+	// such as its filters or projections.
+	PlanDetailChanged
+	// PlanCardinalityChanged is a change in the estimated, or actual,
+	// cardinality of an operator.
+	PlanCardinalityChanged
+)
+
+// String returns the kind name.
+func (k PlanChangeKind) String() string {
+	switch k {
+	case PlanOperatorAdded:
+		return "added"
+	case PlanOperatorRemoved:
+		return "removed"
+	case PlanOperatorReplaced:
+		return "replaced"
+	case PlanDetailChanged:
+		return "detail"
+	case PlanCardinalityChanged:
+		return "cardinality"
+	default:
+		return fmt.Sprintf("PlanChangeKind(%d)", int(k))
+	}
+}
+
+// PlanChange is a difference between two plans, reported by
+// [DiffPlans].
+type PlanChange struct {
+	Kind PlanChangeKind
+	// Path locates the operator by the names of the operators from the
+	// root, such as "PROJECTION/HASH_GROUP_BY[1]"; an index follows
+	// the name of an operator that is not its parent's first child.
+	Path string
+	// Old and New are the operator in each plan; one of them is nil
+	// for added and removed operators.
+	Old, New *PlanNode
+	// Key is the ExtraInfo key of a PlanDetailChanged change.
+	Key string
+}
+
+// String describes the change, such as
+// "detail PROJECTION/SEQ_SCAN Filters: a>1 -> a>2".
+func (c PlanChange) String() string {
+	switch c.Kind {
+	case PlanOperatorAdded, PlanOperatorRemoved:
+		return fmt.Sprintf("%s %s", c.Kind, c.Path)
+	case PlanOperatorReplaced:
+		return fmt.Sprintf("%s %s -> %s", c.Kind, c.Path, c.New.Name)
+	case PlanDetailChanged:
+		return fmt.Sprintf("%s %s %s: %s -> %s", c.Kind, c.Path, c.Key, c.Old.ExtraInfo[c.Key], c.New.ExtraInfo[c.Key])
+	default:
+		return fmt.Sprintf("%s %s estimated %d -> %d, actual %d -> %d", c.Kind, c.Path,
+			c.Old.EstimatedCardinality, c.New.EstimatedCardinality, c.Old.ActualCardinality, c.New.ActualCardinality)
+	}
+}
+
+// DiffPlans compares two plans of the same query, such as plans
+// recorded before and after a DuckDB upgrade, and returns their
+// differences in tree order. Operators are matched by their position
+// in the tree. Cardinalities are only compared when both plans report
+// them; filter PlanCardinalityChanged changes out to compare the shape
+// of the plans alone.
+func DiffPlans(old, new *Plan) []PlanChange {
+	var changes []PlanChange
+	diffPlanNodes(&changes, "", old.Operators, new.Operators)
+	return changes
+}
+
+func diffPlanNodes(changes *[]PlanChange, parent string, old, new []*PlanNode) {
+	for i := range max(len(old), len(new)) {
+		var o, n *PlanNode
+		if i < len(old) {
+			o = old[i]
+		}
+		if i < len(new) {
+			n = new[i]
+		}
+		name := o
+		if name == nil {
+			name = n
+		}
+		path := name.Name
+		if i > 0 {
+			path += "[" + strconv.Itoa(i) + "]"
+		}
+		if parent != "" {
+			path = parent + "/" + path
+		}
+		switch {
+		case o == nil:
+			*changes = append(*changes, PlanChange{Kind: PlanOperatorAdded, Path: path, New: n})
+			continue
+		case n == nil:
+			*changes = append(*changes, PlanChange{Kind: PlanOperatorRemoved, Path: path, Old: o})
+			continue
+		case o.Name != n.Name:
+			*changes = append(*changes, PlanChange{Kind: PlanOperatorReplaced, Path: path, Old: o, New: n})
+			continue
+		}
+		keys := slices.Sorted(maps.Keys(o.ExtraInfo))
+		for k := range n.ExtraInfo {
+			if _, ok := o.ExtraInfo[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		slices.Sort(keys)
+		for _, k := range keys {
+			if o.ExtraInfo[k] != n.ExtraInfo[k] {
+				*changes = append(*changes, PlanChange{Kind: PlanDetailChanged, Path: path, Old: o, New: n, Key: k})
+			}
+		}
+		if cardinalityChanged(o.EstimatedCardinality, n.EstimatedCardinality) ||
+			cardinalityChanged(o.ActualCardinality, n.ActualCardinality) {
+			*changes = append(*changes, PlanChange{Kind: PlanCardinalityChanged, Path: path, Old: o, New: n})
+		}
+		diffPlanNodes(changes, path, o.Children, n.Children)
+	}
+}
+
+// cardinalityChanged reports whether two known cardinalities differ.
+func cardinalityChanged(old, new int64) bool {
+	return old >= 0 && new >= 0 && old != new
+}
@@ -0,0 +1,113 @@
+package couac_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/loicalleyne/couac"
+)
+
+func TestExplainPlan(t *testing.T) {
+	_, conn := newTestConn(t)
+	ctx := context.Background()
+	if _, err := conn.Exec(ctx, "CREATE TABLE t AS SELECT range % 7 AS k, range AS v FROM range(1000)"); err != nil {
+		t.Fatal(err)
+	}
+	const query = "SELECT k, count(*) FROM t WHERE v > 10 GROUP BY k"
+
+	plan, err := conn.ExplainPlan(ctx, query, couac.ExplainOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var scan *couac.PlanNode
+	plan.Walk(func(n *couac.PlanNode, _ int) {
+		if n.Name == "SEQ_SCAN" {
+			scan = n
+		}
+	})
+	if scan == nil || scan.ExtraInfo["Filters"] != "v>10" || scan.EstimatedCardinality <= 0 || scan.ActualCardinality != -1 {
+		t.Fatalf("unexpected scan operator %+v", scan)
+	}
+	if _, ok := scan.ExtraInfo["Estimated Cardinality"]; ok {
+		t.Error("expected the estimate to be moved out of ExtraInfo")
+	}
+
+	analyzed, err := conn.ExplainPlan(ctx, query, couac.ExplainOptions{Analyze: true, Format: couac.ExplainJSON})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !analyzed.Analyzed || analyzed.Operators[0].Name == "EXPLAIN_ANALYZE" {
+		t.Fatalf("unexpected analyzed plan %+v", analyzed.Operators[0])
+	}
+	analyzed.Walk(func(n *couac.PlanNode, _ int) {
+		if n.Name == "SEQ_SCAN" && n.ActualCardinality != 989 {
+			t.Errorf("expected 989 rows from the scan, got %d", n.ActualCardinality)
+		}
+	})
+
+	text, err := conn.ExplainPlan(ctx, query, couac.ExplainOptions{Format: couac.ExplainText})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(text.Raw, "SEQ_SCAN") || text.Operators != nil {
+		t.Errorf("unexpected text plan %+v", text)
+	}
+
+	if _, err := conn.ExplainPlan(ctx, "SELECT * FROM missing", couac.ExplainOptions{}); err == nil {
+		t.Error("expected an error for a missing table")
+	}
+	if _, err := conn.ExplainPlan(ctx, query, couac.ExplainOptions{Format: "json) SELECT 1; --"}); err == nil || !strings.Contains(err.Error(), "unknown format") {
+		t.Errorf("expected an unknown format error, got %v", err)
+	}
+}
+
+func TestDiffPlans(t *testing.T) {
+	_, conn := newTestConn(t)
+	ctx := context.Background()
+	if _, err := conn.Exec(ctx, "CREATE TABLE t AS SELECT range % 7 AS k, range AS v FROM range(1000)"); err != nil {
+		t.Fatal(err)
+	}
+	explain := func(query string) *couac.Plan {
+		t.Helper()
+		plan, err := conn.ExplainPlan(ctx, query, couac.ExplainOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return plan
+	}
+
+	a := explain("SELECT v FROM t WHERE v > 10")
+	if changes := couac.DiffPlans(a, explain("SELECT v FROM t WHERE v > 10")); len(changes) != 0 {
+		t.Errorf("expected identical plans, got %v", changes)
+	}
+
+	changes := couac.DiffPlans(a, explain("SELECT v FROM t WHERE v > 500"))
+	var detail *couac.PlanChange
+	for i, c := range changes {
+		if c.Kind == couac.PlanDetailChanged {
+			detail = &changes[i]
+		}
+	}
+	if detail == nil || detail.Key != "Filters" || detail.Old.ExtraInfo["Filters"] != "v>10" {
+		t.Fatalf("expected a filter change, got %v", changes)
+	}
+	if s := detail.String(); !strings.Contains(s, "v>10 -> v>500") {
+		t.Errorf("unexpected description %q", s)
+	}
+
+	changes = couac.DiffPlans(a, explain("SELECT v FROM t WHERE v > 10 ORDER BY v"))
+	if len(changes) == 0 || changes[0].Kind != couac.PlanOperatorReplaced {
+		t.Errorf("expected the ORDER_BY to replace the root, got %v", changes)
+	}
+
+	old := &couac.Plan{Operators: []*couac.PlanNode{{Name: "UNION", Children: []*couac.PlanNode{{Name: "SEQ_SCAN"}}}}}
+	new := &couac.Plan{Operators: []*couac.PlanNode{{Name: "UNION", Children: []*couac.PlanNode{{Name: "SEQ_SCAN"}, {Name: "SEQ_SCAN"}}}}}
+	changes = couac.DiffPlans(old, new)
+	if len(changes) != 1 || changes[0].Kind != couac.PlanOperatorAdded || changes[0].Path != "UNION/SEQ_SCAN[1]" {
+		t.Errorf("unexpected changes %v", changes)
+	}
+	if changes = couac.DiffPlans(new, old); len(changes) != 1 || changes[0].String() != "removed UNION/SEQ_SCAN[1]" {
+		t.Errorf("unexpected changes %v", changes)
+	}
+}
@@ -0,0 +1,280 @@
+package couac
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/parquet"
+	"github.com/apache/arrow-go/v18/parquet/compress"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+)
+
+// Export writes the result of query to path with DuckDB's
+// COPY (query) TO and returns the number of rows exported.
+//
+// The format is [FormatParquet], [FormatCSV], [FormatJSON],
+// [FormatArrowIPC], or [FormatAuto] to detect it from the extension of
+// path. Options set the compression codec, Parquet row group size,
+// hive partitioning ([WithPartitionBy]), one file per thread
+// ([WithPerThreadOutput]), and whether an existing output directory may
+// be overwritten ([WithOverwrite]); other COPY options can be passed
+// with [WithCopyOption].
+//
+// Arrow IPC is written in Go with [QueryResult.WriteIPC], since DuckDB
+// has no built-in IPC writer; partitioning and per-thread output are
+// not supported for it, and an existing file is only replaced with
+// [WithOverwrite].
+//
+// Example:
+//
+//	n, err := conn.Export(ctx, "SELECT * FROM events WHERE day = current_date",
+//	    "out/events", couac.FormatParquet,
+//	    couac.WithPartitionBy("region"),
+//	    couac.WithCompression("zstd"),
+//	    couac.WithOverwrite())
+func (q *Conn) Export(ctx context.Context, query, path string, format FileFormat, opts ...ExportOption) (n int64, err error) {
+	if err := q.ensureConnOpen(); err != nil {
+		return 0, err
+	}
+	if path == "" {
+		return 0, errors.New("couac: empty export path")
+	}
+	cfg := &exportConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if format == FormatAuto {
+		if format, err = detectFileFormat(path); err != nil {
+			return 0, err
+		}
+	}
+	query = strings.TrimRight(strings.TrimSpace(query), ";")
+
+	if format == FormatArrowIPC {
+		return q.exportIPC(ctx, query, path, cfg, opts)
+	}
+
+	copyOpts, err := copyOptions(format, cfg)
+	if err != nil {
+		return 0, err
+	}
+	// Hooks see the exported query, as for Query, not the COPY statement.
+	ctx, query, _, after, err := q.parent.beforeStatement(ctx, hookQuery, "Export", query, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { after.run(n, err) }()
+	copyQuery := fmt.Sprintf("COPY (%s) TO %s (%s)", query, quoteString(path), strings.Join(copyOpts, ", "))
+
+	q.parent.rlock()
+	defer q.parent.mu.RUnlock()
+
+	n, err = q.countInternal(ctx, copyQuery)
+	if err != nil {
+		return n, fmt.Errorf("couac: export to %s: %w", path, err)
+	}
+	return n, nil
+}
+
+// copyOptions renders the option list of a COPY ... TO statement.
+func copyOptions(format FileFormat, cfg *exportConfig) ([]string, error) {
+	var opts []string
+	switch format {
+	case FormatParquet:
+		opts = append(opts, "FORMAT parquet")
+	case FormatCSV:
+		opts = append(opts, "FORMAT csv", "HEADER true")
+	case FormatJSON:
+		opts = append(opts, "FORMAT json")
+	default:
+		return nil, fmt.Errorf("%w: %d", ErrUnknownFileFormat, int(format))
+	}
+
+	if cfg.compression != "" {
+		opts = append(opts, "COMPRESSION "+quoteString(cfg.compression))
+	}
+	if cfg.rowGroupSize > 0 {
+		if format != FormatParquet {
+			return nil, errors.New("couac: row group size only applies to Parquet exports")
+		}
+		opts = append(opts, fmt.Sprintf("ROW_GROUP_SIZE %d", cfg.rowGroupSize))
+	}
+	if len(cfg.partitionBy) > 0 {
+		cols := make([]string, len(cfg.partitionBy))
+		for i, c := range cfg.partitionBy {
+			cols[i] = quoteIdentifier(c)
+		}
+		opts = append(opts, "PARTITION_BY ("+strings.Join(cols, ", ")+")")
+	}
+	if cfg.perThreadOutput {
+		opts = append(opts, "PER_THREAD_OUTPUT true")
+	}
+	if cfg.overwrite {
+		opts = append(opts, "OVERWRITE true")
+	}
+	for _, o := range cfg.copyOptions {
+		v, err := o.sqlValue()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, o.name+" "+v)
+	}
+	return opts, nil
+}
+
+// exportIPC writes the result of query to an Arrow IPC file at path.
+func (q *Conn) exportIPC(ctx context.Context, query, path string, cfg *exportConfig, opts []ExportOption) (int64, error) {
+	if len(cfg.partitionBy) > 0 || cfg.perThreadOutput {
+		return 0, errors.New("couac: partitioned and per-thread output are not supported for Arrow IPC exports")
+	}
+	res, err := q.Query(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Close()
+
+	// Without WithOverwrite an existing file is left untouched.
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if !cfg.overwrite {
+		flag = os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	}
+	f, err := os.OpenFile(path, flag, 0o666)
+	if err != nil {
+		return 0, fmt.Errorf("couac: export to %s: %w", path, err)
+	}
+	n, err := res.writeIPC(f, true, opts)
+	if cerr := f.Close(); err == nil && cerr != nil {
+		err = fmt.Errorf("couac: export to %s: %w", path, cerr)
+	}
+	return n, err
+}
+
+// WriteIPC streams the remaining record batches of the result to w in
+// the Arrow IPC stream format and returns the number of rows written.
+// It consumes the Reader. [WithCompression] ("zstd" or "lz4") compresses
+// the record batch buffers; other options are ignored.
+func (qr *QueryResult) WriteIPC(w io.Writer, opts ...ExportOption) (int64, error) {
+	return qr.writeIPC(w, false, opts)
+}
+
+// writeIPC writes the result as an Arrow IPC stream, or as an IPC file
+// (with footer) when file is true.
+func (qr *QueryResult) writeIPC(w io.Writer, file bool, opts []ExportOption) (int64, error) {
+	if qr.Reader == nil {
+		return 0, errors.New("couac: query result is closed")
+	}
+	cfg := &exportConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	ipcOpts := []ipc.Option{ipc.WithSchema(qr.Reader.Schema())}
+	switch strings.ToLower(cfg.compression) {
+	case "", "none", "uncompressed":
+	case "zstd":
+		ipcOpts = append(ipcOpts, ipc.WithZstd())
+	case "lz4", "lz4_frame":
+		ipcOpts = append(ipcOpts, ipc.WithLZ4())
+	default:
+		return 0, fmt.Errorf("couac: unsupported Arrow IPC compression %q", cfg.compression)
+	}
+
+	var iw interface {
+		Write(arrow.RecordBatch) error
+		Close() error
+	}
+	if file {
+		fw, err := ipc.NewFileWriter(w, ipcOpts...)
+		if err != nil {
+			return 0, fmt.Errorf("couac: ipc writer: %w", err)
+		}
+		iw = fw
+	} else {
+		iw = ipc.NewWriter(w, ipcOpts...)
+	}
+
+	var rows int64
+	for qr.Reader.Next() {
+		rec := qr.Reader.RecordBatch()
+		if err := iw.Write(rec); err != nil {
+			iw.Close()
+			return rows, fmt.Errorf("couac: write ipc: %w", err)
+		}
+		rows += rec.NumRows()
+	}
+	if err := qr.Reader.Err(); err != nil {
+		iw.Close()
+		return rows, fmt.Errorf("couac: read result: %w", err)
+	}
+	if err := iw.Close(); err != nil {
+		return rows, fmt.Errorf("couac: write ipc: %w", err)
+	}
+	return rows, nil
+}
+
+// WriteParquet streams the remaining record batches of the result to w
+// as a Parquet file and returns the number of rows written. It consumes
+// the Reader. [WithCompression] and [WithRowGroupSize] are honored;
+// other options are ignored.
+func (qr *QueryResult) WriteParquet(w io.Writer, opts ...ExportOption) (int64, error) {
+	if qr.Reader == nil {
+		return 0, errors.New("couac: query result is closed")
+	}
+	cfg := &exportConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	var props []parquet.WriterProperty
+	if cfg.compression != "" {
+		codec, ok := parquetCodecs[strings.ToLower(cfg.compression)]
+		if !ok {
+			return 0, fmt.Errorf("couac: unsupported Parquet compression %q", cfg.compression)
+		}
+		props = append(props, parquet.WithCompression(codec))
+	}
+	if cfg.rowGroupSize > 0 {
+		props = append(props, parquet.WithMaxRowGroupLength(int64(cfg.rowGroupSize)))
+	}
+
+	// Hide any Close method: the Parquet writer closes its sink, but w
+	// belongs to the caller.
+	sink := struct{ io.Writer }{w}
+	fw, err := pqarrow.NewFileWriter(qr.Reader.Schema(), sink, parquet.NewWriterProperties(props...), pqarrow.DefaultWriterProps())
+	if err != nil {
+		return 0, fmt.Errorf("couac: parquet writer: %w", err)
+	}
+	var rows int64
+	for qr.Reader.Next() {
+		rec := qr.Reader.RecordBatch()
+		if err := fw.WriteBuffered(rec); err != nil {
+			fw.Close()
+			return rows, fmt.Errorf("couac: write parquet: %w", err)
+		}
+		rows += rec.NumRows()
+	}
+	if err := qr.Reader.Err(); err != nil {
+		fw.Close()
+		return rows, fmt.Errorf("couac: read result: %w", err)
+	}
+	if err := fw.Close(); err != nil {
+		return rows, fmt.Errorf("couac: write parquet: %w", err)
+	}
+	return rows, nil
+}
+
+var parquetCodecs = map[string]compress.Compression{
+	"uncompressed": compress.Codecs.Uncompressed,
+	"none":         compress.Codecs.Uncompressed,
+	"snappy":       compress.Codecs.Snappy,
+	"gzip":         compress.Codecs.Gzip,
+	"brotli":       compress.Codecs.Brotli,
+	"zstd":         compress.Codecs.Zstd,
+	"lz4_raw":      compress.Codecs.Lz4Raw,
+	"lz4":          compress.Codecs.Lz4Raw,
+}
@@ -0,0 +1,162 @@
+package couac_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/parquet/file"
+	"github.com/loicalleyne/couac"
+)
+
+func TestExport_ParquetPartitioned(t *testing.T) {
+	_, conn := newTestConn(t)
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "out")
+
+	query := "SELECT range AS id, range % 2 AS part FROM range(10);"
+	n, err := conn.Export(ctx, query, dir, couac.FormatParquet,
+		couac.WithPartitionBy("part"), couac.WithCompression("zstd"), couac.WithRowGroupSize(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 10 {
+		t.Errorf("expected 10 rows exported, got %d", n)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "part=1")); err != nil {
+		t.Errorf("expected a part=1 partition directory: %v", err)
+	}
+
+	// A second export into the same directory needs WithOverwrite.
+	if _, err := conn.Export(ctx, query, dir, couac.FormatParquet, couac.WithPartitionBy("part")); err == nil {
+		t.Error("expected export into a non-empty directory to fail")
+	}
+	if _, err := conn.Export(ctx, query, dir, couac.FormatParquet, couac.WithPartitionBy("part"), couac.WithOverwrite()); err != nil {
+		t.Errorf("overwrite export: %v", err)
+	}
+
+	back, err := conn.IngestFile(ctx, "reloaded", filepath.Join(dir, "*", "*.parquet"), couac.WithHivePartitioning())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if back != 10 {
+		t.Errorf("expected 10 rows reloaded, got %d", back)
+	}
+}
+
+func TestExport_CSVAndIPC(t *testing.T) {
+	_, conn := newTestConn(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	csvPath := filepath.Join(dir, "rows.csv")
+	if _, err := conn.Export(ctx, "SELECT 1 AS a, 'x' AS b", csvPath, couac.FormatAuto); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(csvPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "a,b\n1,x\n" {
+		t.Errorf("unexpected CSV output: %q", data)
+	}
+
+	ipcPath := filepath.Join(dir, "rows.arrow")
+	n, err := conn.Export(ctx, "SELECT * FROM range(5)", ipcPath, couac.FormatAuto, couac.WithCompression("zstd"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 5 {
+		t.Errorf("expected 5 rows exported, got %d", n)
+	}
+	f, err := os.Open(ipcPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	fr, err := ipc.NewFileReader(f)
+	if err != nil {
+		t.Fatalf("expected an Arrow IPC file: %v", err)
+	}
+	defer fr.Close()
+	if fr.NumRecords() == 0 {
+		t.Error("expected at least one record batch")
+	}
+
+	if _, err := conn.Export(ctx, "SELECT 1", ipcPath, couac.FormatAuto); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("expected fs.ErrExist without WithOverwrite, got %v", err)
+	}
+	if n, err := conn.Export(ctx, "SELECT * FROM range(3)", ipcPath, couac.FormatAuto, couac.WithOverwrite()); err != nil || n != 3 {
+		t.Errorf("expected 3 rows exported with WithOverwrite, got %d, %v", n, err)
+	}
+}
+
+func TestQueryResult_WriteIPC(t *testing.T) {
+	_, conn := newTestConn(t)
+	ctx := context.Background()
+
+	res, err := conn.Query(ctx, "SELECT range AS id FROM range(100)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Close()
+
+	var buf bytes.Buffer
+	n, err := res.WriteIPC(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 100 {
+		t.Errorf("expected 100 rows written, got %d", n)
+	}
+
+	rdr, err := ipc.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rdr.Release()
+	var rows int64
+	for rdr.Next() {
+		rows += rdr.RecordBatch().NumRows()
+	}
+	if rows != 100 {
+		t.Errorf("expected 100 rows read back, got %d", rows)
+	}
+}
+
+func TestQueryResult_WriteParquet(t *testing.T) {
+	_, conn := newTestConn(t)
+	ctx := context.Background()
+
+	res, err := conn.Query(ctx, "SELECT range AS id, 'v' || range AS name FROM range(10)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Close()
+
+	var buf bytes.Buffer
+	n, err := res.WriteParquet(&buf, couac.WithCompression("snappy"), couac.WithRowGroupSize(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 10 {
+		t.Errorf("expected 10 rows written, got %d", n)
+	}
+
+	pf, err := file.NewParquetReader(bytes.NewReader(buf.Bytes()), file.WithReadProps(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pf.Close()
+	if pf.NumRows() != 10 {
+		t.Errorf("expected 10 rows in file, got %d", pf.NumRows())
+	}
+	if pf.NumRowGroups() != 4 {
+		t.Errorf("expected 4 row groups of at most 3 rows, got %d", pf.NumRowGroups())
+	}
+}
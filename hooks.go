@@ -0,0 +1,281 @@
+package couac
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/util"
+)
+
+// Hook observes and intercepts the work couac does on a [DB]. Hooks
+// are installed with [WithHooks] and run for:
+//   - Exec: [Conn.Exec], [Conn.ExecArgs], [Conn.ExecBatch],
+//     [Conn.ExecBatchRecord], and Exec calls through [DB.StdDB];
+//   - Query: [Conn.Query], [Conn.QueryArgs], [Conn.QueryRaw], Query
+//     calls through [DB.StdDB], and [Conn.Export], whose event holds
+//     the exported query rather than the COPY statement that runs it;
+//   - Ingest: [Conn.Ingest], [Conn.IngestMerge], [Conn.IngestMergePolicy],
+//     [Conn.IngestReplace], [Conn.IngestUpsert], [Conn.IngestStream],
+//     [Conn.IngestBatch] (once per entry), and [Conn.IngestFile];
+//   - Maintenance: [DB.Compact], [DB.Checkpoint], and [DB.ForceCheckpoint].
+//
+// Helpers built on these methods, such as [Conn.Set] or [QueryAs], run
+// the hooks of the method they call, with the SQL they pass to it:
+// [Conn.Profile] runs the Query hooks on the profiled query, while
+// [Conn.ExplainPlan] runs them on the EXPLAIN statement wrapping the
+// user's query, so hooks that match SQL must allow for that prefix.
+// Statements couac issues internally, such as BEGIN and COMMIT, and
+// the settings Profile changes, do not.
+//
+// A Before method may rewrite the statement by changing the SQL, Args,
+// Table, or Path of the event, and may return a derived context that
+// is used for the rest of the call (except by [Conn.IngestBatch], whose
+// entries share one call). Returning an error rejects the
+// call, which then fails with an error matching [ErrRejected] and the
+// hook's error. The After method of every hook whose Before method ran
+// is called once the call completes, including when a later hook
+// rejected it; Before methods run in the order the hooks were given
+// and After methods in reverse order.
+//
+// For queries, AfterQuery runs when the [QueryResult] (or database/sql
+// Rows) is closed, with Rows set to the number of rows read, so that
+// Duration covers the consumption of the result. [Conn.QueryRaw] hands
+// its reader to the caller and calls AfterQuery as soon as the query
+// has executed.
+//
+// Hooks are called concurrently from every connection of the DB and
+// must be safe for concurrent use. Embed [NopHook] to implement only
+// some of the methods.
+type Hook interface {
+	BeforeExec(ctx context.Context, ev *HookEvent) (context.Context, error)
+	AfterExec(ctx context.Context, ev *HookEvent)
+	BeforeQuery(ctx context.Context, ev *HookEvent) (context.Context, error)
+	AfterQuery(ctx context.Context, ev *HookEvent)
+	BeforeIngest(ctx context.Context, ev *HookEvent) (context.Context, error)
+	AfterIngest(ctx context.Context, ev *HookEvent)
+	// OnMaintenance is called twice per maintenance operation: before
+	// it starts, with Done false, where returning an error rejects it;
+	// and once it completes, with Done true, where the returned error
+	// is ignored.
+	OnMaintenance(ctx context.Context, ev *HookEvent) error
+}
+
+// HookEvent describes the call a [Hook] is invoked for. The same event
+// is passed to the Before and After methods of a call.
+type HookEvent struct {
+	// Op names the method that was called, such as "Exec", "QueryArgs",
+	// "IngestMerge", "StdDB.Query", or "Compact".
+	Op string
+	// SQL is the statement of Exec and Query calls.
+	SQL string
+	// Args holds the parameters bound to SQL, if any. For
+	// [Conn.ExecBatch] it holds one []any per parameter row.
+	Args []any
+	// Table is the destination table of an ingest.
+	Table string
+	// Mode is the mode of an ingest: "append", "merge", "replace", or
+	// "upsert".
+	Mode string
+	// Path is the file or glob read by [Conn.IngestFile].
+	Path string
+	// Rows is the number of rows affected, read, or ingested, or -1 if
+	// unknown. Before an ingest it holds the number of rows in the
+	// record batch, and before [Conn.ExecBatch] or
+	// [Conn.ExecBatchRecord] the number of parameter rows.
+	Rows int64
+	// Bytes is the size of the record batch of an ingest, or -1 if
+	// unknown. For [Conn.IngestStream] it is set after the stream has
+	// been read.
+	Bytes int64
+	// Start is the time the call started.
+	Start time.Time
+	// Duration is the time the call took. It is set for After methods.
+	Duration time.Duration
+	// Err is the error the call failed with. It is set for After
+	// methods.
+	Err error
+	// Done reports whether a maintenance operation has completed.
+	Done bool
+}
+
+// NopHook implements [Hook] with methods that do nothing. Embed it in
+// a hook that only needs some of the methods.
+type NopHook struct{}
+
+func (NopHook) BeforeExec(ctx context.Context, _ *HookEvent) (context.Context, error) {
+	return ctx, nil
+}
+
+func (NopHook) AfterExec(context.Context, *HookEvent) {}
+
+func (NopHook) BeforeQuery(ctx context.Context, _ *HookEvent) (context.Context, error) {
+	return ctx, nil
+}
+
+func (NopHook) AfterQuery(context.Context, *HookEvent) {}
+
+func (NopHook) BeforeIngest(ctx context.Context, _ *HookEvent) (context.Context, error) {
+	return ctx, nil
+}
+
+func (NopHook) AfterIngest(context.Context, *HookEvent) {}
+
+func (NopHook) OnMaintenance(context.Context, *HookEvent) error { return nil }
+
+// hookKind selects the Before and After methods of a [Hook].
+type hookKind int
+
+const (
+	hookExec hookKind = iota
+	hookQuery
+	hookIngest
+)
+
+// afterFunc runs the After hooks of a call with its outcome. A nil
+// afterFunc, returned when the DB has no hooks, does nothing.
+type afterFunc func(rows int64, err error)
+
+func (f afterFunc) run(rows int64, err error) {
+	if f != nil {
+		f(rows, err)
+	}
+}
+
+// runHooks runs the Before hooks of kind for ev and returns the
+// context to use for the call and the function that runs the After
+// hooks. If a hook rejects the call, the After hooks that are due are
+// run and the rejection is returned.
+func (q *DB) runHooks(ctx context.Context, kind hookKind, ev *HookEvent) (context.Context, afterFunc, error) {
+	if !q.instrumented() {
+		return ctx, nil, nil
+	}
+	ev.Start = time.Now()
+	ctx, span := q.startOpSpan(ctx, ev)
+	ran := 0
+	after := func(rows int64, err error) {
+		if kind == hookIngest && rows <= 0 && err == nil {
+			// DuckDB does not report the rows of bulk ingests.
+			rows = max(rows, ev.Rows)
+		}
+		ev.Rows, ev.Err, ev.Duration = rows, err, time.Since(ev.Start)
+		if q.metrics != nil {
+			q.metrics.observe(kind, ev)
+		}
+		for i := ran - 1; i >= 0; i-- {
+			switch h := q.hooks[i]; kind {
+			case hookExec:
+				h.AfterExec(ctx, ev)
+			case hookQuery:
+				h.AfterQuery(ctx, ev)
+			case hookIngest:
+				h.AfterIngest(ctx, ev)
+			}
+		}
+		q.endOpSpan(span, ev)
+	}
+	for _, h := range q.hooks {
+		var (
+			hctx context.Context
+			err  error
+		)
+		switch kind {
+		case hookExec:
+			hctx, err = h.BeforeExec(ctx, ev)
+		case hookQuery:
+			hctx, err = h.BeforeQuery(ctx, ev)
+		case hookIngest:
+			hctx, err = h.BeforeIngest(ctx, ev)
+		}
+		if hctx != nil {
+			ctx = hctx
+		}
+		if err != nil {
+			err = fmt.Errorf("%w: %s: %w", ErrRejected, ev.Op, err)
+			after(-1, err)
+			return ctx, nil, err
+		}
+		ran++
+	}
+	return ctx, after, nil
+}
+
+// beforeStatement runs the Before hooks of kind for a SQL statement and
+// returns the context, statement, and arguments to run it with.
+func (q *DB) beforeStatement(ctx context.Context, kind hookKind, op, query string, args []any) (context.Context, string, []any, afterFunc, error) {
+	if !q.instrumented() {
+		return ctx, query, args, nil, nil
+	}
+	ev := &HookEvent{Op: op, SQL: query, Args: args, Rows: -1}
+	ctx, after, err := q.runHooks(ctx, kind, ev)
+	return ctx, ev.SQL, ev.Args, after, err
+}
+
+// beforeBatch runs the BeforeExec hooks for a batch of n parameter
+// rows, held in args for ExecBatch, and returns the context, statement
+// and parameter rows to use.
+func (q *DB) beforeBatch(ctx context.Context, op, query string, n int, args []any) (context.Context, string, []any, afterFunc, error) {
+	if !q.instrumented() {
+		return ctx, query, args, nil, nil
+	}
+	ev := &HookEvent{Op: op, SQL: query, Args: args, Rows: int64(n)}
+	ctx, after, err := q.runHooks(ctx, hookExec, ev)
+	return ctx, ev.SQL, ev.Args, after, err
+}
+
+// beforeIngest runs the BeforeIngest hooks for an ingest of rec into
+// table with mode and returns the context and destination to use.
+func (q *DB) beforeIngest(ctx context.Context, op, mode, table string, rec arrow.RecordBatch) (context.Context, string, afterFunc, error) {
+	if !q.instrumented() {
+		return ctx, table, nil, nil
+	}
+	ev := &HookEvent{Op: op, Table: table, Mode: mode, Rows: rec.NumRows(), Bytes: util.TotalRecordSize(rec)}
+	ctx, after, err := q.runHooks(ctx, hookIngest, ev)
+	return ctx, ev.Table, after, err
+}
+
+// beforeMaintenance calls OnMaintenance before the maintenance
+// operation op and returns the context to run it with and the function
+// to call with its outcome.
+func (q *DB) beforeMaintenance(ctx context.Context, op string) (context.Context, func(error), error) {
+	if !q.instrumented() {
+		return ctx, func(error) {}, nil
+	}
+	ev := &HookEvent{Op: op, Rows: -1, Bytes: -1, Start: time.Now()}
+	ctx, span := q.startOpSpan(ctx, ev)
+	ran := 0
+	done := func(err error) {
+		ev.Err, ev.Duration, ev.Done = err, time.Since(ev.Start), true
+		if q.metrics != nil {
+			q.metrics.maintenance.observe(ev)
+		}
+		for i := ran - 1; i >= 0; i-- {
+			q.hooks[i].OnMaintenance(ctx, ev)
+		}
+		q.endOpSpan(span, ev)
+	}
+	for _, h := range q.hooks {
+		if err := h.OnMaintenance(ctx, ev); err != nil {
+			err = fmt.Errorf("%w: %s: %w", ErrRejected, op, err)
+			done(err)
+			return ctx, nil, err
+		}
+		ran++
+	}
+	return ctx, done, nil
+}
+
+// hookArgs returns the values of database/sql arguments for a
+// [HookEvent].
+func hookArgs(nvs []driver.NamedValue) []any {
+	if len(nvs) == 0 {
+		return nil
+	}
+	args := make([]any, len(nvs))
+	for i, nv := range nvs {
+		args[i] = nv.Value
+	}
+	return args
+}
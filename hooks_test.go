@@ -0,0 +1,323 @@
+package couac_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/loicalleyne/couac"
+)
+
+// recordHook records the events it sees as "<method> <op>" entries.
+type recordHook struct {
+	couac.NopHook
+	mu     sync.Mutex
+	calls  []string
+	events []couac.HookEvent
+}
+
+func (h *recordHook) record(method string, ev *couac.HookEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.calls = append(h.calls, method+" "+ev.Op)
+	h.events = append(h.events, *ev)
+}
+
+func (h *recordHook) BeforeExec(ctx context.Context, ev *couac.HookEvent) (context.Context, error) {
+	h.record("BeforeExec", ev)
+	return ctx, nil
+}
+
+func (h *recordHook) AfterExec(_ context.Context, ev *couac.HookEvent) { h.record("AfterExec", ev) }
+
+func (h *recordHook) BeforeQuery(ctx context.Context, ev *couac.HookEvent) (context.Context, error) {
+	h.record("BeforeQuery", ev)
+	return ctx, nil
+}
+
+func (h *recordHook) AfterQuery(_ context.Context, ev *couac.HookEvent) { h.record("AfterQuery", ev) }
+
+func (h *recordHook) BeforeIngest(ctx context.Context, ev *couac.HookEvent) (context.Context, error) {
+	h.record("BeforeIngest", ev)
+	return ctx, nil
+}
+
+func (h *recordHook) AfterIngest(_ context.Context, ev *couac.HookEvent) { h.record("AfterIngest", ev) }
+
+func (h *recordHook) OnMaintenance(_ context.Context, ev *couac.HookEvent) error {
+	h.record("OnMaintenance", ev)
+	return nil
+}
+
+// last returns the last recorded event.
+func (h *recordHook) last() couac.HookEvent {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.events[len(h.events)-1]
+}
+
+func (h *recordHook) reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.calls, h.events = nil, nil
+}
+
+// tenantHook rejects statements on the secrets table and moves ingests
+// into a tenant-prefixed table.
+type tenantHook struct {
+	couac.NopHook
+}
+
+var errForbidden = errors.New("forbidden table")
+
+func (tenantHook) BeforeExec(ctx context.Context, ev *couac.HookEvent) (context.Context, error) {
+	if strings.Contains(ev.SQL, "secrets") {
+		return ctx, errForbidden
+	}
+	return ctx, nil
+}
+
+func (tenantHook) BeforeQuery(ctx context.Context, ev *couac.HookEvent) (context.Context, error) {
+	ev.SQL = strings.ReplaceAll(ev.SQL, "{tenant}", "'acme'")
+	return ctx, nil
+}
+
+func (tenantHook) BeforeIngest(ctx context.Context, ev *couac.HookEvent) (context.Context, error) {
+	ev.Table = "acme_" + ev.Table
+	return ctx, nil
+}
+
+func TestHooks_ExecAndQuery(t *testing.T) {
+	rec := &recordHook{}
+	db := newTestDB(t, couac.WithHooks(rec))
+	conn, err := db.Connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ctx := context.Background()
+
+	if _, err := conn.Exec(ctx, "CREATE TABLE t AS SELECT * FROM range(10)"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(rec.calls, ", "), "BeforeExec Exec, AfterExec Exec"; got != want {
+		t.Errorf("calls = %q, want %q", got, want)
+	}
+	if ev := rec.last(); ev.SQL != "CREATE TABLE t AS SELECT * FROM range(10)" || ev.Err != nil || ev.Duration <= 0 {
+		t.Errorf("unexpected AfterExec event %+v", ev)
+	}
+
+	rec.reset()
+	res, err := conn.QueryArgs(ctx, "SELECT * FROM t WHERE range < ?", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.calls) != 1 {
+		t.Errorf("expected AfterQuery to wait for Close, got %v", rec.calls)
+	}
+	for res.Reader.Next() {
+	}
+	res.Close()
+	res.Close()
+	if got, want := strings.Join(rec.calls, ", "), "BeforeQuery QueryArgs, AfterQuery QueryArgs"; got != want {
+		t.Errorf("calls = %q, want %q", got, want)
+	}
+	if ev := rec.last(); ev.Rows != 4 || len(ev.Args) != 1 {
+		t.Errorf("expected 4 rows read and 1 argument, got %+v", ev)
+	}
+
+	rec.reset()
+	if _, err := conn.Query(ctx, "SELECT * FROM missing"); err == nil {
+		t.Fatal("expected query on a missing table to fail")
+	}
+	if ev := rec.last(); !errors.Is(ev.Err, couac.ErrCatalog) {
+		t.Errorf("expected AfterQuery to see the catalog error, got %v", ev.Err)
+	}
+}
+
+// firstRowHook keeps only the first parameter row of ExecBatch calls.
+type firstRowHook struct {
+	couac.NopHook
+}
+
+func (firstRowHook) BeforeExec(ctx context.Context, ev *couac.HookEvent) (context.Context, error) {
+	if ev.Op == "ExecBatch" {
+		ev.Args = ev.Args[:1]
+	}
+	return ctx, nil
+}
+
+func TestHooks_ExecBatch(t *testing.T) {
+	rec := &recordHook{}
+	db := newTestDB(t, couac.WithHooks(rec, firstRowHook{}))
+	conn, err := db.Connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ctx := context.Background()
+
+	if _, err := conn.Exec(ctx, "CREATE TABLE kv (k VARCHAR, v INTEGER)"); err != nil {
+		t.Fatal(err)
+	}
+	rec.reset()
+	res, err := conn.ExecBatch(ctx, "INSERT INTO kv VALUES (?, ?)", [][]any{{"a", 1}, {"b", 2}, {"c", 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := rec.events[0]
+	if before.Rows != 3 || len(before.Args) != 3 {
+		t.Errorf("expected BeforeExec to see 3 parameter rows, got %+v", before)
+	}
+	if row, ok := before.Args[1].([]any); !ok || len(row) != 2 || row[0] != "b" {
+		t.Errorf("expected the second parameter row, got %#v", before.Args[1])
+	}
+	if len(res.RowsAffected) != 1 || tableCount(t, conn, "kv") != 1 {
+		t.Errorf("expected the rewritten batch of 1 row, got %+v", res)
+	}
+}
+
+func TestHooks_RejectAndRewrite(t *testing.T) {
+	rec := &recordHook{}
+	db := newTestDB(t, couac.WithHooks(rec, tenantHook{}))
+	conn, err := db.Connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ctx := context.Background()
+
+	_, err = conn.Exec(ctx, "CREATE TABLE secrets (s TEXT)")
+	if !errors.Is(err, couac.ErrRejected) || !errors.Is(err, errForbidden) {
+		t.Fatalf("expected rejection, got %v", err)
+	}
+	if ev := rec.last(); !errors.Is(ev.Err, couac.ErrRejected) {
+		t.Errorf("expected the outer hook's AfterExec to see the rejection, got %+v", ev)
+	}
+
+	rows, err := couac.QueryAs[string](ctx, conn, "SELECT {tenant}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows[0] != "acme" {
+		t.Errorf("expected rewritten query to return acme, got %q", rows[0])
+	}
+
+	r := makeTestRecord(t, 3)
+	defer r.Release()
+	if _, err := conn.Ingest(ctx, "events", r); err != nil {
+		t.Fatal(err)
+	}
+	if ev := rec.last(); ev.Op != "Ingest" || ev.Table != "acme_events" {
+		t.Errorf("unexpected AfterIngest event %+v", ev)
+	}
+	if n := tableCount(t, conn, "acme_events"); n != 3 {
+		t.Errorf("expected ingest into acme_events, got %d rows", n)
+	}
+}
+
+// readGuard rejects queries that read the secrets table.
+type readGuard struct {
+	couac.NopHook
+}
+
+func (readGuard) BeforeQuery(ctx context.Context, ev *couac.HookEvent) (context.Context, error) {
+	if strings.Contains(ev.SQL, "secrets") {
+		return ctx, errForbidden
+	}
+	return ctx, nil
+}
+
+func TestHooks_Export(t *testing.T) {
+	rec := &recordHook{}
+	db := newTestDB(t, couac.WithHooks(rec, readGuard{}, tenantHook{}))
+	conn, err := db.Connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	_, err = conn.Export(ctx, "SELECT * FROM secrets", filepath.Join(dir, "s.csv"), couac.FormatCSV)
+	if !errors.Is(err, couac.ErrRejected) || !errors.Is(err, errForbidden) {
+		t.Fatalf("expected rejection, got %v", err)
+	}
+
+	rec.reset()
+	n, err := conn.Export(ctx, "SELECT {tenant} AS t", filepath.Join(dir, "t.csv"), couac.FormatCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 exported row, got %d", n)
+	}
+	if ev := rec.last(); ev.Op != "Export" || ev.SQL != "SELECT 'acme' AS t" || ev.Rows != 1 {
+		t.Errorf("unexpected AfterQuery event %+v", ev)
+	}
+}
+
+func TestHooks_IngestBatchAndMaintenance(t *testing.T) {
+	rec := &recordHook{}
+	db := newTestDB(t, couac.WithHooks(rec))
+	conn, err := db.Connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ctx := context.Background()
+
+	a, b := makeTestRecord(t, 2), makeTestRecord(t, 5)
+	defer a.Release()
+	defer b.Release()
+	if _, err := conn.IngestBatch(ctx, []couac.IngestEntry{
+		{Table: "a", Record: a},
+		{Table: "b", Record: b, Mode: couac.IngestModeMerge},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	want := "BeforeIngest IngestBatch, BeforeIngest IngestBatch, AfterIngest IngestBatch, AfterIngest IngestBatch"
+	if got := strings.Join(rec.calls, ", "); got != want {
+		t.Errorf("calls = %q, want %q", got, want)
+	}
+	if ev := rec.last(); ev.Table != "b" || ev.Rows != 5 {
+		t.Errorf("unexpected AfterIngest event %+v", ev)
+	}
+
+	rec.reset()
+	if err := db.Checkpoint(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(rec.calls, ", "), "OnMaintenance Checkpoint, OnMaintenance Checkpoint"; got != want {
+		t.Errorf("calls = %q, want %q", got, want)
+	}
+	if ev := rec.last(); !ev.Done || ev.Err != nil {
+		t.Errorf("unexpected completion event %+v", ev)
+	}
+}
+
+func TestHooks_StdDB(t *testing.T) {
+	rec := &recordHook{}
+	db := newTestDB(t, couac.WithHooks(rec, tenantHook{}))
+	sqlDB := db.StdDB()
+	defer sqlDB.Close()
+	ctx := context.Background()
+
+	if _, err := sqlDB.ExecContext(ctx, "CREATE TABLE secrets (s TEXT)"); !errors.Is(err, couac.ErrRejected) {
+		t.Fatalf("expected rejection, got %v", err)
+	}
+
+	var tenant string
+	if err := sqlDB.QueryRowContext(ctx, "SELECT {tenant} WHERE ? > 0", 1).Scan(&tenant); err != nil {
+		t.Fatal(err)
+	}
+	if tenant != "acme" {
+		t.Errorf("expected rewritten query to return acme, got %q", tenant)
+	}
+	if ev := rec.last(); ev.Op != "StdDB.Query" || ev.Rows != 1 || len(ev.Args) != 1 {
+		t.Errorf("unexpected AfterQuery event %+v", ev)
+	}
+}
@@ -3,7 +3,8 @@ package couac
 import (
 	"context"
 	"fmt"
-	"time"
+	"slices"
+	"strings"
 
 	"github.com/apache/arrow-adbc/go/adbc"
 	"github.com/apache/arrow-go/v18/arrow"
@@ -22,8 +23,8 @@ import (
 //
 // The connection's Catalog and DBSchema are used as the target catalog
 // and schema if set.
-func (q *Conn) Ingest(ctx context.Context, destTable string, rec arrow.RecordBatch) (int64, error) {
-	if err := q.ensureConnOpen(); err != nil {
+func (q *Conn) Ingest(ctx context.Context, destTable string, rec arrow.RecordBatch) (n int64, err error) {
+	if err := q.ensureWritable(); err != nil {
 		return 0, err
 	}
 	if destTable == "" {
@@ -32,8 +33,13 @@ func (q *Conn) Ingest(ctx context.Context, destTable string, rec arrow.RecordBat
 	if rec == nil {
 		return 0, ErrNilRecord
 	}
+	ctx, destTable, after, err := q.parent.beforeIngest(ctx, "Ingest", "append", destTable, rec)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { after.run(n, err) }()
 
-	q.parent.mu.RLock()
+	q.parent.rlock()
 	defer q.parent.mu.RUnlock()
 
 	// Probe for existing table
@@ -61,9 +67,9 @@ func (q *Conn) Ingest(ctx context.Context, destTable string, rec arrow.RecordBat
 	if err := stmt.Bind(ctx, rec); err != nil {
 		return 0, fmt.Errorf("couac: bind record: %w", err)
 	}
-	n, err := stmt.ExecuteUpdate(ctx)
+	n, err = executeUpdate(ctx, stmt)
 	if err != nil {
-		return n, fmt.Errorf("couac: execute ingest: %w", err)
+		return n, fmt.Errorf("couac: execute ingest: %w", q.sqlError(err, ""))
 	}
 	return n, nil
 }
@@ -76,18 +82,40 @@ func (q *Conn) IngestCreateAppend(ctx context.Context, destTable string, rec arr
 }
 
 // IngestMerge ingests an Arrow record batch with automatic schema
-// evolution. If the target table does not exist, it is created. If the
-// table exists and the record's schema matches, data is appended. If
-// the schemas differ, the record is ingested into a temporary merge
-// table and then merged into the target using UNION BY NAME, which
-// adds any new columns.
+// evolution. If the target table does not exist, it is created. If it
+// exists, new columns are added and columns are widened in place as
+// needed, columns missing from the record are filled with NULL, and the
+// data is appended. A column whose record type is of another kind than
+// the table's (e.g. DOUBLE or VARCHAR for an INTEGER column) is changed
+// to the type both coerce to, as in earlier versions, which rewrites
+// that column.
 //
-// It returns the number of rows affected if known, otherwise -1.
+// It is equivalent to [Conn.IngestMergePolicy] with
+// [DefaultSchemaPolicy]. It returns the number of rows affected if
+// known, otherwise -1.
 //
 // This is useful when the schema of incoming data may evolve over time
 // (e.g. new fields added to a protobuf message).
 func (q *Conn) IngestMerge(ctx context.Context, destTable string, rec arrow.RecordBatch) (int64, error) {
-	if err := q.ensureConnOpen(); err != nil {
+	n, _, err := q.ingestMerge(ctx, "IngestMerge", destTable, rec, DefaultSchemaPolicy)
+	return n, err
+}
+
+// IngestCreateAppendMerge is a backward-compatible alias for [Conn.IngestMerge].
+//
+// Deprecated: Use [Conn.IngestMerge] instead.
+func (q *Conn) IngestCreateAppendMerge(ctx context.Context, destTable string, rec arrow.RecordBatch) (int64, error) {
+	return q.IngestMerge(ctx, destTable, rec)
+}
+
+// IngestReplace ingests an Arrow record batch, replacing the target table
+// entirely (DROP + CREATE). It returns the number of rows affected
+// if known, otherwise -1.
+//
+// This uses ADBC's Replace ingest mode, which is supported since
+// ADBC 1.1.0 / DuckDB 0.9.0+.
+func (q *Conn) IngestReplace(ctx context.Context, destTable string, rec arrow.RecordBatch) (n int64, err error) {
+	if err := q.ensureWritable(); err != nil {
 		return 0, err
 	}
 	if destTable == "" {
@@ -96,26 +124,14 @@ func (q *Conn) IngestMerge(ctx context.Context, destTable string, rec arrow.Reco
 	if rec == nil {
 		return 0, ErrNilRecord
 	}
-
-	q.parent.mu.RLock()
-	defer q.parent.mu.RUnlock()
-
-	mergeTable := destTable + "mergetmp"
-	quotedDest := quoteIdentifier(destTable)
-	quotedMerge := quoteIdentifier(mergeTable)
-
-	// Clean up any leftover merge table from a previous failed operation.
-	mergeSchema, _ := q.conn.GetTableSchema(ctx, q.catalogPtr(), q.dbSchemaPtr(), mergeTable)
-	if mergeSchema != nil {
-		mergeQuery := fmt.Sprintf(`CREATE OR REPLACE TABLE %s AS SELECT * FROM %s UNION BY NAME SELECT * FROM %s`,
-			quotedDest, quotedDest, quotedMerge)
-		q.execInternal(ctx, mergeQuery)
-		q.dropTableRetry(ctx, quotedMerge, mergeTable)
+	ctx, destTable, after, err := q.parent.beforeIngest(ctx, "IngestReplace", "replace", destTable, rec)
+	if err != nil {
+		return 0, err
 	}
+	defer func() { after.run(n, err) }()
 
-	// Probe for existing table
-	schema, _ := q.conn.GetTableSchema(ctx, q.catalogPtr(), q.dbSchemaPtr(), destTable)
-	schemaMismatch := schema != nil && schema.String() != rec.Schema().String()
+	q.parent.rlock()
+	defer q.parent.mu.RUnlock()
 
 	stmt, err := q.conn.NewStatement()
 	if err != nil {
@@ -123,71 +139,48 @@ func (q *Conn) IngestMerge(ctx context.Context, destTable string, rec arrow.Reco
 	}
 	defer stmt.Close()
 
-	// Choose ingest mode and target table
-	if schema == nil || schemaMismatch {
-		if err := stmt.SetOption(adbc.OptionKeyIngestMode, adbc.OptionValueIngestModeCreate); err != nil {
-			return 0, fmt.Errorf("couac: set ingest mode create: %w", err)
-		}
-	} else {
-		if err := stmt.SetOption(adbc.OptionKeyIngestMode, adbc.OptionValueIngestModeAppend); err != nil {
-			return 0, fmt.Errorf("couac: set ingest mode append: %w", err)
-		}
-	}
-
-	targetTable := destTable
-	if schemaMismatch {
-		targetTable = mergeTable
+	if err := stmt.SetOption(adbc.OptionKeyIngestMode, adbc.OptionValueIngestModeReplace); err != nil {
+		return 0, fmt.Errorf("couac: set ingest mode replace: %w", err)
 	}
-
-	if err := stmt.SetOption(adbc.OptionKeyIngestTargetTable, targetTable); err != nil {
+	if err := stmt.SetOption(adbc.OptionKeyIngestTargetTable, destTable); err != nil {
 		return 0, fmt.Errorf("couac: set target table: %w", err)
 	}
 	if err := stmt.Bind(ctx, rec); err != nil {
 		return 0, fmt.Errorf("couac: bind record: %w", err)
 	}
-	n, err := stmt.ExecuteUpdate(ctx)
+	n, err = executeUpdate(ctx, stmt)
 	if err != nil {
-		return n, fmt.Errorf("couac: execute ingest: %w", err)
-	}
-
-	// Merge if schema mismatch
-	if schemaMismatch {
-		mergeQuery := fmt.Sprintf(`CREATE OR REPLACE TABLE %s AS
-		SELECT * FROM %s
-		UNION BY NAME
-		SELECT * FROM %s`, quotedDest, quotedDest, quotedMerge)
-
-		var mergeErr error
-		for range 3 {
-			_, mergeErr = q.execInternal(ctx, mergeQuery)
-			if mergeErr == nil {
-				break
-			}
-			time.Sleep(10 * time.Millisecond)
-		}
-		if mergeErr != nil {
-			return 0, fmt.Errorf("couac: merge into %s: %w", destTable, mergeErr)
-		}
-		q.dropTableRetry(ctx, quotedMerge, mergeTable)
+		return n, fmt.Errorf("couac: execute ingest: %w", q.sqlError(err, ""))
 	}
 	return n, nil
 }
 
-// IngestCreateAppendMerge is a backward-compatible alias for [Conn.IngestMerge].
+// IngestUpsert ingests an Arrow record batch and merges it into the
+// target table by key: rows whose key columns match an existing row
+// update it, and all other rows are inserted. If the target table does
+// not exist, it is created from the batch.
 //
-// Deprecated: Use [Conn.IngestMerge] instead.
-func (q *Conn) IngestCreateAppendMerge(ctx context.Context, destTable string, rec arrow.RecordBatch) (int64, error) {
-	return q.IngestMerge(ctx, destTable, rec)
-}
-
-// IngestReplace ingests an Arrow record batch, replacing the target table
-// entirely (DROP + CREATE). It returns the number of rows affected
-// if known, otherwise -1.
+// The batch is first ingested into a uniquely named TEMPORARY staging
+// table, private to the connection, which is then applied with DuckDB's
+// MERGE INTO (DuckDB v1.4+), so the target does not need a PRIMARY KEY
+// or UNIQUE constraint. Upserts into the same table from different
+// connections of the [DB] are serialized. When the batch contains
+// several rows for the same key, the last one wins — or, with
+// [WithVersionColumn], the one with the highest version. Use
+// [WithDeleteMarker] to turn flagged rows into deletions, e.g. when
+// replaying a CDC feed.
 //
-// This uses ADBC's Replace ingest mode, which is supported since
-// ADBC 1.1.0 / DuckDB 0.9.0+.
-func (q *Conn) IngestReplace(ctx context.Context, destTable string, rec arrow.RecordBatch) (int64, error) {
-	if err := q.ensureConnOpen(); err != nil {
+// Every column of the batch must already exist in the target table;
+// use [Conn.IngestMerge] first to evolve the schema. It returns the
+// number of rows affected if known, otherwise -1.
+//
+// Example:
+//
+//	n, err := conn.IngestUpsert(ctx, "customers", rec, []string{"id"},
+//	    couac.WithVersionColumn("updated_at"),
+//	    couac.WithDeleteMarker("_deleted"))
+func (q *Conn) IngestUpsert(ctx context.Context, destTable string, rec arrow.RecordBatch, keyColumns []string, opts ...UpsertOption) (n int64, err error) {
+	if err := q.ensureWritable(); err != nil {
 		return 0, err
 	}
 	if destTable == "" {
@@ -196,28 +189,157 @@ func (q *Conn) IngestReplace(ctx context.Context, destTable string, rec arrow.Re
 	if rec == nil {
 		return 0, ErrNilRecord
 	}
+	if len(keyColumns) == 0 {
+		return 0, ErrNoKeyColumns
+	}
+
+	cfg := &upsertConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	for _, col := range append(slices.Clone(keyColumns), cfg.versionColumn, cfg.deleteMarker) {
+		if col != "" && len(rec.Schema().FieldIndices(col)) == 0 {
+			return 0, fmt.Errorf("couac: upsert column %q not in record schema", col)
+		}
+	}
+	ctx, destTable, after, err := q.parent.beforeIngest(ctx, "IngestUpsert", "upsert", destTable, rec)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { after.run(n, err) }()
 
-	q.parent.mu.RLock()
+	q.parent.rlock()
 	defer q.parent.mu.RUnlock()
+	unlock, err := q.lockTable(ctx, destTable)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	stagingTable := newStagingTable(destTable)
+	quotedDest := quoteIdentifier(destTable)
+	quotedStaging := "temp.main." + quoteIdentifier(stagingTable)
+
+	if _, err := q.ingestStaging(ctx, stagingTable, rec); err != nil {
+		return 0, err
+	}
+	defer q.execInternal(context.WithoutCancel(ctx), "DROP TABLE IF EXISTS "+quotedStaging)
+
+	// Data columns are written to the target; the delete marker is not.
+	var cols []string
+	for _, f := range rec.Schema().Fields() {
+		if f.Name != cfg.deleteMarker {
+			cols = append(cols, f.Name)
+		}
+	}
+	quoteAll := func(prefix string, names []string) string {
+		quoted := make([]string, len(names))
+		for i, n := range names {
+			quoted[i] = prefix + quoteIdentifier(n)
+		}
+		return strings.Join(quoted, ", ")
+	}
+
+	// Keep one row per key: the highest version, then the last staged row.
+	order := "rowid DESC"
+	if cfg.versionColumn != "" {
+		order = quoteIdentifier(cfg.versionColumn) + " DESC NULLS LAST, " + order
+	}
+	source := fmt.Sprintf(`SELECT * EXCLUDE (_couac_rn) FROM (
+		SELECT *, row_number() OVER (PARTITION BY %s ORDER BY %s) AS _couac_rn FROM %s
+	) WHERE _couac_rn = 1`, quoteAll("", keyColumns), order, quotedStaging)
+
+	notDeleted := "TRUE"
+	if cfg.deleteMarker != "" {
+		notDeleted = "s." + quoteIdentifier(cfg.deleteMarker) + " IS NOT TRUE"
+	}
+
+	schema, _ := q.conn.GetTableSchema(ctx, q.catalogPtr(), q.dbSchemaPtr(), destTable)
+	if schema == nil {
+		createQuery := fmt.Sprintf(`CREATE TABLE %s AS SELECT %s FROM (%s) AS s WHERE %s`,
+			quotedDest, quoteAll("s.", cols), source, notDeleted)
+		n, err = q.execInternal(ctx, createQuery)
+		if err != nil {
+			return n, fmt.Errorf("couac: upsert create %s: %w", destTable, err)
+		}
+		return n, nil
+	}
+
+	on := make([]string, len(keyColumns))
+	for i, k := range keyColumns {
+		on[i] = fmt.Sprintf("t.%s = s.%s", quoteIdentifier(k), quoteIdentifier(k))
+	}
+	newer := "TRUE"
+	if cfg.versionColumn != "" {
+		v := quoteIdentifier(cfg.versionColumn)
+		newer = fmt.Sprintf("(t.%s IS NULL OR s.%s > t.%s)", v, v, v)
+	}
 
+	var sets []string
+	for _, c := range cols {
+		if !slices.Contains(keyColumns, c) {
+			sets = append(sets, fmt.Sprintf("%s = s.%s", quoteIdentifier(c), quoteIdentifier(c)))
+		}
+	}
+
+	var mergeQuery strings.Builder
+	fmt.Fprintf(&mergeQuery, "MERGE INTO %s AS t USING (%s) AS s ON %s\n",
+		quotedDest, source, strings.Join(on, " AND "))
+	if cfg.deleteMarker != "" {
+		fmt.Fprintf(&mergeQuery, "WHEN MATCHED AND NOT (%s) AND %s THEN DELETE\n", notDeleted, newer)
+	}
+	if len(sets) > 0 {
+		fmt.Fprintf(&mergeQuery, "WHEN MATCHED AND %s AND %s THEN UPDATE SET %s\n",
+			notDeleted, newer, strings.Join(sets, ", "))
+	}
+	fmt.Fprintf(&mergeQuery, "WHEN NOT MATCHED AND %s THEN INSERT (%s) VALUES (%s)",
+		notDeleted, quoteAll("", cols), quoteAll("s.", cols))
+
+	n, err = q.execInternal(ctx, mergeQuery.String())
+	if err != nil {
+		return n, fmt.Errorf("couac: upsert into %s: %w", destTable, err)
+	}
+	return n, nil
+}
+
+// ingestWithMode ingests rec into table using the given ADBC ingest
+// mode. Caller must already hold the parent's RWMutex read lock.
+func (q *Conn) ingestWithMode(ctx context.Context, table string, rec arrow.RecordBatch, mode string) (int64, error) {
+	return q.ingestRecord(ctx, table, rec, mode, false)
+}
+
+// ingestStaging creates the TEMPORARY staging table from rec. Caller
+// must already hold the parent's RWMutex read lock.
+func (q *Conn) ingestStaging(ctx context.Context, table string, rec arrow.RecordBatch) (int64, error) {
+	return q.ingestRecord(ctx, table, rec, adbc.OptionValueIngestModeCreate, true)
+}
+
+// ingestRecord implements [Conn.ingestWithMode] and
+// [Conn.ingestStaging].
+func (q *Conn) ingestRecord(ctx context.Context, table string, rec arrow.RecordBatch, mode string, temporary bool) (int64, error) {
 	stmt, err := q.conn.NewStatement()
 	if err != nil {
 		return 0, fmt.Errorf("couac: new statement: %w", err)
 	}
 	defer stmt.Close()
 
-	if err := stmt.SetOption(adbc.OptionKeyIngestMode, adbc.OptionValueIngestModeReplace); err != nil {
-		return 0, fmt.Errorf("couac: set ingest mode replace: %w", err)
+	if err := stmt.SetOption(adbc.OptionKeyIngestMode, mode); err != nil {
+		return 0, fmt.Errorf("couac: set ingest mode: %w", err)
 	}
-	if err := stmt.SetOption(adbc.OptionKeyIngestTargetTable, destTable); err != nil {
+	if temporary {
+		if err := stmt.SetOption(adbc.OptionValueIngestTemporary, adbc.OptionValueEnabled); err != nil {
+			return 0, fmt.Errorf("couac: set temporary ingest: %w", err)
+		}
+	}
+	if err := stmt.SetOption(adbc.OptionKeyIngestTargetTable, table); err != nil {
 		return 0, fmt.Errorf("couac: set target table: %w", err)
 	}
 	if err := stmt.Bind(ctx, rec); err != nil {
 		return 0, fmt.Errorf("couac: bind record: %w", err)
 	}
-	n, err := stmt.ExecuteUpdate(ctx)
+	n, err := executeUpdate(ctx, stmt)
 	if err != nil {
-		return n, fmt.Errorf("couac: execute ingest: %w", err)
+		return n, fmt.Errorf("couac: execute ingest: %w", q.sqlError(err, ""))
 	}
 	return n, nil
 }
@@ -228,8 +350,8 @@ func (q *Conn) IngestReplace(ctx context.Context, destTable string, rec arrow.Re
 // require holding all data in memory at once.
 //
 // The table is created if it does not exist, or appended to if it does.
-func (q *Conn) IngestStream(ctx context.Context, destTable string, reader array.RecordReader) (int64, error) {
-	if err := q.ensureConnOpen(); err != nil {
+func (q *Conn) IngestStream(ctx context.Context, destTable string, reader array.RecordReader) (n int64, err error) {
+	if err := q.ensureWritable(); err != nil {
 		return 0, err
 	}
 	if destTable == "" {
@@ -238,10 +360,31 @@ func (q *Conn) IngestStream(ctx context.Context, destTable string, reader array.
 	if reader == nil {
 		return 0, ErrNilRecord
 	}
+	if q.parent.instrumented() {
+		// The size of a stream is only known once it has been read.
+		ev := &HookEvent{Op: "IngestStream", Table: destTable, Mode: "append", Rows: -1, Bytes: -1}
+		var after afterFunc
+		if ctx, after, err = q.parent.runHooks(ctx, hookIngest, ev); err != nil {
+			return 0, err
+		}
+		destTable = ev.Table
+		counted := &countingReader{RecordReader: reader, sizes: true}
+		reader = counted
+		defer func() {
+			ev.Bytes = counted.bytes
+			after.run(max(n, counted.rows), err)
+		}()
+	}
 
-	q.parent.mu.RLock()
+	q.parent.rlock()
 	defer q.parent.mu.RUnlock()
 
+	return q.ingestStream(ctx, destTable, reader)
+}
+
+// ingestStream implements [Conn.IngestStream]. Caller must already hold
+// the parent's RWMutex read lock.
+func (q *Conn) ingestStream(ctx context.Context, destTable string, reader array.RecordReader) (int64, error) {
 	// Probe for existing table
 	schema, _ := q.conn.GetTableSchema(ctx, q.catalogPtr(), q.dbSchemaPtr(), destTable)
 
@@ -264,12 +407,21 @@ func (q *Conn) IngestStream(ctx context.Context, destTable string, reader array.
 	if err := stmt.SetOption(adbc.OptionKeyIngestTargetTable, destTable); err != nil {
 		return 0, fmt.Errorf("couac: set target table: %w", err)
 	}
+	var cr *cancelReader
+	if ctx.Done() != nil {
+		cr = &cancelReader{RecordReader: reader, ctx: ctx}
+		reader = cr
+	}
 	if err := stmt.BindStream(ctx, reader); err != nil {
 		return 0, fmt.Errorf("couac: bind stream: %w", err)
 	}
-	n, err := stmt.ExecuteUpdate(ctx)
+	n, err := executeUpdate(ctx, stmt)
+	if err == nil && cr != nil && cr.err != nil {
+		// The driver may end the ingest quietly when the stream fails.
+		err = cr.err
+	}
 	if err != nil {
-		return n, fmt.Errorf("couac: execute stream ingest: %w", err)
+		return n, fmt.Errorf("couac: execute stream ingest: %w", q.sqlError(err, ""))
 	}
 	return n, nil
 }
@@ -283,21 +435,8 @@ func (q *Conn) execInternal(ctx context.Context, query string) (int64, error) {
 	}
 	defer stmt.Close()
 	if err := stmt.SetSqlQuery(query); err != nil {
-		return 0, fmt.Errorf("couac: set sql query: %w", err)
-	}
-	return stmt.ExecuteUpdate(ctx)
-}
-
-// dropTableRetry attempts to drop a table, retrying up to 5 times.
-// Caller must already hold the parent's RWMutex read lock.
-func (q *Conn) dropTableRetry(ctx context.Context, quotedName, rawName string) {
-	for range 6 {
-		schema, _ := q.conn.GetTableSchema(ctx, q.catalogPtr(), q.dbSchemaPtr(), rawName)
-		if schema == nil {
-			return
-		}
-		dropQuery := fmt.Sprintf(`DROP TABLE IF EXISTS %s`, quotedName)
-		q.execInternal(ctx, dropQuery)
-		time.Sleep(50 * time.Millisecond)
+		return 0, fmt.Errorf("couac: set sql query: %w", q.sqlError(err, query))
 	}
+	n, err := executeUpdate(ctx, stmt)
+	return n, q.sqlError(err, query)
 }
@@ -0,0 +1,151 @@
+package couac
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/apache/arrow-adbc/go/adbc"
+	"github.com/apache/arrow-go/v18/arrow"
+)
+
+// IngestBatch ingests several record batches, possibly into different
+// tables, all-or-nothing: the entries are applied in order within a
+// single transaction, and if any of them fails the transaction is
+// rolled back and no table is changed. This keeps related tables, such
+// as facts and their dimensions, consistent with each other.
+//
+// Each entry is written according to its [IngestMode]. On success the
+// returned [IngestSummary] reports the rows ingested per table. On a
+// connection obtained from [DB.WithTransaction], the entries join the
+// caller's transaction instead, which the caller commits or rolls back.
+//
+// Example:
+//
+//	summary, err := conn.IngestBatch(ctx, []couac.IngestEntry{
+//	    {Table: "customers", Record: customers, Mode: couac.IngestModeMerge},
+//	    {Table: "orders", Record: orders},
+//	})
+func (q *Conn) IngestBatch(ctx context.Context, entries []IngestEntry) (_ *IngestSummary, err error) {
+	if err := q.ensureWritable(); err != nil {
+		return nil, err
+	}
+	for i, e := range entries {
+		switch {
+		case e.Table == "":
+			return nil, fmt.Errorf("couac: ingest batch entry %d: %w", i, ErrEmptyTable)
+		case e.Record == nil:
+			return nil, fmt.Errorf("couac: ingest batch entry %d: %w", i, ErrNilRecord)
+		case e.Mode < IngestModeAppend || e.Mode > IngestModeReplace:
+			return nil, fmt.Errorf("couac: ingest batch entry %d: unknown ingest mode %s", i, e.Mode)
+		}
+	}
+
+	// Run the hooks of every entry before taking any lock, since they
+	// may redirect entries to other tables.
+	if q.parent.instrumented() {
+		entries = slices.Clone(entries)
+		afters := make([]afterFunc, 0, len(entries))
+		defer func() {
+			for i, after := range afters {
+				rows := entries[i].Record.NumRows()
+				if err != nil {
+					rows = 0
+				}
+				after.run(rows, err)
+			}
+		}()
+		for i := range entries {
+			var after afterFunc
+			_, entries[i].Table, after, err = q.parent.beforeIngest(ctx, "IngestBatch", entries[i].Mode.String(), entries[i].Table, entries[i].Record)
+			if err != nil {
+				return nil, fmt.Errorf("couac: ingest batch entry %d: %w", i, err)
+			}
+			afters = append(afters, after)
+		}
+	}
+	q.parent.rlock()
+	defer q.parent.mu.RUnlock()
+
+	keys := make([]string, 0, len(entries))
+	for _, e := range entries {
+		key, err := q.tableLockKey(ctx, e.Table)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	// Lock every destination in a fixed order so that concurrent batches
+	// over overlapping tables cannot deadlock. Sorting the lock keys
+	// rather than the names also locks "Orders" and "orders" once.
+	slices.Sort(keys)
+	for _, key := range slices.Compact(keys) {
+		defer q.parent.lockTableKey(key)()
+	}
+
+	ownTx := !q.inTransaction()
+	if ownTx {
+		if _, err := q.execInternal(ctx, "BEGIN TRANSACTION"); err != nil {
+			return nil, fmt.Errorf("couac: begin transaction: %w", err)
+		}
+	}
+
+	summary := &IngestSummary{
+		Rows:          make(map[string]int64),
+		SchemaChanges: make(map[string][]*SchemaChange),
+	}
+	for i, e := range entries {
+		change, err := q.ingestEntry(ctx, e)
+		if err != nil {
+			if ownTx {
+				q.execInternal(context.WithoutCancel(ctx), "ROLLBACK")
+			}
+			return nil, fmt.Errorf("couac: ingest batch entry %d (%s): %w", i, e.Table, err)
+		}
+		summary.Rows[e.Table] += e.Record.NumRows()
+		if change != nil && change.Altered() {
+			summary.SchemaChanges[e.Table] = append(summary.SchemaChanges[e.Table], change)
+		}
+	}
+
+	if ownTx {
+		if _, err := q.execInternal(ctx, "COMMIT"); err != nil {
+			q.execInternal(context.WithoutCancel(ctx), "ROLLBACK")
+			return nil, fmt.Errorf("couac: commit: %w", err)
+		}
+	}
+	return summary, nil
+}
+
+// ingestEntry writes one IngestBatch entry inside the batch's
+// transaction. Caller must hold the parent's RWMutex read lock and the
+// entry's table lock.
+func (q *Conn) ingestEntry(ctx context.Context, e IngestEntry) (*SchemaChange, error) {
+	switch e.Mode {
+	case IngestModeMerge:
+		_, change, err := q.ingestMergePolicy(ctx, e.Table, e.Record, DefaultSchemaPolicy, true)
+		return change, err
+	case IngestModeReplace:
+		// Drop and recreate with plain statements rather than ADBC's
+		// Replace mode, so the replacement is part of the transaction.
+		if _, err := q.execInternal(ctx, "DROP TABLE IF EXISTS "+quoteIdentifier(e.Table)); err != nil {
+			return nil, fmt.Errorf("couac: drop %s: %w", e.Table, err)
+		}
+		_, err := q.ingestWithMode(ctx, e.Table, e.Record, adbc.OptionValueIngestModeCreate)
+		return nil, err
+	default:
+		return nil, q.ingestCreateOrAppend(ctx, e.Table, e.Record)
+	}
+}
+
+// ingestCreateOrAppend creates table from rec if it does not exist,
+// or appends to it. Caller must hold the parent's RWMutex read lock.
+func (q *Conn) ingestCreateOrAppend(ctx context.Context, table string, rec arrow.RecordBatch) error {
+	mode := adbc.OptionValueIngestModeAppend
+	if schema, _ := q.conn.GetTableSchema(ctx, q.catalogPtr(), q.dbSchemaPtr(), table); schema == nil {
+		mode = adbc.OptionValueIngestModeCreate
+	}
+	_, err := q.ingestWithMode(ctx, table, rec, mode)
+	return err
+}
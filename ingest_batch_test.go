@@ -0,0 +1,204 @@
+package couac_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/loicalleyne/couac"
+)
+
+func tableCount(t *testing.T, conn *couac.Conn, table string) int64 {
+	t.Helper()
+	n, err := couac.QueryAs[int64](context.Background(), conn, "SELECT count(*) FROM "+table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n[0]
+}
+
+func TestIngestBatch_Commit(t *testing.T) {
+	_, conn := newTestConn(t)
+	ctx := context.Background()
+
+	dims := makeTestRecord(t, 2)
+	defer dims.Release()
+	if _, err := conn.Ingest(ctx, "dims", dims); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Ingest(ctx, "snapshot", dims); err != nil {
+		t.Fatal(err)
+	}
+
+	facts := makeTestRecord(t, 5)
+	defer facts.Release()
+	newDims := makeTestRecordExtended(t, 3)
+	defer newDims.Release()
+
+	summary, err := conn.IngestBatch(ctx, []couac.IngestEntry{
+		{Table: "facts", Record: facts},
+		{Table: "dims", Record: newDims, Mode: couac.IngestModeMerge},
+		{Table: "facts", Record: facts, Mode: couac.IngestModeAppend},
+		{Table: "snapshot", Record: newDims, Mode: couac.IngestModeReplace},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]int64{"facts": 10, "dims": 3, "snapshot": 3}
+	for table, n := range want {
+		if summary.Rows[table] != n {
+			t.Errorf("summary rows for %s: expected %d, got %d", table, n, summary.Rows[table])
+		}
+	}
+	if len(summary.SchemaChanges["dims"]) != 1 || summary.SchemaChanges["dims"][0].Added[0].Name != "age" {
+		t.Errorf("expected dims to report the added age column, got %+v", summary.SchemaChanges)
+	}
+
+	for table, n := range map[string]int64{"facts": 10, "dims": 5, "snapshot": 3} {
+		if got := tableCount(t, conn, table); got != n {
+			t.Errorf("%s: expected %d rows, got %d", table, n, got)
+		}
+	}
+}
+
+func TestIngestBatch_RollbackOnFailure(t *testing.T) {
+	_, conn := newTestConn(t)
+	ctx := context.Background()
+
+	if _, err := conn.Exec(ctx, "CREATE TABLE strict_ids (id INTEGER, name VARCHAR)"); err != nil {
+		t.Fatal(err)
+	}
+
+	// "name" values cannot be cast to INTEGER, so the second entry fails.
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.BinaryTypes.String},
+		{Name: "name", Type: arrow.BinaryTypes.String},
+	}, nil)
+	bldr := array.NewRecordBuilder(memory.DefaultAllocator, schema)
+	defer bldr.Release()
+	bldr.Field(0).(*array.StringBuilder).Append("not a number")
+	bldr.Field(1).(*array.StringBuilder).Append("x")
+	bad := bldr.NewRecordBatch()
+	defer bad.Release()
+
+	good := makeTestRecord(t, 3)
+	defer good.Release()
+
+	_, err := conn.IngestBatch(ctx, []couac.IngestEntry{
+		{Table: "batch_facts", Record: good},
+		{Table: "strict_ids", Record: bad},
+	})
+	if err == nil {
+		t.Fatal("expected batch to fail")
+	}
+
+	tables, err := conn.ShowTables(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tbl := range tables {
+		if tbl == "batch_facts" {
+			t.Error("batch_facts should not exist after rollback")
+		}
+	}
+	if got := tableCount(t, conn, "strict_ids"); got != 0 {
+		t.Errorf("expected strict_ids to stay empty, got %d rows", got)
+	}
+}
+
+func TestIngestBatch_CaseInsensitiveTables(t *testing.T) {
+	_, conn := newTestConn(t)
+	ctx := context.Background()
+	rec := makeTestRecord(t, 2)
+	defer rec.Release()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := conn.IngestBatch(ctx, []couac.IngestEntry{
+			{Table: "Orders", Record: rec},
+			{Table: "orders", Record: rec},
+		})
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("IngestBatch deadlocked on tables differing only in case")
+	}
+	if got := tableCount(t, conn, "orders"); got != 4 {
+		t.Errorf("expected 4 rows, got %d", got)
+	}
+}
+
+func TestIngestBatch_InvalidEntry(t *testing.T) {
+	_, conn := newTestConn(t)
+	rec := makeTestRecord(t, 1)
+	defer rec.Release()
+
+	_, err := conn.IngestBatch(context.Background(), []couac.IngestEntry{
+		{Table: "ok", Record: rec},
+		{Table: "", Record: rec},
+	})
+	if !errors.Is(err, couac.ErrEmptyTable) {
+		t.Errorf("expected ErrEmptyTable, got %v", err)
+	}
+}
+
+func TestWithTransaction_IngestRollback(t *testing.T) {
+	db, conn := newTestConn(t)
+	ctx := context.Background()
+
+	rec := makeTestRecord(t, 2)
+	defer rec.Release()
+	if _, err := conn.Ingest(ctx, "tx_ingest", rec); err != nil {
+		t.Fatal(err)
+	}
+
+	wantErr := errors.New("abort")
+	err := db.WithTransaction(ctx, func(tx *couac.Conn) error {
+		if _, err := tx.Ingest(ctx, "tx_ingest", rec); err != nil {
+			return err
+		}
+		ext := makeTestRecordExtended(t, 1)
+		defer ext.Release()
+		if _, err := tx.IngestMerge(ctx, "tx_ingest", ext); err != nil {
+			return err
+		}
+		if _, err := tx.IngestBatch(ctx, []couac.IngestEntry{{Table: "tx_other", Record: rec}}); err != nil {
+			return err
+		}
+		if got := tableCount(t, tx, "tx_ingest"); got != 5 {
+			t.Errorf("expected 5 rows inside the transaction, got %d", got)
+		}
+		return wantErr
+	})
+	if !errors.Is(err, wantErr) {
+		t.Fatalf("expected abort error, got %v", err)
+	}
+
+	if got := tableCount(t, conn, "tx_ingest"); got != 2 {
+		t.Errorf("expected 2 rows after rollback, got %d", got)
+	}
+	cols, err := conn.Describe(ctx, "tx_ingest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cols) != 2 {
+		t.Errorf("expected added column to be rolled back, got %d columns", len(cols))
+	}
+	tables, err := conn.ShowTables(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tables) != 1 {
+		t.Errorf("expected tx_other to be rolled back, got %v", tables)
+	}
+}
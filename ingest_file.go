@@ -0,0 +1,609 @@
+package couac
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/util"
+)
+
+// IngestFile loads one or more files into the target table and returns
+// the number of rows ingested.
+//
+// The format is taken from [WithFileFormat] or detected from the file
+// extension (.parquet, .csv, .tsv, .json, .ndjson, .jsonl, .arrow,
+// .arrows, .ipc, .feather; a trailing .gz or .zst is ignored). path may
+// be a glob such as "data/*.parquet" or "events/**/*.parquet", where
+// "**" matches any number of directories for every format; use
+// [WithHivePartitioning] to turn hive-style directories into columns.
+//
+// Parquet, CSV, and JSON files are read by DuckDB itself. Arrow IPC
+// files and streams are decoded in Go and fed to the ADBC ingest path,
+// as with [Conn.IngestStream].
+//
+// The write follows the [IngestMode] set with [WithFileMode], with the
+// same semantics as the other Ingest methods: [IngestModeAppend]
+// creates the table or appends to it, matching columns by name;
+// [IngestModeMerge] first evolves the table with [DefaultSchemaPolicy];
+// [IngestModeReplace] recreates the table from the files. Merges and
+// replacements run in a single transaction.
+//
+// Example:
+//
+//	n, err := conn.IngestFile(ctx, "events", "data/events/*/*.parquet",
+//	    couac.WithHivePartitioning(),
+//	    couac.WithFileMode(couac.IngestModeMerge))
+func (q *Conn) IngestFile(ctx context.Context, destTable, path string, opts ...FileOption) (n int64, err error) {
+	if err := q.ensureWritable(); err != nil {
+		return 0, err
+	}
+	if destTable == "" {
+		return 0, ErrEmptyTable
+	}
+	if path == "" {
+		return 0, errors.New("couac: empty file path")
+	}
+
+	cfg := &fileConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.mode < IngestModeAppend || cfg.mode > IngestModeReplace {
+		return 0, fmt.Errorf("couac: unknown ingest mode %s", cfg.mode)
+	}
+	if q.parent.instrumented() {
+		ev := &HookEvent{Op: "IngestFile", Table: destTable, Mode: cfg.mode.String(), Path: path, Rows: -1, Bytes: -1}
+		var after afterFunc
+		if ctx, after, err = q.parent.runHooks(ctx, hookIngest, ev); err != nil {
+			return 0, err
+		}
+		destTable, path = ev.Table, ev.Path
+		defer func() { after.run(n, err) }()
+	}
+	format := cfg.format
+	if format == FormatAuto {
+		var err error
+		if format, err = detectFileFormat(path); err != nil {
+			return 0, err
+		}
+	}
+
+	var source string
+	if format != FormatArrowIPC {
+		var err error
+		if source, err = readFunction(format, path, cfg); err != nil {
+			return 0, err
+		}
+	} else if cfg.hive {
+		return 0, errors.New("couac: hive partitioning is not supported for Arrow IPC files")
+	}
+
+	q.parent.rlock()
+	defer q.parent.mu.RUnlock()
+	unlock, err := q.lockTable(ctx, destTable)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	if format == FormatArrowIPC {
+		return q.ingestIPCFiles(ctx, destTable, path, cfg.mode)
+	}
+	return q.ingestSQLSource(ctx, destTable, source, cfg.mode)
+}
+
+// IngestIPC ingests an Arrow IPC stream, such as the body of an HTTP
+// response or the output of another Arrow tool, into the target table
+// through [Conn.IngestStream], creating the table if it does not exist.
+// It returns the number of rows ingested.
+func (q *Conn) IngestIPC(ctx context.Context, destTable string, r io.Reader) (int64, error) {
+	if err := q.ensureWritable(); err != nil {
+		return 0, err
+	}
+	rdr, err := ipc.NewReader(r)
+	if err != nil {
+		return 0, fmt.Errorf("couac: open ipc stream: %w", err)
+	}
+	defer rdr.Release()
+
+	counted := &countingReader{RecordReader: rdr}
+	if _, err := q.IngestStream(ctx, destTable, counted); err != nil {
+		return 0, err
+	}
+	return counted.rows, nil
+}
+
+// detectFileFormat maps a file extension to its FileFormat.
+func detectFileFormat(path string) (FileFormat, error) {
+	name := strings.ToLower(filepath.Base(path))
+	for _, compressed := range []string{".gz", ".zst"} {
+		name = strings.TrimSuffix(name, compressed)
+	}
+	switch filepath.Ext(name) {
+	case ".parquet", ".pq":
+		return FormatParquet, nil
+	case ".csv", ".tsv":
+		return FormatCSV, nil
+	case ".json", ".ndjson", ".jsonl":
+		return FormatJSON, nil
+	case ".arrow", ".arrows", ".ipc", ".feather":
+		return FormatArrowIPC, nil
+	default:
+		return FormatAuto, fmt.Errorf("%w: %s", ErrUnknownFileFormat, path)
+	}
+}
+
+var readOptionName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// readFunction renders the DuckDB table function call that reads path.
+func readFunction(format FileFormat, path string, cfg *fileConfig) (string, error) {
+	var fn string
+	switch format {
+	case FormatParquet:
+		fn = "read_parquet"
+	case FormatCSV:
+		fn = "read_csv"
+	case FormatJSON:
+		fn = "read_json"
+	default:
+		return "", fmt.Errorf("%w: %d", ErrUnknownFileFormat, int(format))
+	}
+
+	args := []string{quoteString(path)}
+	if cfg.hive {
+		args = append(args, "hive_partitioning = true")
+	}
+	for _, o := range cfg.readOptions {
+		v, err := o.sqlValue()
+		if err != nil {
+			return "", err
+		}
+		args = append(args, o.name+" = "+v)
+	}
+	return fn + "(" + strings.Join(args, ", ") + ")", nil
+}
+
+// sqlValue validates the option name and renders its value as a SQL
+// literal.
+func (o readOption) sqlValue() (string, error) {
+	if !readOptionName.MatchString(o.name) {
+		return "", fmt.Errorf("couac: invalid option name %q", o.name)
+	}
+	switch val := o.value.(type) {
+	case string:
+		return quoteString(val), nil
+	case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return fmt.Sprint(val), nil
+	default:
+		return "", fmt.Errorf("couac: unsupported value %T for option %q", o.value, o.name)
+	}
+}
+
+// ingestSQLSource writes the rows of a DuckDB table function into
+// destTable. Caller must hold the parent's RWMutex read lock and the
+// destination's table lock.
+func (q *Conn) ingestSQLSource(ctx context.Context, destTable, source string, mode IngestMode) (int64, error) {
+	quotedDest := quoteIdentifier(destTable)
+	if mode == IngestModeReplace {
+		return q.countInternal(ctx, fmt.Sprintf("CREATE OR REPLACE TABLE %s AS SELECT * FROM %s", quotedDest, source))
+	}
+
+	schema, _ := q.conn.GetTableSchema(ctx, q.catalogPtr(), q.dbSchemaPtr(), destTable)
+	if schema == nil {
+		return q.countInternal(ctx, fmt.Sprintf("CREATE TABLE %s AS SELECT * FROM %s", quotedDest, source))
+	}
+	insert := fmt.Sprintf("INSERT INTO %s BY NAME SELECT * FROM %s", quotedDest, source)
+	if mode == IngestModeAppend {
+		return q.countInternal(ctx, insert)
+	}
+
+	// Merge: diff the file schema against the table, evolve the table,
+	// then insert by name so that column order and missing columns do
+	// not matter.
+	fileSchema, err := q.querySchemaInternal(ctx, "SELECT * FROM "+source+" LIMIT 0")
+	if err != nil {
+		return 0, err
+	}
+	plan, err := planSchemaChange(destTable, schema, fileSchema, DefaultSchemaPolicy, &SchemaChange{Table: destTable}, q.commonTypeFunc(ctx))
+	if err != nil {
+		return 0, err
+	}
+
+	inTx := q.inTransaction() || len(plan.ddl) == 0
+	if !inTx {
+		if _, err := q.execInternal(ctx, "BEGIN TRANSACTION"); err != nil {
+			return 0, fmt.Errorf("couac: begin transaction: %w", err)
+		}
+	}
+	fail := func(err error) (int64, error) {
+		if !inTx {
+			q.execInternal(context.WithoutCancel(ctx), "ROLLBACK")
+		}
+		return 0, err
+	}
+	for _, ddl := range plan.ddl {
+		if _, err := q.execInternal(ctx, ddl); err != nil {
+			return fail(fmt.Errorf("couac: evolve %s: %w", destTable, err))
+		}
+	}
+	n, err := q.countInternal(ctx, insert)
+	if err != nil {
+		return fail(err)
+	}
+	if !inTx {
+		if _, err := q.execInternal(ctx, "COMMIT"); err != nil {
+			return fail(fmt.Errorf("couac: commit: %w", err))
+		}
+	}
+	return n, nil
+}
+
+// globFiles returns the files matching pattern, like [filepath.Glob],
+// except that a "**" path element matches any number of directories,
+// as in DuckDB's globs.
+func globFiles(pattern string) ([]string, error) {
+	if !strings.Contains(pattern, "**") {
+		return filepath.Glob(pattern)
+	}
+	elems := strings.Split(filepath.ToSlash(pattern), "/")
+	for _, e := range elems {
+		if _, err := path.Match(e, ""); err != nil {
+			return nil, err
+		}
+	}
+	// Walk from the longest leading directory without wildcards.
+	n := 0
+	for n < len(elems)-1 && !strings.ContainsAny(elems[n], "*?[\\") {
+		n++
+	}
+	root := filepath.FromSlash(strings.Join(elems[:n], "/"))
+	switch {
+	case n == 0:
+		root = "."
+	case root == "":
+		root = string(filepath.Separator)
+	}
+
+	var matches []string
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == root && errors.Is(err, fs.ErrNotExist) {
+				return fs.SkipAll
+			}
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if matchGlobElems(elems[n:], strings.Split(filepath.ToSlash(rel), "/")) {
+			matches = append(matches, p)
+		}
+		return nil
+	})
+	return matches, err
+}
+
+// matchGlobElems reports whether the path elements name match the
+// pattern elements pat, where "**" matches zero or more elements.
+func matchGlobElems(pat, name []string) bool {
+	for len(pat) > 0 {
+		if pat[0] == "**" {
+			for i := range len(name) + 1 {
+				if matchGlobElems(pat[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pat[0], name[0]); !ok {
+			return false
+		}
+		pat, name = pat[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// ingestIPCFiles ingests the Arrow IPC files matching pattern. Caller
+// must hold the parent's RWMutex read lock and the destination's table
+// lock.
+func (q *Conn) ingestIPCFiles(ctx context.Context, destTable, pattern string, mode IngestMode) (int64, error) {
+	paths, err := globFiles(pattern)
+	if err != nil {
+		return 0, fmt.Errorf("couac: glob %s: %w", pattern, err)
+	}
+	if len(paths) == 0 {
+		return 0, fmt.Errorf("couac: no files match %s", pattern)
+	}
+	rdr, err := newIPCFilesReader(paths)
+	if err != nil {
+		return 0, err
+	}
+	defer rdr.Release()
+
+	inTx := q.inTransaction() || mode == IngestModeAppend
+	if !inTx {
+		if _, err := q.execInternal(ctx, "BEGIN TRANSACTION"); err != nil {
+			return 0, fmt.Errorf("couac: begin transaction: %w", err)
+		}
+	}
+	fail := func(err error) (int64, error) {
+		if !inTx {
+			q.execInternal(context.WithoutCancel(ctx), "ROLLBACK")
+		}
+		return 0, err
+	}
+
+	switch mode {
+	case IngestModeMerge:
+		for rdr.Next() {
+			if _, _, err := q.ingestMergePolicy(ctx, destTable, rdr.RecordBatch(), DefaultSchemaPolicy, true); err != nil {
+				return fail(err)
+			}
+		}
+		if err := rdr.Err(); err != nil {
+			return fail(err)
+		}
+	default:
+		if mode == IngestModeReplace {
+			if _, err := q.execInternal(ctx, "DROP TABLE IF EXISTS "+quoteIdentifier(destTable)); err != nil {
+				return fail(fmt.Errorf("couac: drop %s: %w", destTable, err))
+			}
+		}
+		if _, err := q.ingestStream(ctx, destTable, rdr); err != nil {
+			return fail(err)
+		}
+	}
+
+	if !inTx {
+		if _, err := q.execInternal(ctx, "COMMIT"); err != nil {
+			return fail(fmt.Errorf("couac: commit: %w", err))
+		}
+	}
+	return rdr.rows, nil
+}
+
+// ipcMagic starts every Arrow IPC file (as opposed to stream).
+var ipcMagic = []byte("ARROW1")
+
+// ipcSource is one open Arrow IPC file or stream.
+type ipcSource struct {
+	schema *arrow.Schema
+	// next returns the next record batch, owned by the caller, or nil
+	// at the end of the source.
+	next  func() (arrow.RecordBatch, error)
+	close func()
+}
+
+// openIPC opens the Arrow IPC file or stream at path, telling the two
+// apart by the file magic.
+func openIPC(path string) (*ipcSource, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("couac: open %s: %w", path, err)
+	}
+
+	br := bufio.NewReader(f)
+	if head, _ := br.Peek(len(ipcMagic)); bytes.Equal(head, ipcMagic) {
+		fr, err := ipc.NewFileReader(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("couac: open ipc file %s: %w", path, err)
+		}
+		i := 0
+		return &ipcSource{
+			schema: fr.Schema(),
+			next: func() (arrow.RecordBatch, error) {
+				if i >= fr.NumRecords() {
+					return nil, nil
+				}
+				rec, err := fr.RecordBatchAt(i)
+				if err != nil {
+					return nil, fmt.Errorf("couac: read %s: %w", path, err)
+				}
+				i++
+				return rec, nil
+			},
+			close: func() { fr.Close(); f.Close() },
+		}, nil
+	}
+
+	rdr, err := ipc.NewReader(br)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("couac: open ipc stream %s: %w", path, err)
+	}
+	return &ipcSource{
+		schema: rdr.Schema(),
+		next: func() (arrow.RecordBatch, error) {
+			if !rdr.Next() {
+				if err := rdr.Err(); err != nil {
+					return nil, fmt.Errorf("couac: read %s: %w", path, err)
+				}
+				return nil, nil
+			}
+			rec := rdr.RecordBatch()
+			rec.Retain()
+			return rec, nil
+		},
+		close: func() { rdr.Release(); f.Close() },
+	}, nil
+}
+
+// ipcFilesReader is an [array.RecordReader] over the record batches of
+// several Arrow IPC files, which must share the first file's schema.
+// It counts the rows it reads.
+//
+// It is a plain state machine rather than an iterator adapter because
+// the ADBC driver pulls batches through cgo callbacks, which cannot
+// switch goroutine stacks.
+type ipcFilesReader struct {
+	refCount atomic.Int64
+	schema   *arrow.Schema
+	paths    []string
+	src      *ipcSource
+	rec      arrow.RecordBatch
+	err      error
+	rows     int64
+}
+
+var _ array.RecordReader = (*ipcFilesReader)(nil)
+
+func newIPCFilesReader(paths []string) (*ipcFilesReader, error) {
+	src, err := openIPC(paths[0])
+	if err != nil {
+		return nil, err
+	}
+	r := &ipcFilesReader{schema: src.schema, paths: paths[1:], src: src}
+	r.refCount.Add(1)
+	return r, nil
+}
+
+func (r *ipcFilesReader) Retain() { r.refCount.Add(1) }
+
+func (r *ipcFilesReader) Release() {
+	if r.refCount.Add(-1) != 0 {
+		return
+	}
+	if r.rec != nil {
+		r.rec.Release()
+		r.rec = nil
+	}
+	if r.src != nil {
+		r.src.close()
+		r.src = nil
+	}
+}
+
+func (r *ipcFilesReader) Schema() *arrow.Schema { return r.schema }
+
+func (r *ipcFilesReader) Next() bool {
+	if r.rec != nil {
+		r.rec.Release()
+		r.rec = nil
+	}
+	for r.src != nil && r.err == nil {
+		rec, err := r.src.next()
+		if err != nil {
+			r.err = err
+			return false
+		}
+		if rec != nil {
+			r.rec = rec
+			r.rows += rec.NumRows()
+			return true
+		}
+
+		r.src.close()
+		r.src = nil
+		if len(r.paths) == 0 {
+			return false
+		}
+		path := r.paths[0]
+		r.paths = r.paths[1:]
+		if r.src, r.err = openIPC(path); r.err != nil {
+			return false
+		}
+		if !r.src.schema.Equal(r.schema) {
+			r.err = fmt.Errorf("couac: %s: %w: schema differs from the first file", path, ErrSchemaMismatch)
+		}
+	}
+	return false
+}
+
+func (r *ipcFilesReader) RecordBatch() arrow.RecordBatch { return r.rec }
+
+// Record is the deprecated alias of RecordBatch required by
+// [array.RecordReader].
+func (r *ipcFilesReader) Record() arrow.RecordBatch { return r.rec }
+
+func (r *ipcFilesReader) Err() error { return r.err }
+
+// countingReader wraps an [array.RecordReader], counting the rows read.
+type countingReader struct {
+	array.RecordReader
+	rows int64
+	// bytes is the size of the batches read, counted when sizes is set.
+	bytes int64
+	sizes bool
+}
+
+func (r *countingReader) Next() bool {
+	if !r.RecordReader.Next() {
+		return false
+	}
+	r.rows += r.RecordBatch().NumRows()
+	if r.sizes {
+		r.bytes += util.TotalRecordSize(r.RecordBatch())
+	}
+	return true
+}
+
+// countInternal executes an INSERT or CREATE TABLE AS statement and
+// returns the row count DuckDB reports in its "Count" result column,
+// or -1 if there is none. Caller must already hold the appropriate lock.
+func (q *Conn) countInternal(ctx context.Context, query string) (int64, error) {
+	stmt, err := q.conn.NewStatement()
+	if err != nil {
+		return 0, fmt.Errorf("couac: new statement: %w", err)
+	}
+	defer stmt.Close()
+	if err := stmt.SetSqlQuery(query); err != nil {
+		return 0, fmt.Errorf("couac: set sql query: %w", q.sqlError(err, query))
+	}
+	rr, _, watch, err := executeQuery(ctx, stmt)
+	if err != nil {
+		return 0, fmt.Errorf("couac: execute query: %w", q.sqlError(err, query))
+	}
+	defer watch.stop()
+	defer rr.Release()
+
+	n := int64(-1)
+	for rr.Next() {
+		rec := rr.RecordBatch()
+		if rec.NumRows() == 0 || len(rec.Schema().FieldIndices("Count")) == 0 {
+			continue
+		}
+		if col, ok := rec.Column(rec.Schema().FieldIndices("Count")[0]).(*array.Int64); ok {
+			n = col.Value(0)
+		}
+	}
+	return n, q.sqlError(rr.Err(), query)
+}
+
+// querySchemaInternal returns the result schema of query. Caller must
+// already hold the appropriate lock.
+func (q *Conn) querySchemaInternal(ctx context.Context, query string) (*arrow.Schema, error) {
+	stmt, err := q.conn.NewStatement()
+	if err != nil {
+		return nil, fmt.Errorf("couac: new statement: %w", err)
+	}
+	defer stmt.Close()
+	if err := stmt.SetSqlQuery(query); err != nil {
+		return nil, fmt.Errorf("couac: set sql query: %w", q.sqlError(err, query))
+	}
+	rr, _, watch, err := executeQuery(ctx, stmt)
+	if err != nil {
+		return nil, fmt.Errorf("couac: execute query: %w", q.sqlError(err, query))
+	}
+	defer watch.stop()
+	defer rr.Release()
+	return rr.Schema(), nil
+}
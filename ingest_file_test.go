@@ -0,0 +1,225 @@
+package couac_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/loicalleyne/couac"
+)
+
+func TestIngestFile_ParquetHiveGlob(t *testing.T) {
+	_, conn := newTestConn(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	_, err := conn.Exec(ctx, `COPY (SELECT range AS id, 2020 + range % 3 AS year FROM range(9))
+		TO '`+dir+`' (FORMAT parquet, PARTITION_BY (year))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := conn.IngestFile(ctx, "events", filepath.Join(dir, "*", "*.parquet"), couac.WithHivePartitioning())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 9 {
+		t.Errorf("expected 9 rows ingested, got %d", n)
+	}
+	years, err := couac.QueryAs[int64](ctx, conn, "SELECT count(DISTINCT year) FROM events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if years[0] != 3 {
+		t.Errorf("expected 3 partitions as a year column, got %d", years[0])
+	}
+}
+
+func TestIngestFile_CSVModes(t *testing.T) {
+	_, conn := newTestConn(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	v1 := filepath.Join(dir, "v1.csv")
+	v2 := filepath.Join(dir, "v2.csv")
+	if err := os.WriteFile(v1, []byte("id;name\n1;a\n2;b\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(v2, []byte("name;id;score\nc;3;1.5\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	delim := couac.WithReadOption("delim", ";")
+
+	if _, err := conn.IngestFile(ctx, "people", v1, delim); err != nil {
+		t.Fatal(err)
+	}
+	// Append matches columns by name.
+	if _, err := conn.IngestFile(ctx, "people", v1, delim); err != nil {
+		t.Fatal(err)
+	}
+	// Appending a new column requires a merge.
+	if _, err := conn.IngestFile(ctx, "people", v2, delim); err == nil {
+		t.Error("expected append of an unknown column to fail")
+	}
+	n, err := conn.IngestFile(ctx, "people", v2, delim, couac.WithFileMode(couac.IngestModeMerge))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 row merged, got %d", n)
+	}
+	if got := tableCount(t, conn, "people"); got != 5 {
+		t.Errorf("expected 5 rows, got %d", got)
+	}
+	cols, err := conn.Describe(ctx, "people")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cols) != 3 {
+		t.Errorf("expected score column to be added, got %d columns", len(cols))
+	}
+
+	if _, err := conn.IngestFile(ctx, "people", v1, delim, couac.WithFileMode(couac.IngestModeReplace)); err != nil {
+		t.Fatal(err)
+	}
+	if got := tableCount(t, conn, "people"); got != 2 {
+		t.Errorf("expected 2 rows after replace, got %d", got)
+	}
+}
+
+func TestIngestFile_JSON(t *testing.T) {
+	_, conn := newTestConn(t)
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "rows.ndjson")
+	if err := os.WriteFile(path, []byte(`{"id": 1, "tags": ["a"]}`+"\n"+`{"id": 2, "tags": []}`+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	n, err := conn.IngestFile(ctx, "json_rows", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 rows, got %d", n)
+	}
+}
+
+func TestIngestFile_ArrowIPC(t *testing.T) {
+	_, conn := newTestConn(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	rec := makeTestRecord(t, 3)
+	defer rec.Release()
+
+	// One random-access IPC file and one IPC stream.
+	f, err := os.Create(filepath.Join(dir, "a.arrow"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw, err := ipc.NewFileWriter(f, ipc.WithSchema(rec.Schema()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.Write(rec); err != nil {
+		t.Fatal(err)
+	}
+	fw.Close()
+	f.Close()
+
+	var buf bytes.Buffer
+	sw := ipc.NewWriter(&buf, ipc.WithSchema(rec.Schema()))
+	sw.Write(rec)
+	sw.Write(rec)
+	sw.Close()
+	if err := os.WriteFile(filepath.Join(dir, "b.arrow"), buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := conn.IngestFile(ctx, "ipc_rows", filepath.Join(dir, "*.arrow"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 9 {
+		t.Errorf("expected 9 rows ingested, got %d", n)
+	}
+	if got := tableCount(t, conn, "ipc_rows"); got != 9 {
+		t.Errorf("expected 9 rows in table, got %d", got)
+	}
+
+	n, err = conn.IngestIPC(ctx, "ipc_rows", bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 6 {
+		t.Errorf("expected 6 rows from IngestIPC, got %d", n)
+	}
+
+	ext := makeTestRecordExtended(t, 1)
+	defer ext.Release()
+	buf.Reset()
+	sw = ipc.NewWriter(&buf, ipc.WithSchema(ext.Schema()))
+	sw.Write(ext)
+	sw.Close()
+	extPath := filepath.Join(dir, "ext.arrows")
+	if err := os.WriteFile(extPath, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.IngestFile(ctx, "ipc_rows", extPath, couac.WithFileMode(couac.IngestModeMerge)); err != nil {
+		t.Fatal(err)
+	}
+	if got := tableCount(t, conn, "ipc_rows"); got != 16 {
+		t.Errorf("expected 16 rows after merge, got %d", got)
+	}
+}
+
+func TestIngestFile_ArrowIPCRecursiveGlob(t *testing.T) {
+	_, conn := newTestConn(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	rec := makeTestRecord(t, 2)
+	defer rec.Release()
+	var buf bytes.Buffer
+	sw := ipc.NewWriter(&buf, ipc.WithSchema(rec.Schema()))
+	sw.Write(rec)
+	sw.Close()
+	for _, name := range []string{"events/a.arrows", "events/2024/b.arrows", "events/2024/05/c.arrows", "events/2024/skip.txt", "other/d.arrows"} {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := conn.IngestFile(ctx, "ipc_glob", filepath.Join(dir, "events", "**", "*.arrows"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 6 {
+		t.Errorf("expected 6 rows from 3 files, got %d", n)
+	}
+	n, err = conn.IngestFile(ctx, "ipc_glob", filepath.Join(dir, "**", "2024", "*.arrows"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 rows from 1 file, got %d", n)
+	}
+	if _, err := conn.IngestFile(ctx, "ipc_glob", filepath.Join(dir, "missing", "**", "*.arrows")); err == nil {
+		t.Error("expected an error when no file matches")
+	}
+}
+
+func TestIngestFile_UnknownFormat(t *testing.T) {
+	_, conn := newTestConn(t)
+	_, err := conn.IngestFile(context.Background(), "t", "data.xyz")
+	if !errors.Is(err, couac.ErrUnknownFileFormat) {
+		t.Errorf("expected ErrUnknownFileFormat, got %v", err)
+	}
+}
@@ -0,0 +1,510 @@
+package couac
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/apache/arrow-adbc/go/adbc"
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// IngestMergePolicy ingests an Arrow record batch, evolving the schema
+// of the target table in place as allowed by policy, and returns a
+// [SchemaChange] describing what was done alongside the number of rows
+// affected (-1 if unknown).
+//
+// If the table does not exist, it is created from the batch. Otherwise
+// the batch and table schemas are diffed column by column, matching
+// names case-insensitively and ignoring column order and nullability:
+//   - columns new in the batch are added with ALTER TABLE ADD COLUMN
+//     ([AllowAdd]);
+//   - columns whose batch type is a wider integer or floating point type
+//     are widened with ALTER TABLE ALTER COLUMN TYPE ([AllowWiden]);
+//     narrower batch types are cast by DuckDB on append;
+//   - columns whose batch type is of another kind (e.g. INTEGER and
+//     DOUBLE, signed and unsigned, or numbers and VARCHAR) are changed
+//     to the type DuckDB's UNION BY NAME combines both into, when it
+//     differs from the table's ([AllowWiden]);
+//   - table columns absent from the batch are filled with NULL, or
+//     dropped with ALTER TABLE DROP COLUMN ([AllowDrop]).
+//
+// The batch columns are then reordered to match the table and
+// appended, so existing data is never rewritten. Schema changes and
+// the append run in a single transaction, and merges into the same
+// table from different connections of the [DB] are serialized so that
+// they never race on the same ALTER TABLE. Any difference the policy
+// does not allow fails with [ErrSchemaMismatch] before anything is
+// applied; the returned SchemaChange then lists the differences found.
+func (q *Conn) IngestMergePolicy(ctx context.Context, destTable string, rec arrow.RecordBatch, policy SchemaPolicy) (int64, *SchemaChange, error) {
+	return q.ingestMerge(ctx, "IngestMergePolicy", destTable, rec, policy)
+}
+
+// ingestMerge implements [Conn.IngestMerge] and [Conn.IngestMergePolicy];
+// op names the calling method for hooks.
+func (q *Conn) ingestMerge(ctx context.Context, op, destTable string, rec arrow.RecordBatch, policy SchemaPolicy) (n int64, change *SchemaChange, err error) {
+	if err := q.ensureWritable(); err != nil {
+		return 0, nil, err
+	}
+	if destTable == "" {
+		return 0, nil, ErrEmptyTable
+	}
+	if rec == nil {
+		return 0, nil, ErrNilRecord
+	}
+	ctx, destTable, after, err := q.parent.beforeIngest(ctx, op, "merge", destTable, rec)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer func() { after.run(n, err) }()
+
+	q.parent.rlock()
+	defer q.parent.mu.RUnlock()
+	unlock, err := q.lockTable(ctx, destTable)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer unlock()
+
+	return q.ingestMergePolicy(ctx, destTable, rec, policy, q.inTransaction())
+}
+
+// ingestMergePolicy implements [Conn.IngestMergePolicy]. When inTx is
+// false, the schema changes and append are wrapped in their own
+// transaction. Caller must already hold the parent's RWMutex read lock
+// and the destination's table lock.
+func (q *Conn) ingestMergePolicy(ctx context.Context, destTable string, rec arrow.RecordBatch, policy SchemaPolicy, inTx bool) (int64, *SchemaChange, error) {
+	change := &SchemaChange{Table: destTable}
+	schema, _ := q.conn.GetTableSchema(ctx, q.catalogPtr(), q.dbSchemaPtr(), destTable)
+	if schema == nil {
+		change.Created = true
+		n, err := q.ingestWithMode(ctx, destTable, rec, adbc.OptionValueIngestModeCreate)
+		return n, change, err
+	}
+
+	_, endPlan := q.parent.startSpan(ctx, "couac.merge.plan", attribute.String("db.collection.name", destTable))
+	plan, err := planSchemaChange(destTable, schema, rec.Schema(), policy, change, q.commonTypeFunc(ctx))
+	endPlan(err)
+	if err != nil {
+		return 0, change, err
+	}
+
+	out := rec
+	if change.Reordered || len(change.Missing) > 0 || len(change.Added) > 0 {
+		out = plan.project(rec)
+		defer out.Release()
+	}
+
+	inTx = inTx || len(plan.ddl) == 0
+	if !inTx {
+		if _, err := q.execInternal(ctx, "BEGIN TRANSACTION"); err != nil {
+			return 0, change, fmt.Errorf("couac: begin transaction: %w", err)
+		}
+	}
+	fail := func(err error) (int64, *SchemaChange, error) {
+		if !inTx {
+			q.execInternal(context.WithoutCancel(ctx), "ROLLBACK")
+		}
+		return 0, change, err
+	}
+	if len(plan.ddl) > 0 {
+		evolveCtx, endEvolve := q.parent.startSpan(ctx, "couac.merge.evolve",
+			attribute.String("db.collection.name", destTable),
+			attribute.Int("couac.merge.added", len(change.Added)),
+			attribute.Int("couac.merge.widened", len(change.Widened)),
+			attribute.Int("couac.merge.dropped", len(change.Dropped)))
+		for _, ddl := range plan.ddl {
+			if _, err := q.execInternal(evolveCtx, ddl); err != nil {
+				err = fmt.Errorf("couac: evolve %s: %w", destTable, err)
+				endEvolve(err)
+				return fail(err)
+			}
+		}
+		endEvolve(nil)
+	}
+	appendCtx, endAppend := q.parent.startSpan(ctx, "couac.merge.append",
+		attribute.String("db.collection.name", destTable),
+		attribute.Int64("couac.ingest.rows", out.NumRows()))
+	n, err := q.ingestWithMode(appendCtx, destTable, out, adbc.OptionValueIngestModeAppend)
+	endAppend(err)
+	if err != nil {
+		return fail(err)
+	}
+	if !inTx {
+		if _, err := q.execInternal(ctx, "COMMIT"); err != nil {
+			return fail(fmt.Errorf("couac: commit: %w", err))
+		}
+	}
+	return n, change, nil
+}
+
+// schemaPlan is the outcome of diffing a batch against its target
+// table: the DDL to run and the column layout of the batch to append.
+type schemaPlan struct {
+	ddl     []string
+	columns []plannedColumn
+}
+
+// plannedColumn is one column of the appended batch, in table order.
+// src is the batch column index, or -1 to fill with NULL.
+type plannedColumn struct {
+	name string
+	src  int
+	typ  arrow.DataType
+}
+
+// planSchemaChange diffs the batch schema against the table schema,
+// recording the differences in change. common resolves the type that
+// columns of different kinds, or decimals and timestamps with different
+// parameters, are changed to. It returns an error wrapping
+// [ErrSchemaMismatch] if policy forbids any of them.
+func planSchemaChange(table string, tableSchema, batchSchema *arrow.Schema, policy SchemaPolicy, change *SchemaChange, common func(table, batch arrow.DataType) (arrow.DataType, error)) (*schemaPlan, error) {
+	quotedTable := quoteIdentifier(table)
+	plan := &schemaPlan{}
+	var conflicts []string
+	matched := make([]bool, batchSchema.NumFields())
+
+	for _, tf := range tableSchema.Fields() {
+		src := fieldIndexFold(batchSchema, tf.Name)
+		if src < 0 {
+			switch {
+			case policy&AllowDrop != 0:
+				change.Dropped = append(change.Dropped, tf.Name)
+				plan.ddl = append(plan.ddl, fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", quotedTable, quoteIdentifier(tf.Name)))
+			case policy == Strict:
+				conflicts = append(conflicts, fmt.Sprintf("column %q missing from batch", tf.Name))
+			default:
+				change.Missing = append(change.Missing, tf.Name)
+				plan.columns = append(plan.columns, plannedColumn{name: tf.Name, src: -1, typ: tf.Type})
+			}
+			continue
+		}
+		matched[src] = true
+		bf := batchSchema.Field(src)
+		// alter changes the column to type to, recording it as widened.
+		alter := func(to arrow.DataType) {
+			ddlType, err := duckdbColumnType(to)
+			if err != nil {
+				conflicts = append(conflicts, fmt.Sprintf("column %q: %v", tf.Name, err))
+				return
+			}
+			change.Widened = append(change.Widened, ColumnWidening{Name: tf.Name, From: tf.Type, To: to})
+			plan.ddl = append(plan.ddl, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s TYPE %s", quotedTable, quoteIdentifier(tf.Name), ddlType))
+		}
+		switch compareColumnTypes(tf.Type, bf.Type) {
+		case typeNarrower:
+			if policy == Strict {
+				conflicts = append(conflicts, fmt.Sprintf("column %q: batch type %s differs from table type %s", tf.Name, bf.Type, tf.Type))
+			}
+		case typeWider:
+			if policy&AllowWiden == 0 {
+				conflicts = append(conflicts, fmt.Sprintf("column %q: widening %s to %s not allowed", tf.Name, tf.Type, bf.Type))
+				break
+			}
+			alter(bf.Type)
+		case typeParams:
+			// DuckDB decides whether the table type holds the batch's
+			// values, e.g. DECIMAL(18,4) those of DECIMAL(10,2).
+			to, err := common(tf.Type, valueType(bf.Type))
+			if err != nil {
+				conflicts = append(conflicts, fmt.Sprintf("column %q: batch type %s incompatible with table type %s: %v", tf.Name, bf.Type, tf.Type, err))
+				break
+			}
+			if arrow.TypeEqual(to, tf.Type) {
+				if policy == Strict {
+					conflicts = append(conflicts, fmt.Sprintf("column %q: batch type %s differs from table type %s", tf.Name, bf.Type, tf.Type))
+				}
+				break
+			}
+			if policy&AllowWiden == 0 {
+				conflicts = append(conflicts, fmt.Sprintf("column %q: widening %s to %s not allowed", tf.Name, tf.Type, to))
+				break
+			}
+			alter(to)
+		case typeIncompatible:
+			if policy&AllowWiden == 0 {
+				conflicts = append(conflicts, fmt.Sprintf("column %q: batch type %s incompatible with table type %s", tf.Name, bf.Type, tf.Type))
+				break
+			}
+			to, err := common(tf.Type, valueType(bf.Type))
+			if err != nil {
+				conflicts = append(conflicts, fmt.Sprintf("column %q: batch type %s incompatible with table type %s: %v", tf.Name, bf.Type, tf.Type, err))
+				break
+			}
+			if arrow.TypeEqual(to, tf.Type) {
+				// DuckDB casts the batch column on append.
+				break
+			}
+			alter(to)
+		}
+		plan.columns = append(plan.columns, plannedColumn{name: tf.Name, src: src, typ: bf.Type})
+	}
+
+	// Columns new in the batch are added at the end of the table, in
+	// batch order.
+	for i, bf := range batchSchema.Fields() {
+		if matched[i] {
+			continue
+		}
+		if policy&AllowAdd == 0 {
+			conflicts = append(conflicts, fmt.Sprintf("column %q not in table", bf.Name))
+			continue
+		}
+		ddlType, err := duckdbColumnType(bf.Type)
+		if err != nil {
+			conflicts = append(conflicts, fmt.Sprintf("column %q: %v", bf.Name, err))
+			continue
+		}
+		change.Added = append(change.Added, bf)
+		plan.ddl = append(plan.ddl, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", quotedTable, quoteIdentifier(bf.Name), ddlType))
+		plan.columns = append(plan.columns, plannedColumn{name: bf.Name, src: i, typ: bf.Type})
+	}
+
+	next := 0
+	for _, c := range plan.columns {
+		if c.src < 0 {
+			continue
+		}
+		if c.src != next {
+			change.Reordered = true
+		}
+		next++
+	}
+
+	if len(conflicts) > 0 {
+		return nil, fmt.Errorf("couac: merge into %s: %w: %s", table, ErrSchemaMismatch, strings.Join(conflicts, "; "))
+	}
+	return plan, nil
+}
+
+// commonType returns the type DuckDB combines a table column type and
+// a batch column type of another kind into, as UNION BY NAME does.
+// Caller must already hold the parent's RWMutex read lock.
+func (q *Conn) commonType(ctx context.Context, table, batch arrow.DataType) (arrow.DataType, error) {
+	tableType, err := duckdbColumnType(table)
+	if err != nil {
+		return nil, err
+	}
+	batchType, err := duckdbColumnType(batch)
+	if err != nil {
+		return nil, err
+	}
+	schema, err := q.querySchemaInternal(ctx, fmt.Sprintf(
+		"SELECT NULL::%s AS c UNION ALL BY NAME SELECT NULL::%s AS c", tableType, batchType))
+	if err != nil {
+		return nil, err
+	}
+	return schema.Field(0).Type, nil
+}
+
+// commonTypeFunc returns [Conn.commonType] bound to ctx, as used by
+// planSchemaChange.
+func (q *Conn) commonTypeFunc(ctx context.Context) func(table, batch arrow.DataType) (arrow.DataType, error) {
+	return func(table, batch arrow.DataType) (arrow.DataType, error) {
+		return q.commonType(ctx, table, batch)
+	}
+}
+
+// project builds a batch laid out as the plan's columns, taking
+// columns from rec and filling the rest with NULL. The caller must
+// release the returned batch.
+func (p *schemaPlan) project(rec arrow.RecordBatch) arrow.RecordBatch {
+	fields := make([]arrow.Field, len(p.columns))
+	cols := make([]arrow.Array, len(p.columns))
+	for i, c := range p.columns {
+		fields[i] = arrow.Field{Name: c.name, Type: c.typ, Nullable: true}
+		if c.src >= 0 {
+			cols[i] = rec.Column(c.src)
+			continue
+		}
+		cols[i] = array.MakeArrayOfNull(memory.DefaultAllocator, c.typ, int(rec.NumRows()))
+		defer cols[i].Release()
+	}
+	return array.NewRecordBatch(arrow.NewSchema(fields, nil), cols, rec.NumRows())
+}
+
+// fieldIndexFold returns the index of the field named name in schema,
+// preferring an exact match over a case-insensitive one, or -1.
+func fieldIndexFold(schema *arrow.Schema, name string) int {
+	if idx := schema.FieldIndices(name); len(idx) > 0 {
+		return idx[0]
+	}
+	for i, f := range schema.Fields() {
+		if strings.EqualFold(f.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+type typeRelation int
+
+const (
+	typeSame typeRelation = iota
+	typeNarrower
+	typeWider
+	// typeParams is a type of the same kind with other parameters, such
+	// as the precision and scale of a decimal or the unit and time zone
+	// of a timestamp, which DuckDB resolves.
+	typeParams
+	typeIncompatible
+)
+
+// compareColumnTypes classifies a batch column type relative to the
+// table column type. Types of the same Arrow kind (e.g. string and
+// large string) are treated as the same, since DuckDB casts between
+// them on append, unless they are decimals or timestamps that map to
+// different DuckDB types.
+func compareColumnTypes(table, batch arrow.DataType) typeRelation {
+	batch = valueType(batch)
+	tk, bk := typeKind(table.ID()), typeKind(batch.ID())
+	if tk != bk {
+		return typeIncompatible
+	}
+	switch tk {
+	case arrow.DECIMAL128, arrow.DECIMAL256, arrow.TIMESTAMP:
+		tt, terr := duckdbColumnType(table)
+		bt, berr := duckdbColumnType(batch)
+		if terr != nil || berr != nil || tt != bt {
+			return typeParams
+		}
+		return typeSame
+	}
+	tr, br := widthRank(table.ID()), widthRank(batch.ID())
+	switch {
+	case br > tr:
+		return typeWider
+	case br < tr:
+		return typeNarrower
+	default:
+		return typeSame
+	}
+}
+
+// valueType returns the value type of a dictionary type, or dt.
+func valueType(dt arrow.DataType) arrow.DataType {
+	if dict, ok := dt.(*arrow.DictionaryType); ok {
+		return dict.ValueType
+	}
+	return dt
+}
+
+// typeKind groups Arrow type IDs that DuckDB can cast between without
+// loss of meaning. Numeric kinds are split by signedness so that
+// widening stays value-preserving.
+func typeKind(id arrow.Type) arrow.Type {
+	switch id {
+	case arrow.INT8, arrow.INT16, arrow.INT32, arrow.INT64:
+		return arrow.INT64
+	case arrow.UINT8, arrow.UINT16, arrow.UINT32, arrow.UINT64:
+		return arrow.UINT64
+	case arrow.FLOAT16, arrow.FLOAT32, arrow.FLOAT64:
+		return arrow.FLOAT64
+	case arrow.STRING, arrow.LARGE_STRING, arrow.STRING_VIEW:
+		return arrow.STRING
+	case arrow.BINARY, arrow.LARGE_BINARY, arrow.BINARY_VIEW:
+		return arrow.BINARY
+	case arrow.DATE32, arrow.DATE64:
+		return arrow.DATE32
+	case arrow.TIME32, arrow.TIME64:
+		return arrow.TIME64
+	case arrow.LIST, arrow.LARGE_LIST, arrow.LIST_VIEW, arrow.LARGE_LIST_VIEW:
+		return arrow.LIST
+	default:
+		return id
+	}
+}
+
+// widthRank orders the numeric types within a kind; all other types
+// rank equally.
+func widthRank(id arrow.Type) int {
+	switch id {
+	case arrow.INT8, arrow.UINT8:
+		return 1
+	case arrow.INT16, arrow.UINT16, arrow.FLOAT16:
+		return 2
+	case arrow.INT32, arrow.UINT32, arrow.FLOAT32:
+		return 3
+	case arrow.INT64, arrow.UINT64, arrow.FLOAT64:
+		return 4
+	default:
+		return 0
+	}
+}
+
+// duckdbColumnType returns the DuckDB DDL type for an Arrow type, as
+// used in ALTER TABLE statements.
+func duckdbColumnType(dt arrow.DataType) (string, error) {
+	switch t := dt.(type) {
+	case *arrow.Decimal128Type:
+		return fmt.Sprintf("DECIMAL(%d,%d)", t.Precision, t.Scale), nil
+	case *arrow.Decimal256Type:
+		return fmt.Sprintf("DECIMAL(%d,%d)", t.Precision, t.Scale), nil
+	case *arrow.TimestampType:
+		if t.TimeZone != "" {
+			return "TIMESTAMPTZ", nil
+		}
+		switch t.Unit {
+		case arrow.Second:
+			return "TIMESTAMP_S", nil
+		case arrow.Millisecond:
+			return "TIMESTAMP_MS", nil
+		case arrow.Nanosecond:
+			return "TIMESTAMP_NS", nil
+		default:
+			return "TIMESTAMP", nil
+		}
+	case *arrow.MapType:
+		key, err := duckdbColumnType(t.KeyType())
+		if err != nil {
+			return "", err
+		}
+		val, err := duckdbColumnType(t.ItemType())
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("MAP(%s, %s)", key, val), nil
+	case *arrow.FixedSizeListType:
+		elem, err := duckdbColumnType(t.Elem())
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s[%d]", elem, t.Len()), nil
+	case arrow.ListLikeType:
+		elem, err := duckdbColumnType(t.Elem())
+		if err != nil {
+			return "", err
+		}
+		return elem + "[]", nil
+	case *arrow.StructType:
+		parts := make([]string, t.NumFields())
+		for i, f := range t.Fields() {
+			ft, err := duckdbColumnType(f.Type)
+			if err != nil {
+				return "", err
+			}
+			parts[i] = quoteIdentifier(f.Name) + " " + ft
+		}
+		return "STRUCT(" + strings.Join(parts, ", ") + ")", nil
+	case *arrow.DictionaryType:
+		return duckdbColumnType(t.ValueType)
+	}
+
+	switch dt.ID() {
+	case arrow.BOOL, arrow.INT8, arrow.INT16, arrow.INT32, arrow.INT64,
+		arrow.UINT8, arrow.UINT16, arrow.UINT32, arrow.UINT64,
+		arrow.FLOAT16, arrow.FLOAT32, arrow.FLOAT64,
+		arrow.DATE32, arrow.DATE64, arrow.TIME32, arrow.TIME64,
+		arrow.DURATION, arrow.INTERVAL_MONTHS, arrow.INTERVAL_DAY_TIME, arrow.INTERVAL_MONTH_DAY_NANO:
+		return arrowToDatabaseTypeName(dt), nil
+	case arrow.STRING, arrow.LARGE_STRING, arrow.STRING_VIEW:
+		return "VARCHAR", nil
+	case arrow.BINARY, arrow.LARGE_BINARY, arrow.BINARY_VIEW, arrow.FIXED_SIZE_BINARY:
+		return "BLOB", nil
+	default:
+		return "", fmt.Errorf("no DuckDB column type for Arrow type %s", dt)
+	}
+}
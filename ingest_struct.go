@@ -0,0 +1,395 @@
+package couac
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+)
+
+// Default precision and scale for [Decimal] fields without
+// precision=/scale= tag options.
+const (
+	defaultDecimalPrecision = 38
+	defaultDecimalScale     = 9
+)
+
+// IngestSlice ingests a slice of Go structs into destTable through
+// [Conn.Ingest], creating the table if it does not exist or appending
+// if it does. The Arrow schema is derived from T with [RecordFromSlice].
+//
+// Example:
+//
+//	type Event struct {
+//	    ID    int64     `couac:"id"`
+//	    At    time.Time `couac:"at"`
+//	    Note  *string   `couac:"note"`
+//	    Tags  []string  `couac:"tags"`
+//	}
+//	n, err := couac.IngestSlice(ctx, conn, "events", events)
+func IngestSlice[T any](ctx context.Context, conn *Conn, destTable string, rows []T) (int64, error) {
+	rec, err := RecordFromSlice(rows)
+	if err != nil {
+		return 0, err
+	}
+	defer rec.Release()
+	return conn.Ingest(ctx, destTable, rec)
+}
+
+// IngestSliceMerge is like [IngestSlice] but routes through
+// [Conn.IngestMerge], so fields added to T over time are added to the
+// destination table as new columns.
+func IngestSliceMerge[T any](ctx context.Context, conn *Conn, destTable string, rows []T) (int64, error) {
+	rec, err := RecordFromSlice(rows)
+	if err != nil {
+		return 0, err
+	}
+	defer rec.Release()
+	return conn.IngestMerge(ctx, destTable, rec)
+}
+
+// RecordFromSlice converts a slice of structs into an Arrow record batch
+// with one row per element. The caller must release the returned record.
+//
+// Columns are derived from T's fields with the same `couac` tag rules
+// as [QueryAs]: `couac:"name"` sets the column name, `couac:"-"` skips
+// the field, and fields of embedded structs are promoted. Go types map
+// to Arrow types as follows:
+//
+//	bool                 → Boolean
+//	int, int64           → Int64 (int8/16/32 keep their width)
+//	uint, uint64         → Uint64 (uint8/16/32 keep their width)
+//	float32, float64     → Float32, Float64
+//	string               → String (Utf8)
+//	[]byte               → Binary
+//	time.Time            → Timestamp(µs, UTC)
+//	Decimal, NullDecimal → Decimal128(precision, scale)
+//	*T                   → T, NULL when nil
+//	[]T, [N]T            → List<T>, NULL when the slice is nil
+//	struct               → Struct (fields follow the same tag rules)
+//	map[K]V              → Map<K, V>, NULL when the map is nil
+//
+// Decimal columns use DECIMAL(38, 9) unless the field's tag supplies
+// precision and scale options, e.g. `couac:"price,precision=18,scale=4"`.
+// Values are rescaled to the column scale; a value that cannot be
+// represented exactly returns an error.
+//
+// All columns are nullable, matching the columns DuckDB creates.
+func RecordFromSlice[T any](rows []T) (arrow.RecordBatch, error) {
+	typ := reflect.TypeFor[T]()
+	ptr := false
+	if typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+		ptr = true
+	}
+	if !isScanStruct(typ) {
+		return nil, fmt.Errorf("couac: cannot derive a schema from %s; use a struct type", typ)
+	}
+	schema, err := structSchema(typ)
+	if err != nil {
+		return nil, err
+	}
+
+	bldr := array.NewRecordBuilder(memory.DefaultAllocator, schema)
+	defer bldr.Release()
+
+	info := structInfoFor(typ)
+	for i := range rows {
+		rv := reflect.ValueOf(&rows[i]).Elem()
+		if ptr {
+			if rv.IsNil() {
+				return nil, fmt.Errorf("couac: nil element at index %d", i)
+			}
+			rv = rv.Elem()
+		}
+		for fi, f := range info.fields {
+			fv, ok := fieldByIndexNoAlloc(rv, f.index)
+			if err := appendGoValue(bldr.Field(fi), fv, ok, f.opts); err != nil {
+				return nil, fmt.Errorf("couac: row %d field %q: %w", i, f.name, err)
+			}
+		}
+	}
+	return bldr.NewRecordBatch(), nil
+}
+
+// structSchema derives the Arrow schema for a struct type.
+func structSchema(typ reflect.Type) (*arrow.Schema, error) {
+	fields, err := structArrowFields(typ, map[reflect.Type]bool{})
+	if err != nil {
+		return nil, err
+	}
+	return arrow.NewSchema(fields, nil), nil
+}
+
+// structArrowFields derives one nullable Arrow field per bound field of
+// typ. visiting holds the struct types being derived, so that recursive
+// types such as linked list nodes are rejected rather than expanded
+// forever.
+func structArrowFields(typ reflect.Type, visiting map[reflect.Type]bool) ([]arrow.Field, error) {
+	if visiting[typ] {
+		return nil, fmt.Errorf("couac: recursive type %s is not supported", typ)
+	}
+	visiting[typ] = true
+	defer delete(visiting, typ)
+
+	info := structInfoFor(typ)
+	if len(info.fields) == 0 {
+		return nil, fmt.Errorf("couac: %s has no exported fields", typ)
+	}
+	fields := make([]arrow.Field, len(info.fields))
+	for i, f := range info.fields {
+		dt, err := goToArrowType(f.typ, f.opts, visiting)
+		if err != nil {
+			return nil, fmt.Errorf("couac: field %q: %w", f.name, err)
+		}
+		fields[i] = arrow.Field{Name: f.name, Type: dt, Nullable: true}
+	}
+	return fields, nil
+}
+
+// goToArrowType maps a Go type to its Arrow data type. opts are the
+// `couac` tag options of the field, used for decimal precision/scale,
+// and visiting the struct types being derived.
+func goToArrowType(typ reflect.Type, opts string, visiting map[reflect.Type]bool) (arrow.DataType, error) {
+	switch typ {
+	case timeType:
+		return &arrow.TimestampType{Unit: arrow.Microsecond, TimeZone: "UTC"}, nil
+	case reflect.TypeFor[Decimal](), reflect.TypeFor[NullDecimal]():
+		return decimalTypeFromOpts(opts)
+	case bytesType:
+		return arrow.BinaryTypes.Binary, nil
+	}
+
+	switch typ.Kind() {
+	case reflect.Pointer:
+		return goToArrowType(typ.Elem(), opts, visiting)
+	case reflect.Bool:
+		return arrow.FixedWidthTypes.Boolean, nil
+	case reflect.Int8:
+		return arrow.PrimitiveTypes.Int8, nil
+	case reflect.Int16:
+		return arrow.PrimitiveTypes.Int16, nil
+	case reflect.Int32:
+		return arrow.PrimitiveTypes.Int32, nil
+	case reflect.Int, reflect.Int64:
+		return arrow.PrimitiveTypes.Int64, nil
+	case reflect.Uint8:
+		return arrow.PrimitiveTypes.Uint8, nil
+	case reflect.Uint16:
+		return arrow.PrimitiveTypes.Uint16, nil
+	case reflect.Uint32:
+		return arrow.PrimitiveTypes.Uint32, nil
+	case reflect.Uint, reflect.Uint64:
+		return arrow.PrimitiveTypes.Uint64, nil
+	case reflect.Float32:
+		return arrow.PrimitiveTypes.Float32, nil
+	case reflect.Float64:
+		return arrow.PrimitiveTypes.Float64, nil
+	case reflect.String:
+		return arrow.BinaryTypes.String, nil
+	case reflect.Slice, reflect.Array:
+		if typ.Kind() == reflect.Slice && typ.Elem().Kind() == reflect.Uint8 {
+			return arrow.BinaryTypes.Binary, nil
+		}
+		elem, err := goToArrowType(typ.Elem(), opts, visiting)
+		if err != nil {
+			return nil, err
+		}
+		return arrow.ListOf(elem), nil
+	case reflect.Map:
+		key, err := goToArrowType(typ.Key(), "", visiting)
+		if err != nil {
+			return nil, err
+		}
+		item, err := goToArrowType(typ.Elem(), opts, visiting)
+		if err != nil {
+			return nil, err
+		}
+		return arrow.MapOf(key, item), nil
+	case reflect.Struct:
+		if !isScanStruct(typ) {
+			break
+		}
+		fields, err := structArrowFields(typ, visiting)
+		if err != nil {
+			return nil, err
+		}
+		return arrow.StructOf(fields...), nil
+	}
+	return nil, fmt.Errorf("unsupported Go type %s", typ)
+}
+
+// decimalTypeFromOpts builds a Decimal128 type from precision= and
+// scale= tag options, falling back to the defaults.
+func decimalTypeFromOpts(opts string) (*arrow.Decimal128Type, error) {
+	dt := &arrow.Decimal128Type{Precision: defaultDecimalPrecision, Scale: defaultDecimalScale}
+	for opt := range strings.SplitSeq(opts, ",") {
+		key, val, ok := strings.Cut(opt, "=")
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(val)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s option %q", key, val)
+		}
+		switch key {
+		case "precision":
+			dt.Precision = int32(n)
+		case "scale":
+			dt.Scale = int32(n)
+		}
+	}
+	if dt.Precision < 1 || dt.Precision > 38 || dt.Scale < 0 || dt.Scale > dt.Precision {
+		return nil, fmt.Errorf("invalid decimal precision/scale (%d, %d)", dt.Precision, dt.Scale)
+	}
+	return dt, nil
+}
+
+// fieldByIndexNoAlloc walks index from v without allocating; ok is
+// false when a nil embedded pointer is encountered.
+func fieldByIndexNoAlloc(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// appendGoValue appends v to b, or NULL when valid is false or v is a
+// nil pointer, slice, or map.
+func appendGoValue(b array.Builder, v reflect.Value, valid bool, opts string) error {
+	if !valid {
+		b.AppendNull()
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Map:
+		if v.IsNil() {
+			b.AppendNull()
+			return nil
+		}
+	}
+	if v.Kind() == reflect.Pointer {
+		return appendGoValue(b, v.Elem(), true, opts)
+	}
+
+	switch b := b.(type) {
+	case *array.BooleanBuilder:
+		b.Append(v.Bool())
+	case *array.Int8Builder:
+		b.Append(int8(v.Int()))
+	case *array.Int16Builder:
+		b.Append(int16(v.Int()))
+	case *array.Int32Builder:
+		b.Append(int32(v.Int()))
+	case *array.Int64Builder:
+		b.Append(v.Int())
+	case *array.Uint8Builder:
+		b.Append(uint8(v.Uint()))
+	case *array.Uint16Builder:
+		b.Append(uint16(v.Uint()))
+	case *array.Uint32Builder:
+		b.Append(uint32(v.Uint()))
+	case *array.Uint64Builder:
+		b.Append(v.Uint())
+	case *array.Float32Builder:
+		b.Append(float32(v.Float()))
+	case *array.Float64Builder:
+		b.Append(v.Float())
+	case *array.StringBuilder:
+		b.Append(v.String())
+	case *array.BinaryBuilder:
+		b.Append(v.Bytes())
+	case *array.TimestampBuilder:
+		b.Append(arrow.Timestamp(v.Interface().(time.Time).UTC().UnixMicro()))
+	case *array.Decimal128Builder:
+		var d Decimal
+		switch dv := v.Interface().(type) {
+		case Decimal:
+			d = dv
+		case NullDecimal:
+			if !dv.Valid {
+				b.AppendNull()
+				return nil
+			}
+			d = dv.Decimal
+		}
+		unscaled, err := rescaleDecimal(d, b.Type().(*arrow.Decimal128Type))
+		if err != nil {
+			return err
+		}
+		b.Append(decimal128FromBigInt(unscaled))
+	case *array.ListBuilder:
+		b.Append(true)
+		for i := range v.Len() {
+			if err := appendGoValue(b.ValueBuilder(), v.Index(i), true, opts); err != nil {
+				return fmt.Errorf("element %d: %w", i, err)
+			}
+		}
+	case *array.MapBuilder:
+		b.Append(true)
+		keys := v.MapKeys()
+		slices.SortFunc(keys, func(a, b reflect.Value) int {
+			return strings.Compare(fmt.Sprint(a.Interface()), fmt.Sprint(b.Interface()))
+		})
+		for _, k := range keys {
+			if err := appendGoValue(b.KeyBuilder(), k, true, ""); err != nil {
+				return fmt.Errorf("key %v: %w", k, err)
+			}
+			if err := appendGoValue(b.ItemBuilder(), v.MapIndex(k), true, opts); err != nil {
+				return fmt.Errorf("key %v: %w", k, err)
+			}
+		}
+	case *array.StructBuilder:
+		b.Append(true)
+		for fi, f := range structInfoFor(v.Type()).fields {
+			fv, ok := fieldByIndexNoAlloc(v, f.index)
+			if err := appendGoValue(b.FieldBuilder(fi), fv, ok, f.opts); err != nil {
+				return fmt.Errorf("field %q: %w", f.name, err)
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported Arrow builder %T", b)
+	}
+	return nil
+}
+
+// rescaleDecimal returns the unscaled value of d at the scale of dt,
+// failing if that would drop non-zero digits or if the result has more
+// digits than the precision of dt.
+func rescaleDecimal(d Decimal, dt *arrow.Decimal128Type) (*big.Int, error) {
+	if d.Unscaled == nil {
+		return new(big.Int), nil
+	}
+	q := d.Unscaled
+	switch diff := int64(dt.Scale) - int64(d.Scale); {
+	case diff > 0:
+		mul := new(big.Int).Exp(big.NewInt(10), big.NewInt(diff), nil)
+		q = new(big.Int).Mul(d.Unscaled, mul)
+	case diff < 0:
+		div := new(big.Int).Exp(big.NewInt(10), big.NewInt(-diff), nil)
+		var r big.Int
+		q, _ = new(big.Int).QuoRem(d.Unscaled, div, &r)
+		if r.Sign() != 0 {
+			return nil, fmt.Errorf("decimal %s does not fit scale %d", d, dt.Scale)
+		}
+	}
+	limit := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(dt.Precision)), nil)
+	if q.CmpAbs(limit) >= 0 {
+		return nil, fmt.Errorf("decimal %s does not fit precision %d", d, dt.Precision)
+	}
+	return q, nil
+}
@@ -0,0 +1,175 @@
+package couac_test
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/loicalleyne/couac"
+)
+
+type ingestItem struct {
+	Name  string `couac:"name"`
+	Count int32  `couac:"count"`
+}
+
+type ingestBase struct {
+	ID int64 `couac:"id"`
+}
+
+type ingestEvent struct {
+	ingestBase
+	At     time.Time         `couac:"at"`
+	Note   *string           `couac:"note"`
+	Price  couac.Decimal     `couac:"price,precision=10,scale=2"`
+	Tags   []string          `couac:"tags"`
+	Item   ingestItem        `couac:"item"`
+	Labels map[string]string `couac:"labels"`
+	Skip   string            `couac:"-"`
+}
+
+func TestRecordFromSlice_Schema(t *testing.T) {
+	rec, err := couac.RecordFromSlice([]ingestEvent{{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rec.Release()
+
+	want := []string{"id", "at", "note", "price", "tags", "item", "labels"}
+	schema := rec.Schema()
+	if schema.NumFields() != len(want) {
+		t.Fatalf("expected %d fields, got %s", len(want), schema)
+	}
+	for i, name := range want {
+		if schema.Field(i).Name != name {
+			t.Errorf("field %d: expected %q, got %q", i, name, schema.Field(i).Name)
+		}
+	}
+	if got := schema.Field(3).Type.String(); got != "decimal(10, 2)" {
+		t.Errorf("expected decimal(10, 2), got %s", got)
+	}
+}
+
+func TestRecordFromSlice_Unsupported(t *testing.T) {
+	type bad struct {
+		C chan int
+	}
+	if _, err := couac.RecordFromSlice([]bad{{}}); err == nil {
+		t.Error("expected error for unsupported field type")
+	}
+	if _, err := couac.RecordFromSlice([]int{1}); err == nil {
+		t.Error("expected error for non-struct element type")
+	}
+
+	type node struct {
+		V    int
+		Next *node
+	}
+	if _, err := couac.RecordFromSlice([]node{{V: 1}}); err == nil || !strings.Contains(err.Error(), "recursive") {
+		t.Errorf("expected error for recursive type, got %v", err)
+	}
+}
+
+func TestRecordFromSlice_DecimalScale(t *testing.T) {
+	type priced struct {
+		P couac.Decimal `couac:"p,precision=10,scale=2"`
+	}
+	// 1.234 cannot be represented at scale 2.
+	_, err := couac.RecordFromSlice([]priced{{P: couac.Decimal{Scale: 3, Unscaled: big.NewInt(1234)}}})
+	if err == nil {
+		t.Error("expected error when a decimal loses digits")
+	}
+
+	// 123456789.5 needs 11 digits at scale 2.
+	_, err = couac.RecordFromSlice([]priced{{P: couac.Decimal{Scale: 1, Unscaled: big.NewInt(1234567895)}}})
+	if err == nil || !strings.Contains(err.Error(), "precision") {
+		t.Errorf("expected error when a decimal exceeds its precision, got %v", err)
+	}
+	if _, err := couac.RecordFromSlice([]priced{{P: couac.Decimal{Scale: 2, Unscaled: big.NewInt(9999999999)}}}); err != nil {
+		t.Errorf("expected the largest decimal(10, 2) to fit, got %v", err)
+	}
+}
+
+func TestIngestSlice_RoundTrip(t *testing.T) {
+	_, conn := newTestConn(t)
+	ctx := context.Background()
+
+	note := "hello"
+	at := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	events := []ingestEvent{
+		{
+			ingestBase: ingestBase{ID: 1},
+			At:         at,
+			Note:       &note,
+			Price:      couac.Decimal{Scale: 1, Unscaled: big.NewInt(125)},
+			Tags:       []string{"a", "b"},
+			Item:       ingestItem{Name: "widget", Count: 3},
+			Labels:     map[string]string{"env": "prod"},
+		},
+		{ingestBase: ingestBase{ID: 2}, At: at},
+	}
+	if _, err := couac.IngestSlice(ctx, conn, "ingest_events", events); err != nil {
+		t.Fatalf("IngestSlice: %v", err)
+	}
+
+	got, err := couac.QueryAs[ingestEvent](ctx, conn, "SELECT * FROM ingest_events ORDER BY id")
+	if err != nil {
+		t.Fatalf("QueryAs: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected 2 rows, got %d", len(got))
+	}
+	e := got[0]
+	if e.ID != 1 || !e.At.Equal(at) || e.Note == nil || *e.Note != "hello" {
+		t.Errorf("unexpected scalar fields: %+v", e)
+	}
+	if e.Price.String() != "12.50" {
+		t.Errorf("expected price 12.50, got %s", e.Price)
+	}
+	if len(e.Tags) != 2 || e.Item.Name != "widget" || e.Item.Count != 3 || e.Labels["env"] != "prod" {
+		t.Errorf("unexpected nested fields: %+v", e)
+	}
+	if got[1].Note != nil || got[1].Tags != nil {
+		t.Errorf("expected NULL note and tags, got %+v", got[1])
+	}
+
+	// A second call appends.
+	if _, err := couac.IngestSlice(ctx, conn, "ingest_events", events[:1]); err != nil {
+		t.Fatalf("IngestSlice append: %v", err)
+	}
+	ids, err := couac.QueryAs[int64](ctx, conn, "SELECT count(*) FROM ingest_events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids[0] != 3 {
+		t.Errorf("expected 3 rows after append, got %d", ids[0])
+	}
+}
+
+func TestIngestSliceMerge_NewField(t *testing.T) {
+	_, conn := newTestConn(t)
+	ctx := context.Background()
+
+	type v1 struct {
+		ID int64 `couac:"id"`
+	}
+	type v2 struct {
+		ID    int64  `couac:"id"`
+		Email string `couac:"email"`
+	}
+	if _, err := couac.IngestSliceMerge(ctx, conn, "ingest_merge_slice", []v1{{ID: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := couac.IngestSliceMerge(ctx, conn, "ingest_merge_slice", []v2{{ID: 2, Email: "x@y.z"}}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := couac.QueryAs[v2](ctx, conn, "SELECT * FROM ingest_merge_slice ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[1].Email != "x@y.z" {
+		t.Errorf("unexpected rows: %+v", got)
+	}
+}
@@ -2,11 +2,15 @@ package couac_test
 
 import (
 	"context"
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/apache/arrow-go/v18/arrow"
 	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/decimal128"
 	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/loicalleyne/couac"
 )
 
 func makeTestRecord(t *testing.T, nRows int) arrow.RecordBatch {
@@ -170,6 +174,291 @@ func TestIngestMerge_SchemaEvolution(t *testing.T) {
 	}
 }
 
+func TestIngestMergePolicy_AddWidenReorder(t *testing.T) {
+	_, conn := newTestConn(t)
+	ctx := context.Background()
+
+	rec1 := makeTestRecord(t, 2) // id INTEGER, name VARCHAR
+	defer rec1.Release()
+	if _, err := conn.IngestMerge(ctx, "evolve_test", rec1); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reordered columns, id widened to BIGINT, new column age.
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "age", Type: arrow.PrimitiveTypes.Int16},
+		{Name: "NAME", Type: arrow.BinaryTypes.String},
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64},
+	}, nil)
+	bldr := array.NewRecordBuilder(memory.DefaultAllocator, schema)
+	defer bldr.Release()
+	bldr.Field(0).(*array.Int16Builder).Append(42)
+	bldr.Field(1).(*array.StringBuilder).Append("big")
+	bldr.Field(2).(*array.Int64Builder).Append(1 << 40)
+	rec2 := bldr.NewRecordBatch()
+	defer rec2.Release()
+
+	_, change, err := conn.IngestMergePolicy(ctx, "evolve_test", rec2, couac.DefaultSchemaPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !change.Reordered || !change.Altered() || change.Created {
+		t.Errorf("unexpected change: %+v", change)
+	}
+	if len(change.Added) != 1 || change.Added[0].Name != "age" {
+		t.Errorf("expected age to be added, got %v", change.Added)
+	}
+	if len(change.Widened) != 1 || change.Widened[0].Name != "id" || change.Widened[0].To.ID() != arrow.INT64 {
+		t.Errorf("expected id to be widened to int64, got %v", change.Widened)
+	}
+
+	got, err := conn.TableSchema(ctx, "evolve_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"id:int64", "name:utf8", "age:int16"}
+	if got.NumFields() != len(want) {
+		t.Fatalf("unexpected table schema: %s", got)
+	}
+	for i, f := range got.Fields() {
+		if f.Name+":"+f.Type.String() != want[i] {
+			t.Errorf("column %d: expected %s, got %s:%s", i, want[i], f.Name, f.Type)
+		}
+	}
+
+	type row struct {
+		ID   int64  `couac:"id"`
+		Name string `couac:"name"`
+		Age  *int16 `couac:"age"`
+	}
+	rows, err := couac.QueryAs[row](ctx, conn, "SELECT * FROM evolve_test ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || rows[0].Age != nil || rows[2].ID != 1<<40 || rows[2].Name != "big" || *rows[2].Age != 42 {
+		t.Errorf("unexpected rows: %+v", rows)
+	}
+}
+
+func TestIngestMerge_CrossKindCoercion(t *testing.T) {
+	_, conn := newTestConn(t)
+	ctx := context.Background()
+
+	rec1 := makeTestRecord(t, 2) // id INTEGER, name VARCHAR
+	defer rec1.Release()
+	if _, err := conn.IngestMerge(ctx, "coerce_test", rec1); err != nil {
+		t.Fatal(err)
+	}
+
+	record := func(idType arrow.DataType, appendID func(array.Builder)) arrow.RecordBatch {
+		schema := arrow.NewSchema([]arrow.Field{
+			{Name: "id", Type: idType},
+			{Name: "name", Type: arrow.BinaryTypes.String},
+		}, nil)
+		bldr := array.NewRecordBuilder(memory.DefaultAllocator, schema)
+		defer bldr.Release()
+		appendID(bldr.Field(0))
+		bldr.Field(1).(*array.StringBuilder).Append("x")
+		return bldr.NewRecordBatch()
+	}
+	idType := func() arrow.DataType {
+		got, err := conn.TableSchema(ctx, "coerce_test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got.Field(0).Type
+	}
+
+	doubles := record(arrow.PrimitiveTypes.Float64, func(b array.Builder) { b.(*array.Float64Builder).Append(2.5) })
+	defer doubles.Release()
+	if _, _, err := conn.IngestMergePolicy(ctx, "coerce_test", doubles, couac.AllowAdd); !errors.Is(err, couac.ErrSchemaMismatch) {
+		t.Fatalf("expected ErrSchemaMismatch without AllowWiden, got %v", err)
+	}
+	if _, err := conn.IngestMerge(ctx, "coerce_test", doubles); err != nil {
+		t.Fatalf("INTEGER to DOUBLE: %v", err)
+	}
+	if got := idType(); got.ID() != arrow.FLOAT64 {
+		t.Errorf("expected id to become DOUBLE, got %s", got)
+	}
+
+	strs := record(arrow.BinaryTypes.String, func(b array.Builder) { b.(*array.StringBuilder).Append("abc") })
+	defer strs.Release()
+	_, change, err := conn.IngestMergePolicy(ctx, "coerce_test", strs, couac.DefaultSchemaPolicy)
+	if err != nil {
+		t.Fatalf("DOUBLE to VARCHAR: %v", err)
+	}
+	if len(change.Widened) != 1 || change.Widened[0].To.ID() != arrow.STRING {
+		t.Errorf("expected id to be widened to VARCHAR, got %v", change.Widened)
+	}
+	if got := idType(); got.ID() != arrow.STRING {
+		t.Errorf("expected id to become VARCHAR, got %s", got)
+	}
+	n, err := couac.QueryAs[int64](ctx, conn, "SELECT count(*) FROM coerce_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n[0] != 4 {
+		t.Errorf("expected 4 rows, got %d", n[0])
+	}
+}
+
+func TestIngestMerge_DecimalAndTimestampParams(t *testing.T) {
+	_, conn := newTestConn(t)
+	ctx := context.Background()
+
+	record := func(dec, ts arrow.DataType, d int64) arrow.RecordBatch {
+		schema := arrow.NewSchema([]arrow.Field{
+			{Name: "d", Type: dec},
+			{Name: "ts", Type: ts},
+		}, nil)
+		bldr := array.NewRecordBuilder(memory.DefaultAllocator, schema)
+		defer bldr.Release()
+		bldr.Field(0).(*array.Decimal128Builder).Append(decimal128.FromI64(d))
+		bldr.Field(1).(*array.TimestampBuilder).Append(arrow.Timestamp(1_700_000_000_000_000))
+		return bldr.NewRecordBatch()
+	}
+	dec10 := &arrow.Decimal128Type{Precision: 10, Scale: 2}
+	dec18 := &arrow.Decimal128Type{Precision: 18, Scale: 4}
+	ts := &arrow.TimestampType{Unit: arrow.Microsecond}
+	tstz := &arrow.TimestampType{Unit: arrow.Microsecond, TimeZone: "UTC"}
+
+	rec1 := record(dec10, ts, 150) // 1.50
+	defer rec1.Release()
+	if _, err := conn.IngestMerge(ctx, "params_test", rec1); err != nil {
+		t.Fatal(err)
+	}
+
+	rec2 := record(dec18, tstz, 12345) // 1.2345
+	defer rec2.Release()
+	for _, policy := range []couac.SchemaPolicy{couac.Strict, couac.AllowAdd} {
+		if _, _, err := conn.IngestMergePolicy(ctx, "params_test", rec2, policy); !errors.Is(err, couac.ErrSchemaMismatch) {
+			t.Fatalf("policy %d: expected ErrSchemaMismatch, got %v", policy, err)
+		}
+	}
+	_, change, err := conn.IngestMergePolicy(ctx, "params_test", rec2, couac.DefaultSchemaPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(change.Widened) != 2 {
+		t.Fatalf("expected d and ts to be widened, got %v", change.Widened)
+	}
+	got, err := conn.TableSchema(ctx, "params_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d, ok := got.Field(0).Type.(*arrow.Decimal128Type); !ok || d.Precision != 18 || d.Scale != 4 {
+		t.Errorf("expected d to become DECIMAL(18,4), got %s", got.Field(0).Type)
+	}
+	if tt, ok := got.Field(1).Type.(*arrow.TimestampType); !ok || tt.TimeZone == "" {
+		t.Errorf("expected ts to become TIMESTAMPTZ, got %s", got.Field(1).Type)
+	}
+	vals, err := couac.QueryAs[string](ctx, conn, "SELECT d::VARCHAR FROM params_test ORDER BY d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vals) != 2 || vals[0] != "1.2345" || vals[1] != "1.5000" {
+		t.Errorf("unexpected values %v", vals)
+	}
+
+	// A narrower decimal fits the widened column without a change.
+	rec3 := record(dec10, tstz, 275)
+	defer rec3.Release()
+	if _, _, err := conn.IngestMergePolicy(ctx, "params_test", rec3, couac.Strict); !errors.Is(err, couac.ErrSchemaMismatch) {
+		t.Fatalf("expected ErrSchemaMismatch under Strict, got %v", err)
+	}
+	_, change, err = conn.IngestMergePolicy(ctx, "params_test", rec3, couac.AllowAdd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if change.Altered() {
+		t.Errorf("expected no change, got %+v", change)
+	}
+}
+
+func TestIngestMergePolicy_Strict(t *testing.T) {
+	_, conn := newTestConn(t)
+	ctx := context.Background()
+
+	rec1 := makeTestRecord(t, 2)
+	defer rec1.Release()
+	if _, err := conn.Ingest(ctx, "strict_test", rec1); err != nil {
+		t.Fatal(err)
+	}
+
+	// Same columns in another order are accepted.
+	reordered := array.NewRecordBatch(arrow.NewSchema([]arrow.Field{
+		rec1.Schema().Field(1), rec1.Schema().Field(0),
+	}, nil), []arrow.Array{rec1.Column(1), rec1.Column(0)}, rec1.NumRows())
+	defer reordered.Release()
+	if _, _, err := conn.IngestMergePolicy(ctx, "strict_test", reordered, couac.Strict); err != nil {
+		t.Fatalf("reordered batch: %v", err)
+	}
+
+	rec2 := makeTestRecordExtended(t, 1)
+	defer rec2.Release()
+	_, change, err := conn.IngestMergePolicy(ctx, "strict_test", rec2, couac.Strict)
+	if !errors.Is(err, couac.ErrSchemaMismatch) {
+		t.Fatalf("expected ErrSchemaMismatch, got %v", err)
+	}
+	if change.Altered() {
+		t.Errorf("rejected ingest should not report applied changes: %+v", change)
+	}
+	cols, err := conn.Describe(ctx, "strict_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cols) != 2 {
+		t.Errorf("expected table to keep 2 columns, got %d", len(cols))
+	}
+}
+
+func TestIngestMergePolicy_MissingAndDrop(t *testing.T) {
+	_, conn := newTestConn(t)
+	ctx := context.Background()
+
+	rec1 := makeTestRecordExtended(t, 2) // id, name, age
+	defer rec1.Release()
+	if _, err := conn.Ingest(ctx, "drop_test", rec1); err != nil {
+		t.Fatal(err)
+	}
+
+	rec2 := makeTestRecord(t, 1) // id, name
+	defer rec2.Release()
+	_, change, err := conn.IngestMergePolicy(ctx, "drop_test", rec2, couac.AllowAdd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(change.Missing) != 1 || change.Missing[0] != "age" || change.Altered() {
+		t.Errorf("expected age to be filled with NULL, got %+v", change)
+	}
+
+	_, change, err = conn.IngestMergePolicy(ctx, "drop_test", rec2, couac.AllowDrop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(change.Dropped) != 1 || change.Dropped[0] != "age" {
+		t.Errorf("expected age to be dropped, got %+v", change)
+	}
+	cols, err := conn.Describe(ctx, "drop_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cols) != 2 {
+		t.Errorf("expected 2 columns after drop, got %d", len(cols))
+	}
+
+	res, err := conn.Query(ctx, "SELECT count(*) FROM drop_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Close()
+	if res.Reader.Next() {
+		if count := res.Reader.RecordBatch().Column(0).ValueStr(0); count != "4" {
+			t.Errorf("expected 4 rows, got %s", count)
+		}
+	}
+}
+
 func TestIngestReplace(t *testing.T) {
 	_, conn := newTestConn(t)
 	ctx := context.Background()
@@ -233,3 +522,200 @@ func TestIngestStream(t *testing.T) {
 		t.Errorf("expected 10 rows, got %d", n)
 	}
 }
+
+// endlessReader yields the same record batch until released.
+type endlessReader struct {
+	array.RecordReader
+	rec arrow.RecordBatch
+}
+
+func (r *endlessReader) Next() bool                     { return true }
+func (r *endlessReader) RecordBatch() arrow.RecordBatch { return r.rec }
+func (r *endlessReader) Record() arrow.RecordBatch      { return r.rec }
+func (r *endlessReader) Err() error                     { return nil }
+
+func TestIngestStream_ContextCancel(t *testing.T) {
+	_, conn := newTestConn(t)
+	rec := makeTestRecord(t, 1000)
+	defer rec.Release()
+	base, err := array.NewRecordReader(rec.Schema(), []arrow.RecordBatch{rec})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer base.Release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	_, err = conn.IngestStream(ctx, "stream_cancel", &endlessReader{RecordReader: base, rec: rec})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+// cancellingReader yields n copies of a record batch and then cancels
+// its context, failing with err if it is set.
+type cancellingReader struct {
+	array.RecordReader
+	rec    arrow.RecordBatch
+	n      int
+	cancel context.CancelFunc
+	err    error
+}
+
+func (r *cancellingReader) Next() bool {
+	if r.n == 0 {
+		r.cancel()
+		return r.err == nil
+	}
+	r.n--
+	return true
+}
+func (r *cancellingReader) RecordBatch() arrow.RecordBatch { return r.rec }
+func (r *cancellingReader) Record() arrow.RecordBatch      { return r.rec }
+func (r *cancellingReader) Err() error                     { return r.err }
+
+func TestIngestStream_CancelPartway(t *testing.T) {
+	_, conn := newTestConn(t)
+	rec := makeTestRecord(t, 100)
+	defer rec.Release()
+	base, err := array.NewRecordReader(rec.Schema(), []arrow.RecordBatch{rec})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer base.Release()
+
+	for _, tc := range []struct {
+		name string
+		err  error
+	}{
+		{"cancel", nil},
+		{"reader error", errors.New("source failed")},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			r := &cancellingReader{RecordReader: base, rec: rec, n: 3, cancel: cancel, err: tc.err}
+			_, err := conn.IngestStream(ctx, "stream_partway", r)
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("expected context.Canceled, got %v", err)
+			}
+		})
+	}
+}
+
+type upsertRow struct {
+	ID      int64  `couac:"id"`
+	Version int64  `couac:"version"`
+	Name    string `couac:"name"`
+	Deleted bool   `couac:"_deleted"`
+}
+
+type upsertStored struct {
+	ID      int64  `couac:"id"`
+	Version int64  `couac:"version"`
+	Name    string `couac:"name"`
+}
+
+func upsertRecord(t *testing.T, rows ...upsertRow) arrow.RecordBatch {
+	t.Helper()
+	rec, err := couac.RecordFromSlice(rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rec
+}
+
+func TestIngestUpsert_InsertAndUpdate(t *testing.T) {
+	_, conn := newTestConn(t)
+	ctx := context.Background()
+
+	rec1 := upsertRecord(t, upsertRow{ID: 1, Name: "a"}, upsertRow{ID: 2, Name: "b"})
+	defer rec1.Release()
+	if _, err := conn.IngestUpsert(ctx, "upsert_test", rec1, []string{"id"}); err != nil {
+		t.Fatalf("initial upsert: %v", err)
+	}
+
+	// Duplicate key within the batch: the last row wins.
+	rec2 := upsertRecord(t, upsertRow{ID: 2, Name: "b2"}, upsertRow{ID: 3, Name: "c"}, upsertRow{ID: 2, Name: "b3"})
+	defer rec2.Release()
+	if _, err := conn.IngestUpsert(ctx, "upsert_test", rec2, []string{"id"}); err != nil {
+		t.Fatalf("second upsert: %v", err)
+	}
+
+	got, err := couac.QueryAs[upsertStored](ctx, conn, "SELECT * FROM upsert_test ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"a", "b3", "c"}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d rows, got %+v", len(want), got)
+	}
+	for i, w := range want {
+		if got[i].Name != w {
+			t.Errorf("row %d: expected %q, got %q", i, w, got[i].Name)
+		}
+	}
+
+	// The staging table is cleaned up.
+	tables, err := conn.ShowTables(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tables) != 1 {
+		t.Errorf("expected only the target table, got %v", tables)
+	}
+}
+
+func TestIngestUpsert_VersionAndDelete(t *testing.T) {
+	_, conn := newTestConn(t)
+	ctx := context.Background()
+	opts := []couac.UpsertOption{couac.WithVersionColumn("version"), couac.WithDeleteMarker("_deleted")}
+
+	rec1 := upsertRecord(t,
+		upsertRow{ID: 1, Version: 5, Name: "a5"},
+		upsertRow{ID: 2, Version: 5, Name: "b5"},
+		upsertRow{ID: 3, Version: 1, Name: "gone", Deleted: true})
+	defer rec1.Release()
+	if _, err := conn.IngestUpsert(ctx, "upsert_cdc", rec1, []string{"id"}, opts...); err != nil {
+		t.Fatalf("initial upsert: %v", err)
+	}
+
+	rec2 := upsertRecord(t,
+		upsertRow{ID: 1, Version: 4, Name: "stale"},            // older: ignored
+		upsertRow{ID: 1, Version: 7, Name: "a7"},               // newer: applied
+		upsertRow{ID: 2, Version: 6, Name: "x", Deleted: true}) // newer delete
+	defer rec2.Release()
+	if _, err := conn.IngestUpsert(ctx, "upsert_cdc", rec2, []string{"id"}, opts...); err != nil {
+		t.Fatalf("second upsert: %v", err)
+	}
+
+	got, err := couac.QueryAs[upsertStored](ctx, conn, "SELECT * FROM upsert_cdc ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].ID != 1 || got[0].Name != "a7" || got[0].Version != 7 {
+		t.Errorf("unexpected rows: %+v", got)
+	}
+
+	schema, err := conn.TableSchema(ctx, "upsert_cdc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(schema.FieldIndices("_deleted")) != 0 {
+		t.Errorf("delete marker column should not be stored: %s", schema)
+	}
+}
+
+func TestIngestUpsert_Errors(t *testing.T) {
+	_, conn := newTestConn(t)
+	ctx := context.Background()
+	rec := upsertRecord(t, upsertRow{ID: 1})
+	defer rec.Release()
+
+	if _, err := conn.IngestUpsert(ctx, "upsert_err", rec, nil); !errors.Is(err, couac.ErrNoKeyColumns) {
+		t.Errorf("expected ErrNoKeyColumns, got %v", err)
+	}
+	if _, err := conn.IngestUpsert(ctx, "upsert_err", rec, []string{"missing"}); err == nil {
+		t.Error("expected error for unknown key column")
+	}
+}
@@ -0,0 +1,130 @@
+package couac
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/apache/arrow-adbc/go/adbc"
+)
+
+// WithLockWait makes [NewDuck], and [DB.Reopen], retry opening a
+// database file that another process holds locked, every poll, until
+// the lock is released or timeout has elapsed. It then returns the
+// last [LockError]. Waiting stops early when the context set with
+// [WithContext] is done.
+//
+// This lets a new process start while the one it replaces is still
+// shutting down. Databases already open in this process are not waited
+// for ([ErrPathAlreadyOpen]).
+//
+// Example:
+//
+//	db, err := couac.NewDuck(
+//	    couac.WithPath("analytics.db"),
+//	    couac.WithLockWait(30*time.Second, 250*time.Millisecond),
+//	)
+func WithLockWait(timeout, poll time.Duration) Option {
+	return func(cfg config) {
+		cfg.lockWait, cfg.lockPoll = timeout, poll
+	}
+}
+
+// LockError is returned by [NewDuck] when another process holds the
+// lock on the database file. It matches [ErrLockedByOtherProcess] with
+// errors.Is, and wraps the driver's error.
+//
+// Example:
+//
+//	var lerr *couac.LockError
+//	if errors.As(err, &lerr) {
+//	    log.Printf("%s is in use by PID %d", lerr.Path, lerr.PID)
+//	}
+type LockError struct {
+	// Path is the database file.
+	Path string
+	// PID is the process that holds the lock, or 0 if DuckDB did not
+	// report it.
+	PID int
+	// Program is the executable of that process, if reported.
+	Program string
+
+	err error
+}
+
+// Error describes the lock and its holder.
+func (e *LockError) Error() string {
+	if e.PID == 0 {
+		return fmt.Sprintf("couac: database file %s is locked by another process", e.Path)
+	}
+	if e.Program == "" {
+		return fmt.Sprintf("couac: database file %s is locked by process %d", e.Path, e.PID)
+	}
+	return fmt.Sprintf("couac: database file %s is locked by process %d (%s)", e.Path, e.PID, e.Program)
+}
+
+// Unwrap returns the driver's error.
+func (e *LockError) Unwrap() error { return e.err }
+
+// Is reports whether target is [ErrLockedByOtherProcess].
+func (e *LockError) Is(target error) bool { return target == ErrLockedByOtherProcess }
+
+var (
+	// lockFailure matches the error DuckDB reports when it cannot lock
+	// the database file.
+	lockFailure = regexp.MustCompile(`Could not set lock on file "([^"]*)"`)
+	// lockHolder matches the holder DuckDB names on Unix systems.
+	lockHolder = regexp.MustCompile(`Conflicting lock is held in (.*?) ?\(PID (\d+)\)`)
+)
+
+// lockError returns the LockError for err if it is a lock failure on
+// path, or nil.
+func lockError(err error, path string) *LockError {
+	var aerr adbc.Error
+	if !errors.As(err, &aerr) {
+		return nil
+	}
+	m := lockFailure.FindStringSubmatch(aerr.Msg)
+	if m == nil {
+		return nil
+	}
+	e := &LockError{Path: path, err: err}
+	if m := lockHolder.FindStringSubmatch(aerr.Msg); m != nil {
+		e.Program = m[1]
+		e.PID, _ = strconv.Atoi(m[2])
+	}
+	return e
+}
+
+// openDatabase opens the database with opts, retrying as configured
+// by WithLockWait while another process holds the file.
+func (q *DB) openDatabase(opts map[string]string) (adbc.Database, error) {
+	deadline := time.Now().Add(q.lockWait)
+	poll := q.lockPoll
+	if poll <= 0 {
+		poll = 100 * time.Millisecond
+	}
+	for {
+		db, err := q.drv.NewDatabase(opts)
+		if err == nil {
+			return db, nil
+		}
+		lerr := lockError(err, q.path)
+		if lerr == nil {
+			return nil, err
+		}
+		wait := min(poll, time.Until(deadline))
+		if wait <= 0 {
+			return nil, lerr
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-t.C:
+		case <-q.ctx.Done():
+			t.Stop()
+			return nil, errors.Join(lerr, q.ctx.Err())
+		}
+	}
+}
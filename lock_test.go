@@ -0,0 +1,110 @@
+package couac_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/loicalleyne/couac"
+)
+
+// TestHelperLockHolder is run in a child process by holdLock: it keeps
+// the database file open until its stdin is closed.
+func TestHelperLockHolder(t *testing.T) {
+	path := os.Getenv("COUAC_LOCK_HOLDER")
+	if path == "" {
+		t.Skip("helper process")
+	}
+	db, err := couac.NewDuck(couac.WithDriverName("duckdb"), couac.WithPath(path))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Println("locked")
+	io.Copy(io.Discard, os.Stdin)
+	db.Close()
+	os.Exit(0)
+}
+
+// holdLock opens path in a child process and returns it with the
+// function that makes it release the file.
+func holdLock(t *testing.T, path string) (*exec.Cmd, func()) {
+	t.Helper()
+	newTestDB(t).Close()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestHelperLockHolder$")
+	cmd.Env = append(os.Environ(), "COUAC_LOCK_HOLDER="+path)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	line, _ := bufio.NewReader(stdout).ReadString('\n')
+	if line != "locked\n" {
+		stdin.Close()
+		cmd.Wait()
+		t.Fatalf("lock holder failed: %q", line)
+	}
+	release := sync.OnceFunc(func() {
+		stdin.Close()
+		cmd.Wait()
+	})
+	t.Cleanup(release)
+	return cmd, release
+}
+
+func TestNewDuck_LockedByOtherProcess(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "locked.db")
+	holder, _ := holdLock(t, path)
+
+	start := time.Now()
+	_, err := couac.NewDuck(couac.WithDriverName("duckdb"), couac.WithPath(path),
+		couac.WithLockWait(150*time.Millisecond, 20*time.Millisecond))
+	if !errors.Is(err, couac.ErrLockedByOtherProcess) {
+		t.Fatalf("expected ErrLockedByOtherProcess, got %v", err)
+	}
+	if time.Since(start) < 150*time.Millisecond {
+		t.Errorf("expected NewDuck to wait for the lock, returned after %v", time.Since(start))
+	}
+	var lerr *couac.LockError
+	if !errors.As(err, &lerr) {
+		t.Fatalf("expected a *LockError, got %T", err)
+	}
+	if lerr.PID != holder.Process.Pid || lerr.Path != path {
+		t.Errorf("expected %s locked by PID %d, got %+v", path, holder.Process.Pid, lerr)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = couac.NewDuck(couac.WithDriverName("duckdb"), couac.WithPath(path),
+		couac.WithContext(ctx), couac.WithLockWait(time.Minute, 20*time.Millisecond))
+	if !errors.Is(err, couac.ErrLockedByOtherProcess) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the wait to stop with the context, got %v", err)
+	}
+}
+
+func TestWithLockWait(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "handover.db")
+	_, release := holdLock(t, path)
+	time.AfterFunc(100*time.Millisecond, release)
+
+	db, err := couac.NewDuck(couac.WithDriverName("duckdb"), couac.WithPath(path),
+		couac.WithLockWait(10*time.Second, 20*time.Millisecond))
+	if err != nil {
+		t.Fatalf("expected NewDuck to open the file once released, got %v", err)
+	}
+	db.Close()
+}
@@ -0,0 +1,318 @@
+package couac
+
+import (
+	"expvar"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WithMetrics records the counters and latency histograms reported by
+// [DB.Stats]. Recording adds a few atomic operations per call, and a
+// clock read when a call waits for the DB's lock, so it can be left on
+// in production.
+func WithMetrics() Option {
+	return func(cfg config) {
+		if cfg.metrics == nil {
+			cfg.metrics = &metrics{}
+		}
+	}
+}
+
+// WithMetricsExporter enables [WithMetrics] and passes a snapshot of
+// [DB.Stats] to exp every interval, and a last one when the DB is
+// closed. ExportStats is called from a single goroutine.
+func WithMetricsExporter(exp MetricsExporter, interval time.Duration) Option {
+	return func(cfg config) {
+		WithMetrics()(cfg)
+		cfg.metrics.exporter, cfg.metrics.interval = exp, interval
+	}
+}
+
+// MetricsExporter receives the snapshots of [DB.Stats] taken by
+// [WithMetricsExporter], to forward them to a monitoring system.
+type MetricsExporter interface {
+	ExportStats(s Stats)
+}
+
+// ExpvarExporter is a [MetricsExporter] that publishes the last
+// snapshot it received as an [expvar] variable, served as JSON by the
+// /debug/vars handler.
+type ExpvarExporter struct {
+	last atomic.Pointer[Stats]
+}
+
+// NewExpvarExporter publishes the snapshots passed to the returned
+// exporter under name. Like [expvar.Publish], it panics if name is
+// already in use.
+func NewExpvarExporter(name string) *ExpvarExporter {
+	e := &ExpvarExporter{}
+	expvar.Publish(name, expvar.Func(func() any { return e.last.Load() }))
+	return e
+}
+
+// ExportStats implements [MetricsExporter].
+func (e *ExpvarExporter) ExportStats(s Stats) { e.last.Store(&s) }
+
+// Stats is a snapshot of the activity of a [DB]. Counters cover the
+// lifetime of the DB. Only OpenConns and OpenResults are maintained
+// without [WithMetrics].
+type Stats struct {
+	// Exec covers Exec calls, including ExecBatch and database/sql.
+	Exec OpStats
+	// Query covers Query calls. Their latency runs until the result is
+	// closed, and Rows counts the rows read.
+	Query OpStats
+	// Ingest covers ingests by mode: "append", "merge", "replace", and
+	// "upsert". Rows and Bytes count the rows and the size of the Arrow
+	// data ingested; Bytes is not known for [Conn.IngestFile].
+	Ingest map[string]OpStats
+	// Maintenance covers [DB.Compact], [DB.Checkpoint], and
+	// [DB.ForceCheckpoint].
+	Maintenance OpStats
+	// OpenConns is the number of open connections (see
+	// [DB.ConnectionCount]).
+	OpenConns int
+	// OpenResults is the number of query results, including
+	// database/sql Rows, that have not been closed yet.
+	OpenResults int64
+	// ReadLockWait and WriteLockWait record the time calls waited for
+	// the DB's lock: read acquisitions are held up by maintenance, and
+	// write acquisitions by in-flight calls. Acquisitions that did not
+	// wait are not recorded.
+	ReadLockWait  Histogram
+	WriteLockWait Histogram
+}
+
+// OpStats counts the calls of one kind of operation.
+type OpStats struct {
+	// Count is the number of calls, and Errors the number that failed
+	// or were rejected by a hook.
+	Count, Errors int64
+	// Rows is the number of rows affected, read, or ingested.
+	Rows int64
+	// Bytes is the size of the data ingested.
+	Bytes int64
+	// Latency is the distribution of call durations.
+	Latency Histogram
+}
+
+// Histogram is a snapshot of a distribution of durations. Counts[i] is
+// the number of observations greater than Bounds[i-1] and at most
+// Bounds[i]; the last element of Counts holds those above every bound.
+type Histogram struct {
+	Count  int64
+	Sum    time.Duration
+	Bounds []time.Duration
+	Counts []int64
+}
+
+// Mean returns the average observation, or 0 if there is none.
+func (h Histogram) Mean() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Sum / time.Duration(h.Count)
+}
+
+// Quantile returns an upper estimate of the q-quantile (0 < q ≤ 1) of
+// the observations: the bound of the bucket it falls into. Observations
+// above every bound are reported as the largest bound.
+func (h Histogram) Quantile(q float64) time.Duration {
+	if h.Count == 0 || len(h.Bounds) == 0 {
+		return 0
+	}
+	rank := int64(q * float64(h.Count))
+	if rank < 1 {
+		rank = 1
+	}
+	var seen int64
+	for i, n := range h.Counts[:len(h.Bounds)] {
+		if seen += n; seen >= rank {
+			return h.Bounds[i]
+		}
+	}
+	return h.Bounds[len(h.Bounds)-1]
+}
+
+// latencyBounds are the bucket bounds of every histogram.
+var latencyBounds = [...]time.Duration{
+	100 * time.Microsecond, 250 * time.Microsecond, 500 * time.Microsecond,
+	time.Millisecond, 2500 * time.Microsecond, 5 * time.Millisecond,
+	10 * time.Millisecond, 25 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2500 * time.Millisecond, 5 * time.Second,
+	10 * time.Second, 30 * time.Second, time.Minute,
+}
+
+// histogram accumulates observations into latencyBounds buckets.
+type histogram struct {
+	count, sum atomic.Int64
+	buckets    [len(latencyBounds) + 1]atomic.Int64
+}
+
+func (h *histogram) observe(d time.Duration) {
+	i, _ := slices.BinarySearch(latencyBounds[:], d)
+	h.buckets[i].Add(1)
+	h.count.Add(1)
+	h.sum.Add(int64(d))
+}
+
+func (h *histogram) snapshot() Histogram {
+	s := Histogram{
+		Count:  h.count.Load(),
+		Sum:    time.Duration(h.sum.Load()),
+		Bounds: latencyBounds[:],
+		Counts: make([]int64, len(h.buckets)),
+	}
+	for i := range h.buckets {
+		s.Counts[i] = h.buckets[i].Load()
+	}
+	return s
+}
+
+// opCounters accumulates the OpStats of one kind of operation.
+type opCounters struct {
+	count, errors, rows, bytes atomic.Int64
+	latency                    histogram
+}
+
+func (c *opCounters) observe(ev *HookEvent) {
+	c.count.Add(1)
+	if ev.Err != nil {
+		c.errors.Add(1)
+	}
+	if ev.Rows > 0 {
+		c.rows.Add(ev.Rows)
+	}
+	if ev.Bytes > 0 && ev.Err == nil {
+		c.bytes.Add(ev.Bytes)
+	}
+	c.latency.observe(ev.Duration)
+}
+
+func (c *opCounters) snapshot() OpStats {
+	return OpStats{
+		Count:   c.count.Load(),
+		Errors:  c.errors.Load(),
+		Rows:    c.rows.Load(),
+		Bytes:   c.bytes.Load(),
+		Latency: c.latency.snapshot(),
+	}
+}
+
+// ingestModes are the keys of Stats.Ingest, in the order of
+// metrics.ingest.
+var ingestModes = [...]string{"append", "merge", "replace", "upsert"}
+
+// metrics holds the counters of a DB with WithMetrics.
+type metrics struct {
+	exec, query, maintenance opCounters
+	ingest                   [len(ingestModes)]opCounters
+	readWait, writeWait      histogram
+
+	exporter MetricsExporter
+	interval time.Duration
+	stop     chan struct{}
+	stopped  sync.WaitGroup
+}
+
+// observe records the completed call ev of kind.
+func (m *metrics) observe(kind hookKind, ev *HookEvent) {
+	switch kind {
+	case hookExec:
+		m.exec.observe(ev)
+	case hookQuery:
+		m.query.observe(ev)
+	case hookIngest:
+		i := slices.Index(ingestModes[:], ev.Mode)
+		m.ingest[max(i, 0)].observe(ev)
+	}
+}
+
+// Stats returns a snapshot of the activity of the database. Without
+// [WithMetrics], only OpenConns and OpenResults are set.
+func (q *DB) Stats() Stats {
+	s := Stats{
+		OpenConns:   q.ConnectionCount(),
+		OpenResults: q.openResults.Load(),
+	}
+	m := q.metrics
+	if m == nil {
+		return s
+	}
+	s.Exec = m.exec.snapshot()
+	s.Query = m.query.snapshot()
+	s.Maintenance = m.maintenance.snapshot()
+	s.Ingest = make(map[string]OpStats, len(ingestModes))
+	for i, mode := range ingestModes {
+		s.Ingest[mode] = m.ingest[i].snapshot()
+	}
+	s.ReadLockWait = m.readWait.snapshot()
+	s.WriteLockWait = m.writeWait.snapshot()
+	return s
+}
+
+// startExporter starts the goroutine of WithMetricsExporter, if any.
+func (q *DB) startExporter() {
+	m := q.metrics
+	if m == nil || m.exporter == nil || m.interval <= 0 {
+		return
+	}
+	m.stop = make(chan struct{})
+	m.stopped.Go(func() {
+		t := time.NewTicker(m.interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				m.exporter.ExportStats(q.Stats())
+			case <-m.stop:
+				return
+			}
+		}
+	})
+}
+
+// stopExporter stops the exporter goroutine and passes it a last
+// snapshot.
+func (q *DB) stopExporter() {
+	m := q.metrics
+	if m == nil || m.stop == nil {
+		return
+	}
+	close(m.stop)
+	m.stopped.Wait()
+	m.exporter.ExportStats(q.Stats())
+}
+
+// rlock acquires the read lock of q.mu, recording the wait when it is
+// held up by maintenance.
+func (q *DB) rlock() {
+	if q.metrics == nil {
+		q.mu.RLock()
+		return
+	}
+	if q.mu.TryRLock() {
+		return
+	}
+	start := time.Now()
+	q.mu.RLock()
+	q.metrics.readWait.observe(time.Since(start))
+}
+
+// lock acquires the write lock of q.mu, recording the wait when it is
+// held up by in-flight calls.
+func (q *DB) lock() {
+	if q.metrics == nil {
+		q.mu.Lock()
+		return
+	}
+	if q.mu.TryLock() {
+		return
+	}
+	start := time.Now()
+	q.mu.Lock()
+	q.metrics.writeWait.observe(time.Since(start))
+}
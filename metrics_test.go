@@ -0,0 +1,209 @@
+package couac_test
+
+import (
+	"context"
+	"expvar"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+
+	"github.com/loicalleyne/couac"
+)
+
+func TestMetrics_Stats(t *testing.T) {
+	db := newTestDB(t, couac.WithMetrics())
+	conn, err := db.Connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ctx := context.Background()
+
+	if _, err := conn.Exec(ctx, "CREATE TABLE t AS SELECT * FROM range(10)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Exec(ctx, "INSERT INTO missing VALUES (1)"); err == nil {
+		t.Fatal("expected insert into a missing table to fail")
+	}
+	res, err := conn.Query(ctx, "SELECT * FROM t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := db.Stats(); s.OpenResults != 1 || s.OpenConns != 1 {
+		t.Errorf("expected 1 open result on 1 connection, got %d on %d", s.OpenResults, s.OpenConns)
+	}
+	for res.Reader.Next() {
+	}
+	res.Close()
+	res.Close()
+
+	rec := makeTestRecord(t, 3)
+	defer rec.Release()
+	if _, err := conn.Ingest(ctx, "m", rec); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.IngestMerge(ctx, "m", rec); err != nil {
+		t.Fatal(err)
+	}
+	rdr, err := array.NewRecordReader(rec.Schema(), []arrow.RecordBatch{rec, rec})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rdr.Release()
+	if _, err := conn.IngestStream(ctx, "m", rdr); err != nil {
+		t.Fatal(err)
+	}
+
+	s := db.Stats()
+	if s.Exec.Count != 2 || s.Exec.Errors != 1 || s.Exec.Latency.Count != 2 {
+		t.Errorf("unexpected exec stats %+v", s.Exec)
+	}
+	if s.Query.Count != 1 || s.Query.Rows != 10 || s.OpenResults != 0 {
+		t.Errorf("unexpected query stats %+v, %d open results", s.Query, s.OpenResults)
+	}
+	if a := s.Ingest["append"]; a.Count != 2 || a.Rows != 9 || a.Bytes <= 0 {
+		t.Errorf("unexpected append stats %+v", a)
+	}
+	if m := s.Ingest["merge"]; m.Count != 1 || m.Rows != 3 {
+		t.Errorf("unexpected merge stats %+v", m)
+	}
+	if s.Exec.Latency.Mean() <= 0 || s.Exec.Latency.Quantile(0.99) <= 0 {
+		t.Errorf("expected exec latencies, got %+v", s.Exec.Latency)
+	}
+}
+
+func TestMetrics_Disabled(t *testing.T) {
+	db, conn := newTestConn(t)
+	if _, err := conn.Exec(context.Background(), "SELECT 1"); err != nil {
+		t.Fatal(err)
+	}
+	s := db.Stats()
+	if s.OpenConns != 1 || s.Exec.Count != 0 || s.Ingest != nil {
+		t.Errorf("expected only gauges without WithMetrics, got %+v", s)
+	}
+}
+
+// gateReader blocks in its first Next call until open is closed.
+type gateReader struct {
+	array.RecordReader
+	open chan struct{}
+	once sync.Once
+}
+
+func (r *gateReader) Next() bool {
+	r.once.Do(func() { <-r.open })
+	return r.RecordReader.Next()
+}
+
+func TestMetrics_LockWait(t *testing.T) {
+	db := newTestDB(t, couac.WithMetrics())
+	conn, err := db.Connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ctx := context.Background()
+
+	rec := makeTestRecord(t, 3)
+	defer rec.Release()
+	base, err := array.NewRecordReader(rec.Schema(), []arrow.RecordBatch{rec})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer base.Release()
+
+	// The stream holds the read lock until the gate opens, so that
+	// ForceCheckpoint waits for it.
+	gate := &gateReader{RecordReader: base, open: make(chan struct{})}
+	ingested := make(chan error)
+	go func() {
+		_, err := conn.IngestStream(ctx, "s", gate)
+		ingested <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	checkpointed := make(chan error)
+	go func() { checkpointed <- db.ForceCheckpoint(ctx) }()
+	time.Sleep(50 * time.Millisecond)
+	close(gate.open)
+	if err := <-ingested; err != nil {
+		t.Fatal(err)
+	}
+	if err := <-checkpointed; err != nil {
+		t.Fatal(err)
+	}
+
+	s := db.Stats()
+	if w := s.WriteLockWait; w.Count != 1 || w.Sum < 40*time.Millisecond {
+		t.Errorf("expected one write lock wait of about 50ms, got %d totalling %v", w.Count, w.Sum)
+	}
+	if s.Maintenance.Count != 1 || s.Maintenance.Errors != 0 {
+		t.Errorf("unexpected maintenance stats %+v", s.Maintenance)
+	}
+}
+
+// collectExporter keeps the snapshots it is given.
+type collectExporter struct {
+	mu    sync.Mutex
+	stats []couac.Stats
+}
+
+func (e *collectExporter) ExportStats(s couac.Stats) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.stats = append(e.stats, s)
+}
+
+// testExpvar is published once, since expvar names cannot be reused.
+var testExpvar = sync.OnceValue(func() *couac.ExpvarExporter {
+	return couac.NewExpvarExporter("couac_test_stats")
+})
+
+func TestMetrics_Exporter(t *testing.T) {
+	exp := &collectExporter{}
+	db, err := couac.NewDuck(couac.WithDriverName("duckdb"), couac.WithMetricsExporter(exp, time.Hour))
+	if err != nil {
+		t.Skipf("skipping: cannot open DuckDB (driver not found?): %v", err)
+	}
+	conn, err := db.Connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Exec(context.Background(), "SELECT 1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(exp.stats) != 1 || exp.stats[0].Exec.Count != 1 {
+		t.Fatalf("expected a final snapshot on Close, got %+v", exp.stats)
+	}
+
+	testExpvar().ExportStats(exp.stats[0])
+	if v := expvar.Get("couac_test_stats").String(); !strings.Contains(v, `"Exec":{"Count":1`) {
+		t.Errorf("unexpected expvar value %s", v)
+	}
+}
+
+func TestHistogram_Quantile(t *testing.T) {
+	h := couac.Histogram{
+		Count:  4,
+		Sum:    40 * time.Millisecond,
+		Bounds: []time.Duration{time.Millisecond, 10 * time.Millisecond, 100 * time.Millisecond},
+		Counts: []int64{1, 2, 0, 1},
+	}
+	if got := h.Mean(); got != 10*time.Millisecond {
+		t.Errorf("Mean() = %v", got)
+	}
+	for q, want := range map[float64]time.Duration{0.25: time.Millisecond, 0.5: 10 * time.Millisecond, 1: 100 * time.Millisecond} {
+		if got := h.Quantile(q); got != want {
+			t.Errorf("Quantile(%v) = %v, want %v", q, got, want)
+		}
+	}
+	if got := (couac.Histogram{}).Quantile(0.5); got != 0 {
+		t.Errorf("empty Quantile = %v", got)
+	}
+}
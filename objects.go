@@ -57,7 +57,7 @@ func (q *Conn) Objects(ctx context.Context, opts ...ObjectsOption) (*CatalogTree
 	if err := q.ensureConnOpen(); err != nil {
 		return nil, err
 	}
-	q.parent.mu.RLock()
+	q.parent.rlock()
 	defer q.parent.mu.RUnlock()
 
 	cfg := &objectsConfig{
@@ -134,7 +134,7 @@ func (q *Conn) TableSchemaIn(ctx context.Context, catalog, dbSchema, tableName s
 	if err := q.ensureConnOpen(); err != nil {
 		return nil, err
 	}
-	q.parent.mu.RLock()
+	q.parent.rlock()
 	defer q.parent.mu.RUnlock()
 
 	var cp, sp *string
@@ -172,7 +172,7 @@ func (q *Conn) TableTypes(ctx context.Context) ([]string, error) {
 	if err := q.ensureConnOpen(); err != nil {
 		return nil, err
 	}
-	q.parent.mu.RLock()
+	q.parent.rlock()
 	defer q.parent.mu.RUnlock()
 
 	rr, err := q.conn.GetTableTypes(ctx)
@@ -0,0 +1,372 @@
+package couac
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// defaultMaxIdle is the number of idle connections a [Pool] keeps when
+// [WithMaxIdle] is not given.
+const defaultMaxIdle = 2
+
+// Pool reuses connections of a [DB] instead of opening and closing one
+// per unit of work. Connections are handed out with [Pool.Acquire] and
+// returned with [Pool.Release]; [Pool.Do] does both around a function.
+//
+// Pooled connections are ordinary [Conn] values tracked by the parent
+// DB, so [DB.ConnectionCount] includes them and [DB.Close] closes them.
+// A Pool is safe for concurrent use.
+type Pool struct {
+	parent *DB
+	cfg    poolConfig
+	// sem holds one token per open or opening connection when
+	// maxOpen is set.
+	sem chan struct{}
+
+	mu      sync.Mutex
+	idle    []idleConn
+	inUse   map[*Conn]struct{}
+	open    int
+	closed  bool
+	stats   PoolStats
+	stopJan chan struct{}
+}
+
+type idleConn struct {
+	conn  *Conn
+	since time.Time
+}
+
+// Pool creates a connection pool on the database. Connections are
+// opened lazily by [Pool.Acquire]. Close the pool when it is no longer
+// needed; closing the DB also closes its pooled connections.
+//
+// Example:
+//
+//	pool := db.Pool(couac.WithMaxOpen(8), couac.WithIdleTimeout(time.Minute),
+//	    couac.WithInitSQL("SET search_path = 'analytics'"))
+//	defer pool.Close()
+//
+//	conn, err := pool.Acquire(ctx)
+//	if err != nil { ... }
+//	defer pool.Release(conn)
+func (q *DB) Pool(opts ...PoolOption) *Pool {
+	cfg := poolConfig{maxIdle: defaultMaxIdle}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	p := &Pool{
+		parent: q,
+		cfg:    cfg,
+		inUse:  make(map[*Conn]struct{}),
+	}
+	if cfg.maxOpen > 0 {
+		p.sem = make(chan struct{}, cfg.maxOpen)
+	}
+	if cfg.idleTimeout > 0 {
+		p.stopJan = make(chan struct{})
+		go p.janitor()
+	}
+	return p
+}
+
+// Do runs fn on a connection from the database's default pool, which is
+// created on first use with the options given to [WithPool].
+//
+// Example:
+//
+//	err := db.Do(ctx, func(conn *couac.Conn) error {
+//	    _, err := conn.Exec(ctx, "INSERT INTO events VALUES (1)")
+//	    return err
+//	})
+func (q *DB) Do(ctx context.Context, fn func(*Conn) error) error {
+	if err := q.ensureOpen(); err != nil {
+		return err
+	}
+	q.poolOnce.Do(func() { q.pool = q.Pool(q.poolOpts...) })
+	return q.pool.Do(ctx, fn)
+}
+
+// Acquire returns a connection from the pool, reusing an idle one when
+// available and opening a new one otherwise. When the pool has
+// [WithMaxOpen] connections in use, Acquire blocks until one is
+// released or ctx is done.
+//
+// The statements given to [WithInitSQL] run on the connection before it
+// is returned. Every acquired connection must be handed back with
+// [Pool.Release].
+func (p *Pool) Acquire(ctx context.Context) (*Conn, error) {
+	if err := p.ensurePoolOpen(); err != nil {
+		return nil, err
+	}
+	if p.sem != nil {
+		select {
+		case p.sem <- struct{}{}:
+		default:
+			start := time.Now()
+			select {
+			case p.sem <- struct{}{}:
+			case <-ctx.Done():
+				p.recordWait(start)
+				return nil, fmt.Errorf("couac: acquire connection: %w", ctx.Err())
+			}
+			p.recordWait(start)
+		}
+	}
+
+	conn, err := p.get()
+	if err == nil {
+		err = p.init(ctx, conn)
+		if err != nil {
+			p.discard(conn)
+		}
+	}
+	if err != nil {
+		p.releaseToken()
+		return nil, err
+	}
+
+	p.mu.Lock()
+	p.inUse[conn] = struct{}{}
+	p.stats.Acquired++
+	p.mu.Unlock()
+	return conn, nil
+}
+
+// Release returns a connection obtained from [Pool.Acquire] to the
+// pool. The connection is kept idle for reuse up to [WithMaxIdle]
+// connections and closed otherwise. Releasing a closed connection
+// frees its slot; releasing a connection that is not in use by this
+// pool is a no-op.
+//
+// A transaction left open on the connection, whether started with
+// [Conn.Begin] or with a BEGIN statement run through [Conn.Exec] or
+// [Conn.ExecArgs], is rolled back before the connection is reused; if
+// that fails, the connection is closed.
+func (p *Pool) Release(conn *Conn) {
+	if conn == nil {
+		return
+	}
+	p.mu.Lock()
+	_, ok := p.inUse[conn]
+	p.mu.Unlock()
+	if !ok {
+		return
+	}
+	if !conn.closed.Load() {
+		if err := p.reset(conn); err != nil {
+			conn.Close()
+		}
+	}
+
+	p.mu.Lock()
+	if _, ok := p.inUse[conn]; !ok {
+		p.mu.Unlock()
+		return
+	}
+	delete(p.inUse, conn)
+
+	var toClose *Conn
+	switch {
+	case conn.closed.Load():
+		p.open--
+	case p.closed:
+		p.open--
+		toClose = conn
+	case len(p.idle) >= p.cfg.maxIdle:
+		p.open--
+		p.stats.MaxIdleClosed++
+		toClose = conn
+	default:
+		p.idle = append(p.idle, idleConn{conn: conn, since: time.Now()})
+	}
+	p.mu.Unlock()
+
+	if toClose != nil {
+		toClose.Close()
+	}
+	p.releaseToken()
+}
+
+// Do acquires a connection, runs fn on it, and releases it, returning
+// the error of fn or of acquiring the connection.
+func (p *Pool) Do(ctx context.Context, fn func(*Conn) error) error {
+	conn, err := p.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer p.Release(conn)
+	return fn(conn)
+}
+
+// Stats returns a snapshot of the pool's counters.
+func (p *Pool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := p.stats
+	s.MaxOpen = p.cfg.maxOpen
+	s.Open = p.open
+	s.InUse = len(p.inUse)
+	s.Idle = len(p.idle)
+	return s
+}
+
+// Close closes the idle connections of the pool and stops it from
+// handing out new ones. Connections still in use are closed when they
+// are released. Close is idempotent.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	idle := p.idle
+	p.idle = nil
+	p.open -= len(idle)
+	p.mu.Unlock()
+
+	if p.stopJan != nil {
+		close(p.stopJan)
+	}
+	var errs []error
+	for _, ic := range idle {
+		if err := ic.conn.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// get pops the most recently used idle connection, skipping ones that
+// were closed behind the pool's back, or opens a new connection.
+func (p *Pool) get() (*Conn, error) {
+	p.mu.Lock()
+	for len(p.idle) > 0 {
+		ic := p.idle[len(p.idle)-1]
+		p.idle = p.idle[:len(p.idle)-1]
+		if !ic.conn.closed.Load() {
+			p.mu.Unlock()
+			return ic.conn, nil
+		}
+		p.open--
+	}
+	p.open++
+	p.mu.Unlock()
+
+	conn, err := p.parent.ConnectAs(p.cfg.catalog, p.cfg.dbSchema)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err != nil {
+		p.open--
+		return nil, err
+	}
+	p.stats.Created++
+	return conn, nil
+}
+
+// init runs the pool's init statements on conn.
+func (p *Pool) init(ctx context.Context, conn *Conn) error {
+	for _, stmt := range p.cfg.initSQL {
+		if _, err := conn.Exec(ctx, stmt); err != nil {
+			return fmt.Errorf("couac: pool init: %w", err)
+		}
+	}
+	return nil
+}
+
+// reset rolls back a transaction left open on conn, if any.
+func (p *Pool) reset(conn *Conn) error {
+	if tx := conn.tx.Load(); tx != nil {
+		if err := tx.Rollback(context.Background()); err != nil && !errors.Is(err, ErrTxDone) {
+			return err
+		}
+		return nil
+	}
+	if !conn.sqlTx.Load() {
+		return nil
+	}
+	p.parent.rlock()
+	defer p.parent.mu.RUnlock()
+	_, err := conn.execInternal(context.Background(), "ROLLBACK")
+	conn.sqlTx.Store(false)
+	if err != nil {
+		return fmt.Errorf("couac: pool reset: %w", err)
+	}
+	return nil
+}
+
+// discard closes a connection that will not be handed out or kept.
+func (p *Pool) discard(conn *Conn) {
+	p.mu.Lock()
+	p.open--
+	p.mu.Unlock()
+	conn.Close()
+}
+
+func (p *Pool) releaseToken() {
+	if p.sem != nil {
+		<-p.sem
+	}
+}
+
+func (p *Pool) recordWait(start time.Time) {
+	p.mu.Lock()
+	p.stats.WaitCount++
+	p.stats.WaitDuration += time.Since(start)
+	p.mu.Unlock()
+}
+
+func (p *Pool) ensurePoolOpen() error {
+	if err := p.parent.ensureOpen(); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return ErrPoolClosed
+	}
+	return nil
+}
+
+// janitor closes connections that have been idle for longer than the
+// idle timeout. It stops when the pool or its database is closed.
+func (p *Pool) janitor() {
+	interval := max(p.cfg.idleTimeout/2, 10*time.Millisecond)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stopJan:
+			return
+		case <-ticker.C:
+		}
+		if p.parent.closed.Load() {
+			return
+		}
+		p.closeExpired(time.Now().Add(-p.cfg.idleTimeout))
+	}
+}
+
+// closeExpired closes idle connections last used before cutoff.
+func (p *Pool) closeExpired(cutoff time.Time) {
+	p.mu.Lock()
+	// idle is ordered by release time, oldest first.
+	n := 0
+	for n < len(p.idle) && p.idle[n].since.Before(cutoff) {
+		n++
+	}
+	expired := make([]idleConn, n)
+	copy(expired, p.idle[:n])
+	p.idle = append(p.idle[:0], p.idle[n:]...)
+	p.open -= n
+	p.stats.IdleTimeoutClosed += int64(n)
+	p.mu.Unlock()
+
+	for _, ic := range expired {
+		ic.conn.Close()
+	}
+}
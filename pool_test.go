@@ -0,0 +1,267 @@
+package couac_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/loicalleyne/couac"
+)
+
+func TestPool_ReusesConnections(t *testing.T) {
+	db := newTestDB(t)
+	pool := db.Pool()
+	defer pool.Close()
+	ctx := context.Background()
+
+	for range 5 {
+		conn, err := pool.Acquire(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := conn.Exec(ctx, "SELECT 1"); err != nil {
+			t.Fatal(err)
+		}
+		pool.Release(conn)
+	}
+
+	s := pool.Stats()
+	if s.Created != 1 || s.Acquired != 5 {
+		t.Errorf("expected 1 created / 5 acquired, got %d / %d", s.Created, s.Acquired)
+	}
+	if s.Open != 1 || s.Idle != 1 || s.InUse != 0 {
+		t.Errorf("unexpected stats: %+v", s)
+	}
+	if db.ConnectionCount() != 1 {
+		t.Errorf("expected 1 tracked connection, got %d", db.ConnectionCount())
+	}
+}
+
+func TestPool_MaxOpenBlocks(t *testing.T) {
+	db := newTestDB(t)
+	pool := db.Pool(couac.WithMaxOpen(1))
+	defer pool.Close()
+	ctx := context.Background()
+
+	c1, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	short, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := pool.Acquire(short); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+
+	done := make(chan *couac.Conn)
+	go func() {
+		c2, err := pool.Acquire(ctx)
+		if err != nil {
+			t.Error(err)
+		}
+		done <- c2
+	}()
+	time.Sleep(10 * time.Millisecond)
+	pool.Release(c1)
+	c2 := <-done
+	if c2 != c1 {
+		t.Error("expected the released connection to be reused")
+	}
+	pool.Release(c2)
+
+	if s := pool.Stats(); s.WaitCount != 2 || s.Created != 1 {
+		t.Errorf("expected 2 waits and 1 connection, got %+v", s)
+	}
+}
+
+func TestPool_MaxIdle(t *testing.T) {
+	db := newTestDB(t)
+	pool := db.Pool(couac.WithMaxIdle(1))
+	defer pool.Close()
+	ctx := context.Background()
+
+	var conns []*couac.Conn
+	for range 3 {
+		c, err := pool.Acquire(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conns = append(conns, c)
+	}
+	for _, c := range conns {
+		pool.Release(c)
+	}
+	s := pool.Stats()
+	if s.Idle != 1 || s.Open != 1 || s.MaxIdleClosed != 2 {
+		t.Errorf("unexpected stats: %+v", s)
+	}
+	if db.ConnectionCount() != 1 {
+		t.Errorf("expected 1 tracked connection, got %d", db.ConnectionCount())
+	}
+}
+
+func TestPool_IdleTimeout(t *testing.T) {
+	db := newTestDB(t)
+	pool := db.Pool(couac.WithIdleTimeout(20 * time.Millisecond))
+	defer pool.Close()
+
+	conn, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.Release(conn)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for pool.Stats().Idle > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	s := pool.Stats()
+	if s.Idle != 0 || s.IdleTimeoutClosed != 1 {
+		t.Errorf("expected idle connection to expire, got %+v", s)
+	}
+	if db.ConnectionCount() != 0 {
+		t.Errorf("expected 0 tracked connections, got %d", db.ConnectionCount())
+	}
+}
+
+func TestPool_InitSQL(t *testing.T) {
+	db := newTestDB(t)
+	pool := db.Pool(couac.WithInitSQL("SET threads = 2"))
+	defer pool.Close()
+	ctx := context.Background()
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Release(conn)
+	v, err := conn.Setting(ctx, "threads")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != "2" {
+		t.Errorf("expected threads = 2, got %q", v)
+	}
+
+	bad := db.Pool(couac.WithInitSQL("SET no_such_setting = 1"))
+	defer bad.Close()
+	if _, err := bad.Acquire(ctx); err == nil {
+		t.Fatal("expected init SQL error")
+	}
+	if s := bad.Stats(); s.Open != 0 {
+		t.Errorf("expected failed connection to be closed, got %+v", s)
+	}
+}
+
+func TestPool_Closed(t *testing.T) {
+	db := newTestDB(t)
+	pool := db.Pool()
+	conn, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pool.Acquire(context.Background()); !errors.Is(err, couac.ErrPoolClosed) {
+		t.Errorf("expected ErrPoolClosed, got %v", err)
+	}
+	pool.Release(conn)
+	if db.ConnectionCount() != 0 {
+		t.Errorf("expected released connection to be closed, got %d tracked", db.ConnectionCount())
+	}
+}
+
+func TestDB_Do(t *testing.T) {
+	db := newTestDB(t, couac.WithPool(couac.WithMaxOpen(2)))
+	ctx := context.Background()
+
+	if err := db.Do(ctx, func(conn *couac.Conn) error {
+		_, err := conn.Exec(ctx, "CREATE TABLE t (i INTEGER)")
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Go(func() {
+			err := db.Do(ctx, func(conn *couac.Conn) error {
+				_, err := conn.Exec(ctx, fmt.Sprintf("INSERT INTO t VALUES (%d)", i))
+				return err
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	wg.Wait()
+
+	if n := db.ConnectionCount(); n > 2 {
+		t.Errorf("expected at most 2 pooled connections, got %d", n)
+	}
+	sentinel := errors.New("boom")
+	if err := db.Do(ctx, func(*couac.Conn) error { return sentinel }); !errors.Is(err, sentinel) {
+		t.Errorf("expected fn error, got %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Do(ctx, func(*couac.Conn) error { return nil }); !errors.Is(err, couac.ErrDatabaseClosed) {
+		t.Errorf("expected ErrDatabaseClosed, got %v", err)
+	}
+}
+
+func TestPool_ReleaseRollsBack(t *testing.T) {
+	db := newTestDB(t)
+	pool := db.Pool(couac.WithMaxOpen(1))
+	defer pool.Close()
+	ctx := context.Background()
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Exec(ctx, "CREATE TABLE t (i INTEGER)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Exec(ctx, "BEGIN TRANSACTION"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Exec(ctx, "INSERT INTO t VALUES (1)"); err != nil {
+		t.Fatal(err)
+	}
+	pool.Release(conn)
+
+	conn, err = pool.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := conn.Begin(ctx, couac.TxOptions{})
+	if err != nil {
+		t.Fatalf("expected no open transaction after release, got %v", err)
+	}
+	if _, err := tx.Exec(ctx, "INSERT INTO t VALUES (2)"); err != nil {
+		t.Fatal(err)
+	}
+	pool.Release(conn)
+
+	conn, err = pool.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Release(conn)
+	if _, err := conn.Begin(ctx, couac.TxOptions{}); err != nil {
+		t.Fatalf("expected Tx to be rolled back on release, got %v", err)
+	}
+	if n := tableCount(t, conn, "t"); n != 0 {
+		t.Errorf("expected uncommitted rows to be rolled back, got %d", n)
+	}
+	if s := pool.Stats(); s.Created != 1 {
+		t.Errorf("expected the connection to be reused, got %+v", s)
+	}
+}
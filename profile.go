@@ -0,0 +1,389 @@
+package couac
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+)
+
+// Profile is the profile DuckDB records for a query, as returned by
+// [Conn.Profile].
+type Profile struct {
+	// Query is the SQL text of the profiled query.
+	Query string
+	// Latency is the wall-clock time the query took, and CPUTime the
+	// sum of the time spent in its operators.
+	Latency, CPUTime time.Duration
+	// BlockedThreadTime is the time threads spent waiting.
+	BlockedThreadTime time.Duration
+	// RowsReturned is the number of rows in the result.
+	RowsReturned int64
+	// ResultSetSize is the size of the result in bytes.
+	ResultSetSize int64
+	// BytesRead and BytesWritten count the bytes read from and written
+	// to storage.
+	BytesRead, BytesWritten int64
+	// PeakBufferMemory and PeakTempDirSize are the highest memory and
+	// temporary directory use of the database while the query ran.
+	PeakBufferMemory, PeakTempDirSize int64
+	// Operators are the roots of the physical operator tree.
+	Operators []*ProfileNode
+}
+
+// ProfileNode is an operator of a [Profile].
+type ProfileNode struct {
+	// Name is the display name of the operator, such as "HASH_GROUP_BY"
+	// or "READ_PARQUET", and Type its physical operator type, such as
+	// "HASH_GROUP_BY" or "TABLE_SCAN".
+	Name, Type string
+	// Timing is the time spent in the operator itself, excluding its
+	// children.
+	Timing time.Duration
+	// Cardinality is the number of rows the operator produced.
+	Cardinality int64
+	// RowsScanned is the number of rows the operator read from tables
+	// or files.
+	RowsScanned int64
+	// ResultSetSize is the size of the operator's output in bytes.
+	ResultSetSize int64
+	// ExtraInfo holds operator details, such as "Projections",
+	// "Filters", or "Estimated Cardinality".
+	ExtraInfo map[string]string
+	// Children are the operators that feed this one.
+	Children []*ProfileNode
+}
+
+// Profile runs query with JSON profiling enabled on the connection and
+// returns the resulting profile along with the query's result. The
+// profiling settings of the connection are restored afterwards, even
+// when the query fails.
+//
+// DuckDB writes the profile once the result has been read, so Profile
+// reads the whole result into memory before returning it. Do not use
+// the connection from other goroutines during the call, as their
+// statements would be profiled in place of query.
+//
+// Example:
+//
+//	profile, res, err := conn.Profile(ctx, "SELECT ...")
+//	if err != nil {
+//	    return err
+//	}
+//	defer res.Close()
+//	if profile.Latency > time.Second {
+//	    log.Printf("slow query:\n%s", profile)
+//	}
+func (q *Conn) Profile(ctx context.Context, query string) (_ *Profile, _ *QueryResult, err error) {
+	if err := q.ensureConnOpen(); err != nil {
+		return nil, nil, err
+	}
+	f, err := os.CreateTemp("", "couac-profile-*.json")
+	if err != nil {
+		return nil, nil, fmt.Errorf("couac: profile: %w", err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	restore, err := q.enableJSONProfiling(ctx, f.Name())
+	if err != nil {
+		return nil, nil, fmt.Errorf("couac: profile: %w", err)
+	}
+	defer func() {
+		if rerr := restore(); rerr != nil && err == nil {
+			err = fmt.Errorf("couac: profile: restore settings: %w", rerr)
+		}
+	}()
+
+	res, err := q.Query(ctx, query)
+	if err != nil {
+		return nil, nil, err
+	}
+	rr, err := readAll(res)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := os.ReadFile(f.Name())
+	if err == nil {
+		var p *Profile
+		if p, err = ParseProfile(data); err == nil {
+			return p, newQueryResult(q.parent, rr, nil, nil, res.RowsAffected, nil), nil
+		}
+	}
+	rr.Release()
+	return nil, nil, fmt.Errorf("couac: profile: %w", err)
+}
+
+// profilingSettings are the settings Profile changes.
+var profilingSettings = []string{"enable_profiling", "profiling_output", "profiling_mode"}
+
+// enableJSONProfiling turns on JSON profiling into path and returns
+// the function that restores the previous profiling settings.
+func (q *Conn) enableJSONProfiling(ctx context.Context, path string) (func() error, error) {
+	q.parent.rlock()
+	defer q.parent.mu.RUnlock()
+
+	var sb strings.Builder
+	sb.WriteString("SELECT ")
+	for i, key := range profilingSettings {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		fmt.Fprintf(&sb, "current_setting(%s)", quoteString(key))
+	}
+	prev, err := q.queryRowInternal(ctx, sb.String())
+	if err != nil {
+		return nil, err
+	}
+	restore := func() error {
+		ctx := context.WithoutCancel(ctx)
+		q.parent.rlock()
+		defer q.parent.mu.RUnlock()
+		for i, key := range profilingSettings {
+			stmt := "RESET " + key
+			if prev[i] != nil {
+				stmt = fmt.Sprintf("SET %s = %s", key, quoteString(*prev[i]))
+			}
+			if _, err := q.execInternal(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, stmt := range []string{
+		"SET profiling_output = " + quoteString(path),
+		"SET enable_profiling = 'json'",
+	} {
+		if _, err := q.execInternal(ctx, stmt); err != nil {
+			restore()
+			return nil, err
+		}
+	}
+	return restore, nil
+}
+
+// queryRowInternal returns the values of the first row of query, with
+// nil for NULL. Caller must already hold the parent's RWMutex read
+// lock.
+func (q *Conn) queryRowInternal(ctx context.Context, query string) ([]*string, error) {
+	stmt, err := q.conn.NewStatement()
+	if err != nil {
+		return nil, fmt.Errorf("couac: new statement: %w", err)
+	}
+	defer stmt.Close()
+	if err := stmt.SetSqlQuery(query); err != nil {
+		return nil, fmt.Errorf("couac: set sql query: %w", q.sqlError(err, query))
+	}
+	rr, _, watch, err := executeQuery(ctx, stmt)
+	if err != nil {
+		return nil, q.sqlError(err, query)
+	}
+	defer watch.stop()
+	defer rr.Release()
+	for rr.Next() {
+		rec := rr.RecordBatch()
+		if rec.NumRows() == 0 {
+			continue
+		}
+		row := make([]*string, rec.NumCols())
+		for i, col := range rec.Columns() {
+			if !col.IsNull(0) {
+				s := cloneStr(col.ValueStr(0))
+				row[i] = &s
+			}
+		}
+		return row, nil
+	}
+	if err := rr.Err(); err != nil {
+		return nil, q.sqlError(err, query)
+	}
+	return nil, fmt.Errorf("couac: no rows returned by %q", query)
+}
+
+// readAll reads the batches of res into memory and closes it.
+func readAll(res *QueryResult) (array.RecordReader, error) {
+	defer res.Close()
+	schema := res.Schema()
+	var recs []arrow.RecordBatch
+	for res.Reader.Next() {
+		rec := res.Reader.RecordBatch()
+		rec.Retain()
+		recs = append(recs, rec)
+	}
+	if err := res.Reader.Err(); err != nil {
+		for _, rec := range recs {
+			rec.Release()
+		}
+		return nil, err
+	}
+	rr, err := array.NewRecordReader(schema, recs)
+	for _, rec := range recs {
+		rec.Release()
+	}
+	return rr, err
+}
+
+// profileJSON mirrors the JSON written by DuckDB's profiler, with
+// durations in seconds. Plans from EXPLAIN (FORMAT JSON) use the same
+// layout, with a name in place of the operator fields.
+type profileJSON struct {
+	Name                   string                     `json:"name"`
+	QueryName              string                     `json:"query_name"`
+	Latency                float64                    `json:"latency"`
+	CPUTime                float64                    `json:"cpu_time"`
+	BlockedThreadTime      float64                    `json:"blocked_thread_time"`
+	RowsReturned           int64                      `json:"rows_returned"`
+	ResultSetSize          int64                      `json:"result_set_size"`
+	TotalBytesRead         int64                      `json:"total_bytes_read"`
+	TotalBytesWritten      int64                      `json:"total_bytes_written"`
+	SystemPeakBufferMemory int64                      `json:"system_peak_buffer_memory"`
+	SystemPeakTempDirSize  int64                      `json:"system_peak_temp_dir_size"`
+	OperatorName           string                     `json:"operator_name"`
+	OperatorType           string                     `json:"operator_type"`
+	OperatorTiming         float64                    `json:"operator_timing"`
+	OperatorCardinality    int64                      `json:"operator_cardinality"`
+	OperatorRowsScanned    int64                      `json:"operator_rows_scanned"`
+	ExtraInfo              map[string]json.RawMessage `json:"extra_info"`
+	Children               []*profileJSON             `json:"children"`
+}
+
+// ParseProfile parses the JSON output of DuckDB's profiler, as written
+// with enable_profiling set to 'json' or returned by EXPLAIN (ANALYZE,
+// FORMAT JSON).
+func ParseProfile(data []byte) (*Profile, error) {
+	var raw profileJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("couac: parse profile: %w", err)
+	}
+	p := &Profile{
+		Query:             raw.QueryName,
+		Latency:           seconds(raw.Latency),
+		CPUTime:           seconds(raw.CPUTime),
+		BlockedThreadTime: seconds(raw.BlockedThreadTime),
+		RowsReturned:      raw.RowsReturned,
+		ResultSetSize:     raw.ResultSetSize,
+		BytesRead:         raw.TotalBytesRead,
+		BytesWritten:      raw.TotalBytesWritten,
+		PeakBufferMemory:  raw.SystemPeakBufferMemory,
+		PeakTempDirSize:   raw.SystemPeakTempDirSize,
+	}
+	for _, c := range raw.Children {
+		p.Operators = append(p.Operators, c.node())
+	}
+	return p, nil
+}
+
+func (r *profileJSON) node() *ProfileNode {
+	n := &ProfileNode{
+		Name:          strings.TrimSpace(r.OperatorName),
+		Type:          r.OperatorType,
+		Timing:        seconds(r.OperatorTiming),
+		Cardinality:   r.OperatorCardinality,
+		RowsScanned:   r.OperatorRowsScanned,
+		ResultSetSize: r.ResultSetSize,
+		ExtraInfo:     extraInfo(r.ExtraInfo),
+	}
+	for _, c := range r.Children {
+		n.Children = append(n.Children, c.node())
+	}
+	return n
+}
+
+// extraInfo converts the extra_info of an operator. Lists, such as the
+// projections of some operators, are joined; other values that are
+// not strings are kept as JSON.
+func extraInfo(raw map[string]json.RawMessage) map[string]string {
+	if len(raw) == 0 {
+		return nil
+	}
+	info := make(map[string]string, len(raw))
+	for k, v := range raw {
+		var s string
+		var list []string
+		switch {
+		case json.Unmarshal(v, &s) == nil:
+		case json.Unmarshal(v, &list) == nil:
+			s = strings.Join(list, ", ")
+		default:
+			s = string(v)
+		}
+		info[k] = s
+	}
+	return info
+}
+
+// seconds converts a duration in seconds reported by DuckDB.
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// Walk calls fn for every operator of the profile, parents before
+// children, with the depth of the operator in the tree.
+func (p *Profile) Walk(fn func(n *ProfileNode, depth int)) {
+	var walk func(nodes []*ProfileNode, depth int)
+	walk = func(nodes []*ProfileNode, depth int) {
+		for _, n := range nodes {
+			fn(n, depth)
+			walk(n.Children, depth+1)
+		}
+	}
+	walk(p.Operators, 0)
+}
+
+// Hotspots returns the n operators that took the most time, slowest
+// first.
+func (p *Profile) Hotspots(n int) []*ProfileNode {
+	var nodes []*ProfileNode
+	p.Walk(func(node *ProfileNode, _ int) { nodes = append(nodes, node) })
+	slices.SortStableFunc(nodes, func(a, b *ProfileNode) int {
+		return cmp.Compare(b.Timing, a.Timing)
+	})
+	return nodes[:min(n, len(nodes))]
+}
+
+// String renders the profile as an indented operator tree, with the
+// time each operator took and its share of the query's operator time:
+//
+//	SELECT k, count(*) FROM t GROUP BY k
+//	latency 6.38ms, 7 rows
+//	ORDER_BY  99µs (2%)  7 rows  [Order By: k ASC]
+//	  HASH_GROUP_BY  3.47ms (61%)  7 rows  [Aggregates: count_star(), ...]
+func (p *Profile) String() string {
+	var total time.Duration
+	p.Walk(func(n *ProfileNode, _ int) { total += n.Timing })
+
+	var sb strings.Builder
+	if p.Query != "" {
+		sb.WriteString(strings.TrimSpace(p.Query))
+		sb.WriteByte('\n')
+	}
+	fmt.Fprintf(&sb, "latency %v, %d rows\n", p.Latency.Round(10*time.Microsecond), p.RowsReturned)
+	p.Walk(func(n *ProfileNode, depth int) {
+		sb.WriteString(strings.Repeat("  ", depth))
+		fmt.Fprintf(&sb, "%s  %v", n.Name, n.Timing.Round(time.Microsecond))
+		if total > 0 {
+			fmt.Fprintf(&sb, " (%.0f%%)", 100*float64(n.Timing)/float64(total))
+		}
+		fmt.Fprintf(&sb, "  %d rows", n.Cardinality)
+		if len(n.ExtraInfo) > 0 {
+			sb.WriteString("  [")
+			for i, k := range slices.Sorted(maps.Keys(n.ExtraInfo)) {
+				if i > 0 {
+					sb.WriteString(", ")
+				}
+				fmt.Fprintf(&sb, "%s: %s", k, strings.ReplaceAll(n.ExtraInfo[k], "\n", " "))
+			}
+			sb.WriteByte(']')
+		}
+		sb.WriteByte('\n')
+	})
+	return sb.String()
+}
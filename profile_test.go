@@ -0,0 +1,121 @@
+package couac_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/loicalleyne/couac"
+)
+
+// profilingSettings returns the profiling settings of conn.
+func profilingSettings(t *testing.T, conn *couac.Conn) []string {
+	t.Helper()
+	var values []string
+	for _, key := range []string{"enable_profiling", "profiling_output", "profiling_mode"} {
+		v, err := conn.Setting(context.Background(), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		values = append(values, v)
+	}
+	return values
+}
+
+func TestProfile(t *testing.T) {
+	_, conn := newTestConn(t)
+	ctx := context.Background()
+	if _, err := conn.Exec(ctx, "CREATE TABLE t AS SELECT range % 7 AS k, range AS v FROM range(10000)"); err != nil {
+		t.Fatal(err)
+	}
+	before := profilingSettings(t, conn)
+
+	profile, res, err := conn.Profile(ctx, "SELECT k, count(*) FROM t WHERE v > 10 GROUP BY k ORDER BY k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows int64
+	for res.Reader.Next() {
+		rows += res.Reader.RecordBatch().NumRows()
+	}
+	res.Close()
+	if rows != 7 || profile.RowsReturned != 7 {
+		t.Errorf("expected 7 rows, got %d read and %d profiled", rows, profile.RowsReturned)
+	}
+	if !strings.Contains(profile.Query, "GROUP BY k") || profile.Latency <= 0 || len(profile.Operators) == 0 {
+		t.Errorf("unexpected profile %+v", profile)
+	}
+
+	var scan *couac.ProfileNode
+	profile.Walk(func(n *couac.ProfileNode, _ int) {
+		if n.Type == "TABLE_SCAN" {
+			scan = n
+		}
+	})
+	if scan == nil || scan.ExtraInfo["Table"] != "t" || scan.RowsScanned != 10000 {
+		t.Fatalf("expected a scan of t in the profile, got %+v", scan)
+	}
+	hot := profile.Hotspots(2)
+	if len(hot) != 2 || hot[0].Timing < hot[1].Timing {
+		t.Errorf("expected the 2 slowest operators, got %+v", hot)
+	}
+	if text := profile.String(); !strings.Contains(text, "SEQ_SCAN") || !strings.Contains(text, "\n  ") {
+		t.Errorf("unexpected rendering:\n%s", text)
+	}
+
+	if after := profilingSettings(t, conn); strings.Join(after, ",") != strings.Join(before, ",") {
+		t.Errorf("profiling settings = %q, want %q", after, before)
+	}
+}
+
+func TestProfile_RestoresOnError(t *testing.T) {
+	_, conn := newTestConn(t)
+	ctx := context.Background()
+	if err := conn.EnableProfiling(ctx, "query_tree"); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.SetProfilingOutput(ctx, t.TempDir()+"/tree.txt"); err != nil {
+		t.Fatal(err)
+	}
+	before := profilingSettings(t, conn)
+
+	if _, _, err := conn.Profile(ctx, "SELECT * FROM missing"); !errors.Is(err, couac.ErrCatalog) {
+		t.Fatalf("expected a catalog error, got %v", err)
+	}
+	if after := profilingSettings(t, conn); strings.Join(after, ",") != strings.Join(before, ",") {
+		t.Errorf("profiling settings = %q, want %q", after, before)
+	}
+}
+
+func TestParseProfile(t *testing.T) {
+	p, err := couac.ParseProfile([]byte(`{
+		"query_name": "SELECT a FROM t", "latency": 0.5, "rows_returned": 3,
+		"children": [{
+			"operator_name": "PROJECTION", "operator_type": "PROJECTION", "operator_timing": 0.1,
+			"operator_cardinality": 3, "extra_info": {"Projections": ["a", "b"]},
+			"children": [{
+				"operator_name": "SEQ_SCAN ", "operator_type": "TABLE_SCAN", "operator_timing": 0.3,
+				"operator_cardinality": 3, "operator_rows_scanned": 10, "extra_info": {"Table": "t"},
+				"children": []
+			}]
+		}]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Latency != 500*time.Millisecond || p.RowsReturned != 3 {
+		t.Errorf("unexpected profile %+v", p)
+	}
+	proj := p.Operators[0]
+	if proj.ExtraInfo["Projections"] != "a, b" || len(proj.Children) != 1 {
+		t.Errorf("unexpected projection %+v", proj)
+	}
+	if hot := p.Hotspots(5); len(hot) != 2 || hot[0].Name != "SEQ_SCAN" {
+		t.Errorf("unexpected hotspots %+v", hot)
+	}
+	if _, err := couac.ParseProfile([]byte("not json")); err == nil {
+		t.Error("expected a parse error")
+	}
+}
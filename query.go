@@ -5,11 +5,13 @@ import (
 	"fmt"
 
 	"github.com/apache/arrow-adbc/go/adbc"
+	"github.com/apache/arrow-go/v18/arrow"
 	"github.com/apache/arrow-go/v18/arrow/array"
 )
 
-// execOnTxConn executes a SQL statement on a raw ADBC connection.
-func execOnTxConn(ctx context.Context, conn adbc.Connection, sql string) error {
+// execOnTxConn executes a SQL statement on a raw ADBC connection of q,
+// classifying errors like statements on its connections.
+func (q *DB) execOnTxConn(ctx context.Context, conn adbc.Connection, sql string) error {
 	stmt, err := conn.NewStatement()
 	if err != nil {
 		return err
@@ -18,13 +20,14 @@ func execOnTxConn(ctx context.Context, conn adbc.Connection, sql string) error {
 	if err := stmt.SetSqlQuery(sql); err != nil {
 		return err
 	}
-	_, err = stmt.ExecuteUpdate(ctx)
-	return err
+	_, err = executeUpdate(ctx, stmt)
+	return classifyError(err, sql, q.redactSQL)
 }
 
 // rollbackConn issues a ROLLBACK on a raw ADBC connection, ignoring errors.
-func rollbackConn(ctx context.Context, conn adbc.Connection) {
-	_ = execOnTxConn(ctx, conn, "ROLLBACK")
+// The rollback runs even if ctx has been cancelled.
+func (q *DB) rollbackConn(ctx context.Context, conn adbc.Connection) {
+	_ = q.execOnTxConn(context.WithoutCancel(ctx), conn, "ROLLBACK")
 }
 
 // Exec executes a statement that does not generate a result set (DDL, DML).
@@ -32,11 +35,20 @@ func rollbackConn(ctx context.Context, conn adbc.Connection) {
 //
 // Exec acquires a read lock on the parent database, allowing concurrent
 // execution with other operations but blocking during maintenance.
-func (q *Conn) Exec(ctx context.Context, query string) (int64, error) {
+// Cancelling ctx interrupts the statement inside DuckDB; the returned
+// error then wraps [context.Canceled] or [context.DeadlineExceeded].
+// Statements that cannot be interrupted run to completion, and a
+// failure also wraps [ErrCancelNotSupported].
+func (q *Conn) Exec(ctx context.Context, query string) (n int64, err error) {
 	if err := q.ensureConnOpen(); err != nil {
 		return 0, err
 	}
-	q.parent.mu.RLock()
+	ctx, query, _, after, err := q.parent.beforeStatement(ctx, hookExec, "Exec", query, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { after.run(n, err) }()
+	q.parent.rlock()
 	defer q.parent.mu.RUnlock()
 
 	stmt, err := q.conn.NewStatement()
@@ -46,11 +58,12 @@ func (q *Conn) Exec(ctx context.Context, query string) (int64, error) {
 	defer stmt.Close()
 
 	if err := stmt.SetSqlQuery(query); err != nil {
-		return 0, fmt.Errorf("couac: set sql query: %w", err)
+		return 0, fmt.Errorf("couac: set sql query: %w", q.sqlError(err, query))
 	}
-	n, err := stmt.ExecuteUpdate(ctx)
+	n, err = executeUpdate(ctx, stmt)
+	q.trackTxStatement(query, err)
 	if err != nil {
-		return n, fmt.Errorf("couac: execute update: %w", err)
+		return n, fmt.Errorf("couac: execute update: %w", q.sqlError(err, query))
 	}
 	return n, nil
 }
@@ -62,6 +75,12 @@ func (q *Conn) Exec(ctx context.Context, query string) (int64, error) {
 // Query acquires a read lock only for the statement execution; the
 // returned RecordReader can be consumed after the lock is released.
 //
+// Cancelling ctx interrupts the query inside DuckDB, both while it
+// executes and while the Reader is consumed: the Reader then stops and
+// its Err reports an error wrapping [context.Canceled] or
+// [context.DeadlineExceeded], and [ErrCancelNotSupported] if the
+// running statement could not be interrupted.
+//
 // Example:
 //
 //	res, err := conn.Query(ctx, "SELECT * FROM users WHERE age > 21")
@@ -73,11 +92,20 @@ func (q *Conn) Exec(ctx context.Context, query string) (int64, error) {
 //	    rec := res.Reader.RecordBatch()
 //	    // process rec...
 //	}
-func (q *Conn) Query(ctx context.Context, query string) (*QueryResult, error) {
+func (q *Conn) Query(ctx context.Context, query string) (_ *QueryResult, err error) {
 	if err := q.ensureConnOpen(); err != nil {
 		return nil, err
 	}
-	q.parent.mu.RLock()
+	ctx, query, _, after, err := q.parent.beforeStatement(ctx, hookQuery, "Query", query, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			after.run(-1, err)
+		}
+	}()
+	q.parent.rlock()
 	defer q.parent.mu.RUnlock()
 
 	stmt, err := q.conn.NewStatement()
@@ -87,20 +115,263 @@ func (q *Conn) Query(ctx context.Context, query string) (*QueryResult, error) {
 
 	if err := stmt.SetSqlQuery(query); err != nil {
 		stmt.Close()
-		return nil, fmt.Errorf("couac: set sql query: %w", err)
+		return nil, fmt.Errorf("couac: set sql query: %w", q.sqlError(err, query))
 	}
 
-	rr, n, err := stmt.ExecuteQuery(ctx)
+	rr, n, watch, err := executeQuery(ctx, stmt)
+	if err != nil {
+		stmt.Close()
+		return nil, fmt.Errorf("couac: execute query: %w", q.sqlError(err, query))
+	}
+	return newQueryResult(q.parent, rr, stmt, watch, n, after), nil
+}
+
+// ExecArgs executes a parameterized statement that does not generate a
+// result set. Placeholders may use either the ? or $N style; args are
+// bound positionally. It returns the number of rows affected if known,
+// otherwise -1.
+//
+// Arguments are converted to Arrow with the same mapping as the
+// database/sql bridge (see [DB.StdDB]): sized integers widen to int64,
+// float32 widens to float64, pointers are dereferenced, and
+// [database/sql/driver.Valuer] implementations are honoured. [Decimal]
+// and [NullDecimal] bind as DECIMAL; [List], [Struct], and [Map] bind
+// as JSON strings.
+//
+// Example:
+//
+//	n, err := conn.ExecArgs(ctx, "DELETE FROM users WHERE id = ?", 42)
+func (q *Conn) ExecArgs(ctx context.Context, query string, args ...any) (n int64, err error) {
+	if err := q.ensureConnOpen(); err != nil {
+		return 0, err
+	}
+	ctx, query, args, after, err := q.parent.beforeStatement(ctx, hookExec, "ExecArgs", query, args)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { after.run(n, err) }()
+	nvs, err := argsToNamedValues(args)
+	if err != nil {
+		return 0, err
+	}
+	q.parent.rlock()
+	defer q.parent.mu.RUnlock()
+
+	stmt, err := q.conn.NewStatement()
+	if err != nil {
+		return 0, fmt.Errorf("couac: new statement: %w", err)
+	}
+	defer stmt.Close()
+
+	if err := stmt.SetSqlQuery(query); err != nil {
+		return 0, fmt.Errorf("couac: set sql query: %w", q.sqlError(err, query))
+	}
+	if err := bindArgs(ctx, stmt, nvs); err != nil {
+		return 0, fmt.Errorf("couac: bind parameters: %w", err)
+	}
+	n, err = executeUpdate(ctx, stmt)
+	q.trackTxStatement(query, err)
+	if err != nil {
+		return n, fmt.Errorf("couac: execute update: %w", q.sqlError(err, query))
+	}
+	return n, nil
+}
+
+// QueryArgs executes a parameterized SQL query and returns a
+// [QueryResult]. Placeholders may use either the ? or $N style; args
+// are bound positionally using the same conversions as [Conn.ExecArgs].
+// The caller must call [QueryResult.Close] when done reading results.
+//
+// Example:
+//
+//	res, err := conn.QueryArgs(ctx,
+//	    "SELECT * FROM events WHERE ts > $1 AND category = $2",
+//	    since, category)
+//	if err != nil {
+//	    return err
+//	}
+//	defer res.Close()
+func (q *Conn) QueryArgs(ctx context.Context, query string, args ...any) (_ *QueryResult, err error) {
+	if err := q.ensureConnOpen(); err != nil {
+		return nil, err
+	}
+	ctx, query, args, after, err := q.parent.beforeStatement(ctx, hookQuery, "QueryArgs", query, args)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			after.run(-1, err)
+		}
+	}()
+	nvs, err := argsToNamedValues(args)
+	if err != nil {
+		return nil, err
+	}
+	q.parent.rlock()
+	defer q.parent.mu.RUnlock()
+
+	stmt, err := q.conn.NewStatement()
+	if err != nil {
+		return nil, fmt.Errorf("couac: new statement: %w", err)
+	}
+
+	if err := stmt.SetSqlQuery(query); err != nil {
+		stmt.Close()
+		return nil, fmt.Errorf("couac: set sql query: %w", q.sqlError(err, query))
+	}
+	if err := bindArgs(ctx, stmt, nvs); err != nil {
+		stmt.Close()
+		return nil, fmt.Errorf("couac: bind parameters: %w", err)
+	}
+
+	rr, n, watch, err := executeQuery(ctx, stmt)
 	if err != nil {
 		stmt.Close()
-		return nil, fmt.Errorf("couac: execute query: %w", err)
+		return nil, fmt.Errorf("couac: execute query: %w", q.sqlError(err, query))
 	}
+	return newQueryResult(q.parent, rr, stmt, watch, n, after), nil
+}
 
-	return &QueryResult{
-		Reader:       rr,
-		stmt:         stmt,
-		RowsAffected: n,
-	}, nil
+// ExecBatch executes a parameterized statement once for each row of
+// args. The statement is prepared once and every parameter row is bound
+// and executed in turn; DuckDB's ADBC driver only binds a single row at
+// a time, so this is the way to apply many tuples through statements
+// that [Conn.Ingest] cannot express (e.g. INSERT ... ON CONFLICT).
+//
+// All rows run inside a single transaction: if any row fails, the
+// transaction is rolled back, the returned [BatchResult] records the
+// index of the failing row, and the error identifies it. When the
+// connection is already inside a transaction (see [DB.WithTransaction]),
+// ExecBatch joins it instead of starting its own.
+//
+// Parameter values follow the same conversions as [Conn.ExecArgs].
+//
+// Example:
+//
+//	res, err := conn.ExecBatch(ctx,
+//	    "INSERT INTO kv VALUES (?, ?) ON CONFLICT (k) DO UPDATE SET v = excluded.v",
+//	    [][]any{{"a", 1}, {"b", 2}, {"a", 3}})
+//	if err != nil {
+//	    log.Printf("row %d failed: %v", res.FailedRow, err)
+//	}
+func (q *Conn) ExecBatch(ctx context.Context, query string, args [][]any) (*BatchResult, error) {
+	rows := make([]any, len(args))
+	for i, row := range args {
+		rows[i] = row
+	}
+	return q.execBatch(ctx, "ExecBatch", query, len(rows), rows, func(ctx context.Context, stmt adbc.Statement, rows []any, i int) error {
+		row, ok := rows[i].([]any)
+		if !ok {
+			return fmt.Errorf("couac: parameter row is %T, not []any", rows[i])
+		}
+		nvs, err := argsToNamedValues(row)
+		if err != nil {
+			return err
+		}
+		return bindArgs(ctx, stmt, nvs)
+	})
+}
+
+// ExecBatchRecord is like [Conn.ExecBatch] but takes its parameter rows
+// from an Arrow record batch: each row of params is bound in turn, with
+// columns mapped to placeholders by position.
+func (q *Conn) ExecBatchRecord(ctx context.Context, query string, params arrow.RecordBatch) (*BatchResult, error) {
+	if params == nil {
+		return nil, ErrNilRecord
+	}
+	return q.execBatch(ctx, "ExecBatchRecord", query, int(params.NumRows()), nil, func(ctx context.Context, stmt adbc.Statement, _ []any, i int) error {
+		row := params.NewSlice(int64(i), int64(i+1))
+		defer row.Release()
+		return stmt.Bind(ctx, row)
+	})
+}
+
+// execBatch prepares query and executes it n times, calling bind before
+// each execution to bind the parameters for row i with the context
+// returned by the hooks. rows, if not nil, holds the parameter rows
+// passed to hooks, which may replace them; bind receives them. op names
+// the calling method for hooks.
+func (q *Conn) execBatch(ctx context.Context, op, query string, n int, rows []any, bind func(ctx context.Context, stmt adbc.Statement, rows []any, i int) error) (res *BatchResult, err error) {
+	if err := q.ensureConnOpen(); err != nil {
+		return nil, err
+	}
+	hasRows := rows != nil
+	ctx, query, rows, after, err := q.parent.beforeBatch(ctx, op, query, n, rows)
+	if err != nil {
+		return nil, err
+	}
+	if hasRows {
+		n = len(rows)
+	}
+	defer func() {
+		var rows int64
+		if res != nil {
+			for _, r := range res.RowsAffected {
+				rows += max(r, 0)
+			}
+		}
+		after.run(rows, err)
+	}()
+	q.parent.rlock()
+	defer q.parent.mu.RUnlock()
+
+	res = &BatchResult{
+		RowsAffected: make([]int64, 0, n),
+		FailedRow:    -1,
+	}
+	if n == 0 {
+		return res, nil
+	}
+
+	stmt, err := q.conn.NewStatement()
+	if err != nil {
+		return res, fmt.Errorf("couac: new statement: %w", err)
+	}
+	defer stmt.Close()
+
+	if err := stmt.SetSqlQuery(query); err != nil {
+		return res, fmt.Errorf("couac: set sql query: %w", q.sqlError(err, query))
+	}
+	if err := stmt.Prepare(ctx); err != nil {
+		return res, fmt.Errorf("couac: prepare: %w", q.sqlError(err, query))
+	}
+
+	ownTx := !q.inTransaction()
+	if ownTx {
+		if err := q.parent.execOnTxConn(ctx, q.conn, "BEGIN TRANSACTION"); err != nil {
+			return res, fmt.Errorf("couac: begin transaction: %w", err)
+		}
+	}
+
+	for i := range n {
+		if err := bind(ctx, stmt, rows, i); err != nil {
+			return q.failBatch(ctx, res, ownTx, i, fmt.Errorf("couac: exec batch row %d: bind: %w", i, err))
+		}
+		affected, err := executeUpdate(ctx, stmt)
+		if err != nil {
+			return q.failBatch(ctx, res, ownTx, i, fmt.Errorf("couac: exec batch row %d: %w", i, q.sqlError(err, query)))
+		}
+		res.RowsAffected = append(res.RowsAffected, affected)
+	}
+
+	if ownTx {
+		if err := q.parent.execOnTxConn(ctx, q.conn, "COMMIT"); err != nil {
+			q.parent.rollbackConn(ctx, q.conn)
+			return res, fmt.Errorf("couac: commit: %w", err)
+		}
+	}
+	return res, nil
+}
+
+// failBatch records the failing row on res and rolls back the batch
+// transaction if execBatch started it.
+func (q *Conn) failBatch(ctx context.Context, res *BatchResult, ownTx bool, row int, err error) (*BatchResult, error) {
+	res.FailedRow = row
+	if ownTx {
+		q.parent.rollbackConn(ctx, q.conn)
+	}
+	return res, err
 }
 
 // QueryRaw executes a SQL query and returns the raw components: a
@@ -110,11 +381,18 @@ func (q *Conn) Query(ctx context.Context, query string) (*QueryResult, error) {
 //
 // The caller is responsible for closing both the RecordReader and the
 // Statement. Prefer [Conn.Query] for simpler resource management.
-func (q *Conn) QueryRaw(ctx context.Context, query string) (array.RecordReader, adbc.Statement, int64, error) {
+// Cancelling ctx interrupts the execution but not the reading of the
+// returned RecordReader; use [Conn.Query] for that.
+func (q *Conn) QueryRaw(ctx context.Context, query string) (_ array.RecordReader, _ adbc.Statement, n int64, err error) {
 	if err := q.ensureConnOpen(); err != nil {
 		return nil, nil, 0, err
 	}
-	q.parent.mu.RLock()
+	ctx, query, _, after, err := q.parent.beforeStatement(ctx, hookQuery, "QueryRaw", query, nil)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	defer func() { after.run(n, err) }()
+	q.parent.rlock()
 	defer q.parent.mu.RUnlock()
 
 	stmt, err := q.conn.NewStatement()
@@ -123,12 +401,14 @@ func (q *Conn) QueryRaw(ctx context.Context, query string) (array.RecordReader,
 	}
 	if err := stmt.SetSqlQuery(query); err != nil {
 		stmt.Close()
-		return nil, nil, 0, fmt.Errorf("couac: set sql query: %w", err)
+		return nil, nil, 0, fmt.Errorf("couac: set sql query: %w", q.sqlError(err, query))
 	}
+	w := watchCancel(ctx, stmt)
 	rr, n, err := stmt.ExecuteQuery(ctx)
+	w.stop()
 	if err != nil {
 		stmt.Close()
-		return nil, nil, 0, fmt.Errorf("couac: execute query: %w", err)
+		return nil, nil, 0, fmt.Errorf("couac: execute query: %w", q.sqlError(w.err(err), query))
 	}
 	return rr, stmt, n, nil
 }
@@ -164,7 +444,7 @@ func (q *Conn) Prepare(ctx context.Context, query string) (Statement, error) {
 	if err := q.ensureConnOpen(); err != nil {
 		return nil, err
 	}
-	q.parent.mu.RLock()
+	q.parent.rlock()
 	defer q.parent.mu.RUnlock()
 
 	stmt, err := q.conn.NewStatement()
@@ -173,11 +453,11 @@ func (q *Conn) Prepare(ctx context.Context, query string) (Statement, error) {
 	}
 	if err := stmt.SetSqlQuery(query); err != nil {
 		stmt.Close()
-		return nil, fmt.Errorf("couac: set sql query: %w", err)
+		return nil, fmt.Errorf("couac: set sql query: %w", q.sqlError(err, query))
 	}
 	if err := stmt.Prepare(ctx); err != nil {
 		stmt.Close()
-		return nil, fmt.Errorf("couac: prepare: %w", err)
+		return nil, fmt.Errorf("couac: prepare: %w", q.sqlError(err, query))
 	}
 	return stmt, nil
 }
@@ -188,8 +468,9 @@ func (q *Conn) Prepare(ctx context.Context, query string) (Statement, error) {
 // The dedicated connection is closed after the transaction completes.
 //
 // DuckDB uses optimistic concurrency control. If fn modifies rows that
-// are concurrently modified by another transaction, DuckDB may return a
-// "Transaction conflict" error.
+// are concurrently modified by another transaction, DuckDB may return an
+// error matching [ErrTransactionConflict]; use [DB.WithTransactionOpts]
+// to retry such transactions.
 //
 // Example:
 //
@@ -199,47 +480,6 @@ func (q *Conn) Prepare(ctx context.Context, query string) (Statement, error) {
 //	    _, err = tx.Exec(ctx, "INSERT INTO t2 VALUES (2)")
 //	    return err
 //	})
-func (q *DB) WithTransaction(ctx context.Context, fn func(*Conn) error) (retErr error) {
-	if err := q.ensureOpen(); err != nil {
-		return err
-	}
-
-	// Open a dedicated connection for the transaction
-	conn, err := q.db.Open(ctx)
-	if err != nil {
-		return fmt.Errorf("couac: open transaction connection: %w", err)
-	}
-
-	txConn := &Conn{
-		parent: q,
-		conn:   conn,
-	}
-	defer func() {
-		// Don't track this connection in ducklings - it's ephemeral
-		if r := recover(); r != nil {
-			rollbackConn(ctx, conn)
-			txConn.closed.Store(true)
-			conn.Close()
-			panic(r) // re-panic after rollback
-		}
-		txConn.closed.Store(true)
-		conn.Close()
-	}()
-
-	// Disable auto-commit to start a transaction by executing BEGIN
-	if err := execOnTxConn(ctx, conn, "BEGIN TRANSACTION"); err != nil {
-		return fmt.Errorf("couac: begin transaction: %w", err)
-	}
-
-	retErr = fn(txConn)
-
-	if retErr != nil {
-		rollbackConn(ctx, conn)
-		return retErr
-	}
-
-	if err := execOnTxConn(ctx, conn, "COMMIT"); err != nil {
-		return fmt.Errorf("couac: commit: %w", err)
-	}
-	return nil
+func (q *DB) WithTransaction(ctx context.Context, fn func(*Conn) error) error {
+	return q.WithTransactionOpts(ctx, TxOptions{}, fn)
 }
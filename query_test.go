@@ -2,7 +2,9 @@ package couac_test
 
 import (
 	"context"
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/loicalleyne/couac"
 )
@@ -112,6 +114,186 @@ func TestQueryResult_Close(t *testing.T) {
 	}
 }
 
+func TestExecArgs_Insert(t *testing.T) {
+	_, conn := newTestConn(t)
+	ctx := context.Background()
+
+	_, err := conn.Exec(ctx, "CREATE TABLE test_exec_args (id INT, name VARCHAR, score DOUBLE)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// int and float32 widen via the default parameter converter.
+	if _, err := conn.ExecArgs(ctx, "INSERT INTO test_exec_args VALUES (?, ?, ?)", 1, "alice", float32(1.5)); err != nil {
+		t.Fatalf("ExecArgs ?: %v", err)
+	}
+	if _, err := conn.ExecArgs(ctx, "INSERT INTO test_exec_args VALUES ($1, $2, $3)", int64(2), "o'brien", nil); err != nil {
+		t.Fatalf("ExecArgs $N: %v", err)
+	}
+
+	res, err := conn.Query(ctx, "SELECT name FROM test_exec_args WHERE id = 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Close()
+	if !res.Reader.Next() {
+		t.Fatal("expected a record batch")
+	}
+	if got := res.Reader.RecordBatch().Column(0).ValueStr(0); got != "o'brien" {
+		t.Errorf("expected %q, got %q", "o'brien", got)
+	}
+}
+
+func TestQueryArgs(t *testing.T) {
+	_, conn := newTestConn(t)
+	ctx := context.Background()
+
+	_, err := conn.Exec(ctx, "CREATE TABLE test_query_args (id INT, name VARCHAR)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = conn.Exec(ctx, "INSERT INTO test_query_args VALUES (1, 'alice'), (2, 'bob'), (3, 'carol')")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A value that would break naive string formatting.
+	res, err := conn.QueryArgs(ctx, "SELECT count(*) FROM test_query_args WHERE name = ? OR id > $2", "x' OR '1'='1", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Close()
+	if !res.Reader.Next() {
+		t.Fatal("expected a record batch")
+	}
+	if got := res.Reader.RecordBatch().Column(0).ValueStr(0); got != "2" {
+		t.Errorf("expected 2, got %s", got)
+	}
+}
+
+func TestQueryArgs_UnsupportedType(t *testing.T) {
+	_, conn := newTestConn(t)
+
+	_, err := conn.QueryArgs(context.Background(), "SELECT ?", struct{}{})
+	if err == nil {
+		t.Fatal("expected error for unsupported parameter type")
+	}
+}
+
+func TestExecBatch_Upsert(t *testing.T) {
+	_, conn := newTestConn(t)
+	ctx := context.Background()
+
+	_, err := conn.Exec(ctx, "CREATE TABLE test_batch (k VARCHAR PRIMARY KEY, v INT)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := conn.ExecBatch(ctx,
+		"INSERT INTO test_batch VALUES (?, ?) ON CONFLICT (k) DO UPDATE SET v = excluded.v",
+		[][]any{{"a", 1}, {"b", 2}, {"a", 3}})
+	if err != nil {
+		t.Fatalf("ExecBatch: %v", err)
+	}
+	if res.FailedRow != -1 {
+		t.Errorf("expected FailedRow -1, got %d", res.FailedRow)
+	}
+	if len(res.RowsAffected) != 3 {
+		t.Errorf("expected 3 per-row counts, got %d", len(res.RowsAffected))
+	}
+
+	qr, err := conn.Query(ctx, "SELECT v FROM test_batch WHERE k = 'a'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer qr.Close()
+	if !qr.Reader.Next() {
+		t.Fatal("expected a record batch")
+	}
+	if got := qr.Reader.RecordBatch().Column(0).ValueStr(0); got != "3" {
+		t.Errorf("expected upserted value 3, got %s", got)
+	}
+}
+
+func TestExecBatch_RollbackOnFailure(t *testing.T) {
+	_, conn := newTestConn(t)
+	ctx := context.Background()
+
+	_, err := conn.Exec(ctx, "CREATE TABLE test_batch_fail (id INT PRIMARY KEY)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := conn.ExecBatch(ctx, "INSERT INTO test_batch_fail VALUES (?)",
+		[][]any{{1}, {2}, {2}, {3}})
+	if err == nil {
+		t.Fatal("expected constraint violation")
+	}
+	if res == nil || res.FailedRow != 2 {
+		t.Fatalf("expected FailedRow 2, got %+v", res)
+	}
+
+	qr, err := conn.Query(ctx, "SELECT count(*) FROM test_batch_fail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer qr.Close()
+	if qr.Reader.Next() {
+		if got := qr.Reader.RecordBatch().Column(0).ValueStr(0); got != "0" {
+			t.Errorf("expected 0 rows after rollback, got %s", got)
+		}
+	}
+}
+
+func TestExecBatchRecord(t *testing.T) {
+	_, conn := newTestConn(t)
+	ctx := context.Background()
+
+	_, err := conn.Exec(ctx, "CREATE TABLE test_batch_rec (id INT, name VARCHAR)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := makeTestRecord(t, 4)
+	defer params.Release()
+
+	res, err := conn.ExecBatchRecord(ctx, "INSERT INTO test_batch_rec VALUES ($1, $2)", params)
+	if err != nil {
+		t.Fatalf("ExecBatchRecord: %v", err)
+	}
+	if len(res.RowsAffected) != 4 {
+		t.Errorf("expected 4 per-row counts, got %d", len(res.RowsAffected))
+	}
+
+	qr, err := conn.Query(ctx, "SELECT count(*) FROM test_batch_rec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer qr.Close()
+	if qr.Reader.Next() {
+		if got := qr.Reader.RecordBatch().Column(0).ValueStr(0); got != "4" {
+			t.Errorf("expected 4 rows, got %s", got)
+		}
+	}
+}
+
+func TestExecBatch_InTransaction(t *testing.T) {
+	db := newTestDB(t)
+	conn, err := db.Connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ctx := context.Background()
+
+	if _, err := conn.Exec(ctx, "CREATE TABLE test_batch_tx (id INT)"); err != nil {
+		t.Fatal(err)
+	}
+	err = db.WithTransaction(ctx, func(tx *couac.Conn) error {
+		_, err := tx.ExecBatch(ctx, "INSERT INTO test_batch_tx VALUES (?)", [][]any{{1}, {2}})
+		return err
+	})
+	if err != nil {
+		t.Fatalf("ExecBatch inside WithTransaction: %v", err)
+	}
+}
+
 func TestPrepare(t *testing.T) {
 	_, conn := newTestConn(t)
 	ctx := context.Background()
@@ -214,3 +396,126 @@ func TestWithTransaction_Rollback(t *testing.T) {
 		}
 	}
 }
+
+// slowQuery runs for far longer than any test timeout unless interrupted.
+const slowQuery = "SELECT count(*) FROM range(100000000000) a"
+
+func TestExec_ContextCancel(t *testing.T) {
+	_, conn := newTestConn(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := conn.Exec(ctx, slowQuery)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if d := time.Since(start); d > 10*time.Second {
+		t.Errorf("query was not interrupted, took %v", d)
+	}
+
+	// The connection stays usable after the interrupt.
+	if _, err := conn.Exec(context.Background(), "SELECT 1"); err != nil {
+		t.Fatalf("connection unusable after cancel: %v", err)
+	}
+}
+
+func TestQuery_ContextCancel(t *testing.T) {
+	_, conn := newTestConn(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(200*time.Millisecond, cancel)
+
+	start := time.Now()
+	res, err := conn.Query(ctx, slowQuery)
+	if err == nil {
+		for res.Reader.Next() {
+		}
+		err = res.Reader.Err()
+		res.Close()
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if d := time.Since(start); d > 10*time.Second {
+		t.Errorf("query was not interrupted, took %v", d)
+	}
+}
+
+func TestQuery_ContextCancelStopsReader(t *testing.T) {
+	_, conn := newTestConn(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	res, err := conn.Query(ctx, "SELECT * FROM range(10000000)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Close()
+	if !res.Reader.Next() {
+		t.Fatal("expected a first batch")
+	}
+	cancel()
+	if res.Reader.Next() {
+		t.Error("expected reader to stop after cancel")
+	}
+	if !errors.Is(res.Reader.Err(), context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", res.Reader.Err())
+	}
+}
+
+func TestQuery_ContextCancelAfterEOF(t *testing.T) {
+	_, conn := newTestConn(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	res, err := conn.Query(ctx, "SELECT * FROM range(100000)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Close()
+	for res.Reader.Next() {
+	}
+	if err := res.Reader.Err(); err != nil {
+		t.Fatal(err)
+	}
+	// Cancelling the context of a fully read result must not interrupt
+	// later statements on the connection.
+	cancel()
+	for range 20 {
+		if _, err := conn.Exec(context.Background(), "SELECT count(*) FROM range(1000000)"); err != nil {
+			t.Fatalf("statement interrupted after the result was read: %v", err)
+		}
+	}
+}
+
+func TestWithTransaction_ContextCancel(t *testing.T) {
+	db, conn := newTestConn(t)
+	bg := context.Background()
+	if _, err := conn.Exec(bg, "CREATE TABLE tx_cancel (id INT)"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(bg, 200*time.Millisecond)
+	defer cancel()
+	err := db.WithTransaction(ctx, func(tx *couac.Conn) error {
+		if _, err := tx.Exec(ctx, "INSERT INTO tx_cancel VALUES (1)"); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, slowQuery)
+		return err
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+
+	// The rollback runs despite the cancelled context.
+	count, err := couac.QueryAs[struct {
+		N int64 `couac:"n"`
+	}](bg, conn, "SELECT count(*) AS n FROM tx_cancel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count[0].N != 0 {
+		t.Errorf("expected 0 rows after rollback, got %d", count[0].N)
+	}
+}
@@ -0,0 +1,177 @@
+package couac_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/loicalleyne/couac"
+)
+
+// writeTestDB creates the database file path with a table t of n rows.
+func writeTestDB(t *testing.T, path string, n int) {
+	t.Helper()
+	db := newTestDB(t, couac.WithPath(path))
+	conn, err := db.Connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Exec(context.Background(), fmt.Sprintf("CREATE TABLE t AS SELECT * FROM range(%d)", n)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWithReadOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shared.db")
+	writeTestDB(t, path, 3)
+	ctx := context.Background()
+
+	r1 := newTestDB(t, couac.WithPath(path), couac.WithReadOnly())
+	r2 := newTestDB(t, couac.WithPath(path), couac.WithReadOnly())
+	if _, err := couac.NewDuck(couac.WithDriverName("duckdb"), couac.WithPath(path)); !errors.Is(err, couac.ErrPathAlreadyOpen) {
+		t.Errorf("expected ErrPathAlreadyOpen for a writer, got %v", err)
+	}
+	for _, db := range []*couac.DB{r1, r2} {
+		conn, err := db.Connect()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		if n := tableCount(t, conn, "t"); n != 3 {
+			t.Errorf("expected 3 rows, got %d", n)
+		}
+	}
+
+	conn, err := r1.Connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	rec := makeTestRecord(t, 2)
+	defer rec.Release()
+	if _, err := conn.Ingest(ctx, "t2", rec); !errors.Is(err, couac.ErrReadOnly) {
+		t.Errorf("Ingest: expected ErrReadOnly, got %v", err)
+	}
+	if _, err := conn.IngestUpsert(ctx, "t2", rec, []string{"id"}); !errors.Is(err, couac.ErrReadOnly) {
+		t.Errorf("IngestUpsert: expected ErrReadOnly, got %v", err)
+	}
+	if err := conn.DiscardStagingTables(ctx, []couac.StagingTable{{Name: "tmergetmp", Destination: "t"}}); !errors.Is(err, couac.ErrReadOnly) {
+		t.Errorf("DiscardStagingTables: expected ErrReadOnly, got %v", err)
+	}
+	if err := r1.Compact(ctx); !errors.Is(err, couac.ErrReadOnly) {
+		t.Errorf("Compact: expected ErrReadOnly, got %v", err)
+	}
+	if err := conn.Set(ctx, "threads", "2"); !errors.Is(err, couac.ErrReadOnly) {
+		t.Errorf("Set(threads): expected ErrReadOnly, got %v", err)
+	}
+	if err := conn.Reset(ctx, "threads"); !errors.Is(err, couac.ErrReadOnly) {
+		t.Errorf("Reset(threads): expected ErrReadOnly, got %v", err)
+	}
+	if err := conn.Set(ctx, "explain_output", "all"); err != nil {
+		t.Errorf("Set(explain_output): %v", err)
+	}
+	if _, err := conn.Exec(ctx, "INSERT INTO t VALUES (3)"); !errors.Is(err, couac.ErrReadOnly) {
+		t.Errorf("INSERT: expected an error matching ErrReadOnly, got %v", err)
+	}
+
+	r1.Close()
+	r2.Close()
+	rw := newTestDB(t, couac.WithPath(path))
+	rw.Close()
+}
+
+func TestWithReadOnly_Invalid(t *testing.T) {
+	for name, opts := range map[string][]couac.Option{
+		"in-memory": {couac.WithReadOnly()},
+		"conflict": {
+			couac.WithPath(filepath.Join(t.TempDir(), "x.db")),
+			couac.WithReadOnly(),
+			couac.WithConfig(couac.Config{AccessMode: couac.AccessModeReadWrite}),
+		},
+	} {
+		opts = append(opts, couac.WithDriverName("duckdb"))
+		if _, err := couac.NewDuck(opts...); !errors.Is(err, couac.ErrInvalidConfig) {
+			t.Errorf("%s: expected ErrInvalidConfig, got %v", name, err)
+		}
+	}
+}
+
+func TestDB_Reopen(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "published.db")
+	writeTestDB(t, path, 3)
+
+	db := newTestDB(t, couac.WithPath(path), couac.WithReadOnly())
+	conn, err := db.Connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if n := tableCount(t, conn, "t"); n != 3 {
+		t.Fatalf("expected 3 rows, got %d", n)
+	}
+
+	// Publish a new version of the database over the path.
+	next := filepath.Join(dir, "next.db")
+	writeTestDB(t, next, 5)
+	if err := os.Rename(next, path); err != nil {
+		t.Fatal(err)
+	}
+	if n := tableCount(t, conn, "t"); n != 3 {
+		t.Errorf("expected the open file to keep 3 rows, got %d", n)
+	}
+	if err := db.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	if n := tableCount(t, conn, "t"); n != 5 {
+		t.Errorf("expected 5 rows after Reopen, got %d", n)
+	}
+	if db.ConnectionCount() != 1 {
+		t.Errorf("expected the connection to survive Reopen, got %d", db.ConnectionCount())
+	}
+}
+
+func TestDB_ReopenOpenResultsAndTx(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "published.db")
+	writeTestDB(t, path, 3)
+
+	db := newTestDB(t, couac.WithPath(path), couac.WithReadOnly())
+	conn, err := db.Connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ctx := context.Background()
+
+	res, err := conn.Query(ctx, "SELECT * FROM t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Reopen(); !errors.Is(err, couac.ErrResultsOpen) {
+		t.Errorf("expected ErrResultsOpen, got %v", err)
+	}
+	res.Close()
+
+	tx, err := conn.Begin(ctx, couac.TxOptions{ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec(ctx, "SELECT 1"); !errors.Is(err, couac.ErrTxDone) {
+		t.Errorf("expected ErrTxDone after Reopen, got %v", err)
+	}
+	if err := tx.Commit(ctx); !errors.Is(err, couac.ErrTxDone) {
+		t.Errorf("expected ErrTxDone from Commit after Reopen, got %v", err)
+	}
+	if _, err := conn.Begin(ctx, couac.TxOptions{}); err != nil {
+		t.Errorf("expected a new transaction after Reopen, got %v", err)
+	}
+}
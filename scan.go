@@ -0,0 +1,535 @@
+package couac
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"iter"
+	"math"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+)
+
+// QueryAs executes a query and scans every result row into a T.
+//
+// When T is a struct, result columns are mapped onto its fields by
+// name: a `couac:"col"` tag names the column explicitly, `couac:"-"`
+// skips the field, and untagged exported fields match the column name
+// case-insensitively. Fields of embedded structs are promoted. Columns
+// with no matching field are ignored.
+//
+// When T is not a struct (or is [time.Time], or implements
+// [sql.Scanner], e.g. [Decimal]), the result must have exactly one
+// column, which is scanned directly into T.
+//
+// Values are produced by the same conversion as the database/sql
+// bridge (see [DB.StdDB]) and then assigned to the field type:
+//   - integer and float columns convert to any Go numeric kind;
+//   - NULL sets pointers to nil and other fields to their zero value;
+//   - pointer fields are allocated as needed;
+//   - fields implementing [sql.Scanner] ([Decimal], [NullDecimal],
+//     [List], [Struct], [Map], [sql.NullString], ...) receive the value
+//     through Scan;
+//   - LIST columns fill Go slices, STRUCT columns fill Go structs (using
+//     the same tag rules), and MAP columns fill map[string]V, recursively.
+//
+// args are bound as with [Conn.QueryArgs].
+//
+// Example:
+//
+//	type User struct {
+//	    ID    int64          `couac:"id"`
+//	    Name  string         `couac:"name"`
+//	    Email *string        `couac:"email"`
+//	    Tags  []string       `couac:"tags"`
+//	    Score couac.Decimal  `couac:"score"`
+//	}
+//	users, err := couac.QueryAs[User](ctx, conn,
+//	    "SELECT * FROM users WHERE age > ?", 21)
+func QueryAs[T any](ctx context.Context, conn *Conn, query string, args ...any) ([]T, error) {
+	var out []T
+	for v, err := range QueryIter[T](ctx, conn, query, args...) {
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+// QueryIter executes a query and returns an iterator over its rows
+// scanned into T, using the same mapping rules as [QueryAs]. Rows are
+// decoded one record batch at a time, so large results are streamed
+// rather than materialized.
+//
+// Iteration stops after the first error, which is yielded with a zero
+// T. The underlying [QueryResult] is closed when iteration finishes or
+// the loop exits early.
+//
+// Example:
+//
+//	for u, err := range couac.QueryIter[User](ctx, conn, "SELECT * FROM users") {
+//	    if err != nil {
+//	        return err
+//	    }
+//	    process(u)
+//	}
+func QueryIter[T any](ctx context.Context, conn *Conn, query string, args ...any) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+		res, err := conn.QueryArgs(ctx, query, args...)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		defer res.Close()
+
+		plan, err := newScanPlan(reflect.TypeFor[T](), res.Schema())
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		for res.Reader.Next() {
+			rec := res.Reader.RecordBatch()
+			for row := 0; row < int(rec.NumRows()); row++ {
+				var v T
+				if err := plan.scanRow(reflect.ValueOf(&v).Elem(), rec, row); err != nil {
+					yield(zero, err)
+					return
+				}
+				if !yield(v, nil) {
+					return
+				}
+			}
+		}
+		if err := res.Reader.Err(); err != nil {
+			yield(zero, fmt.Errorf("couac: read results: %w", err))
+		}
+	}
+}
+
+// scanPlan maps result columns onto the fields of a destination type.
+type scanPlan struct {
+	typ reflect.Type
+	// single is true when the whole row (one column) is scanned into
+	// the destination rather than into struct fields.
+	single bool
+	cols   []scanColumn
+}
+
+// scanColumn binds a result column to a (possibly nested) struct field.
+type scanColumn struct {
+	col   int
+	name  string
+	field []int
+}
+
+// newScanPlan resolves the column → field mapping for typ against schema.
+func newScanPlan(typ reflect.Type, schema *arrow.Schema) (*scanPlan, error) {
+	plan := &scanPlan{typ: typ}
+	if !isScanStruct(typ) {
+		if schema.NumFields() != 1 {
+			return nil, fmt.Errorf("couac: cannot scan %d columns into %s; use a struct type", schema.NumFields(), typ)
+		}
+		plan.single = true
+		return plan, nil
+	}
+	fields := structInfoFor(typ).byName
+	for i, f := range schema.Fields() {
+		idx, ok := fields[strings.ToLower(f.Name)]
+		if !ok {
+			continue
+		}
+		plan.cols = append(plan.cols, scanColumn{col: i, name: f.Name, field: idx})
+	}
+	return plan, nil
+}
+
+// scanRow decodes row of rec into dst, which must be of the plan's type.
+func (p *scanPlan) scanRow(dst reflect.Value, rec arrow.RecordBatch, row int) error {
+	if p.single {
+		if err := assignColumn(dst, rec.Column(0), row); err != nil {
+			return fmt.Errorf("couac: scan column %q into %s: %w", rec.ColumnName(0), p.typ, err)
+		}
+		return nil
+	}
+	for _, c := range p.cols {
+		fv := fieldByIndexAlloc(dst, c.field)
+		if err := assignColumn(fv, rec.Column(c.col), row); err != nil {
+			return fmt.Errorf("couac: scan column %q into %s: %w", c.name, p.typ, err)
+		}
+	}
+	return nil
+}
+
+// assignColumn assigns the value of col at row to dst.
+func assignColumn(dst reflect.Value, col arrow.Array, row int) error {
+	if col.IsNull(row) {
+		return assignValue(dst, nil)
+	}
+	return assignValue(dst, arrowToDriverValue(col, row))
+}
+
+var (
+	scannerType = reflect.TypeFor[sql.Scanner]()
+	timeType    = reflect.TypeFor[time.Time]()
+	bytesType   = reflect.TypeFor[[]byte]()
+)
+
+// isScanStruct reports whether typ should be scanned field-by-field.
+func isScanStruct(typ reflect.Type) bool {
+	return typ.Kind() == reflect.Struct &&
+		typ != timeType &&
+		!reflect.PointerTo(typ).Implements(scannerType)
+}
+
+// structField describes a struct field bound to a column by the
+// `couac` tag rules.
+type structField struct {
+	// name is the column name: the tag name, or the Go field name.
+	name  string
+	index []int
+	typ   reflect.Type
+	// opts holds the tag options following the name (e.g. "scale=2").
+	opts string
+}
+
+// structInfo is the resolved column binding of a struct type.
+type structInfo struct {
+	// fields lists the bound fields in declaration order, with fields of
+	// embedded structs inlined at the embedding position.
+	fields []structField
+	// byName maps lower-cased column names to field index paths.
+	byName map[string][]int
+}
+
+// structInfoCache caches structInfoFor results per struct type.
+var structInfoCache sync.Map // map[reflect.Type]*structInfo
+
+// structInfoFor resolves which fields of typ bind to which column
+// names. Shallower fields shadow promoted ones, and at the same depth
+// tagged fields win over untagged.
+func structInfoFor(typ reflect.Type) *structInfo {
+	if cached, ok := structInfoCache.Load(typ); ok {
+		return cached.(*structInfo)
+	}
+	type candidate struct {
+		field  structField
+		tagged bool
+	}
+	found := make(map[string]candidate)
+	var walk func(t reflect.Type, prefix []int)
+	walk = func(t reflect.Type, prefix []int) {
+		var embedded []reflect.StructField
+		for i := range t.NumField() {
+			f := t.Field(i)
+			tag, hasTag := f.Tag.Lookup("couac")
+			name, opts, _ := strings.Cut(tag, ",")
+			if name == "-" {
+				continue
+			}
+			idx := append(append([]int(nil), prefix...), i)
+			if f.Anonymous && !hasTag {
+				ft := f.Type
+				if ft.Kind() == reflect.Pointer {
+					if !f.IsExported() {
+						// Cannot allocate an unexported embedded pointer.
+						continue
+					}
+					ft = ft.Elem()
+				}
+				if ft.Kind() == reflect.Struct {
+					f.Index = idx
+					embedded = append(embedded, f)
+					continue
+				}
+			}
+			if !f.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			key := strings.ToLower(name)
+			if prev, ok := found[key]; ok {
+				shallower := len(prev.field.index) < len(idx)
+				sameDepth := len(prev.field.index) == len(idx)
+				if shallower || (sameDepth && (prev.tagged || !hasTag)) {
+					continue
+				}
+			}
+			found[key] = candidate{
+				field:  structField{name: name, index: idx, typ: f.Type, opts: opts},
+				tagged: hasTag,
+			}
+		}
+		for _, f := range embedded {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			walk(ft, f.Index)
+		}
+	}
+	walk(typ, nil)
+
+	info := &structInfo{byName: make(map[string][]int, len(found))}
+	for k, c := range found {
+		info.byName[k] = c.field.index
+		info.fields = append(info.fields, c.field)
+	}
+	slices.SortFunc(info.fields, func(a, b structField) int {
+		return slices.Compare(a.index, b.index)
+	})
+	structInfoCache.Store(typ, info)
+	return info
+}
+
+// fieldByIndexAlloc is like [reflect.Value.FieldByIndex] but allocates
+// nil embedded struct pointers along the path.
+func fieldByIndexAlloc(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// assignValue stores src, a value produced by [arrowToDriverValue] or
+// [arrowToGoValue], into dst, converting it to dst's type.
+func assignValue(dst reflect.Value, src any) error {
+	if src == nil {
+		if dst.CanAddr() {
+			if s, ok := dst.Addr().Interface().(sql.Scanner); ok {
+				return s.Scan(nil)
+			}
+		}
+		dst.SetZero()
+		return nil
+	}
+
+	sv := reflect.ValueOf(src)
+	if sv.Type().AssignableTo(dst.Type()) {
+		dst.Set(sv)
+		return nil
+	}
+	if dst.CanAddr() {
+		if s, ok := dst.Addr().Interface().(sql.Scanner); ok {
+			return s.Scan(src)
+		}
+	}
+
+	// Unwrap the rich nested types into their plain Go representation.
+	switch v := src.(type) {
+	case List:
+		return assignValue(dst, v.Values)
+	case Struct:
+		return assignValue(dst, v.Fields)
+	case Map:
+		return assignValue(dst, v.Values)
+	}
+
+	switch dst.Kind() {
+	case reflect.Pointer:
+		elem := reflect.New(dst.Type().Elem())
+		if err := assignValue(elem.Elem(), src); err != nil {
+			return err
+		}
+		dst.Set(elem)
+		return nil
+
+	case reflect.Slice:
+		items, ok := src.([]any)
+		if !ok {
+			break
+		}
+		out := reflect.MakeSlice(dst.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := assignValue(out.Index(i), item); err != nil {
+				return fmt.Errorf("element %d: %w", i, err)
+			}
+		}
+		dst.Set(out)
+		return nil
+
+	case reflect.Array:
+		items, ok := src.([]any)
+		if !ok {
+			break
+		}
+		if len(items) != dst.Len() {
+			return fmt.Errorf("cannot assign %d elements to %s", len(items), dst.Type())
+		}
+		for i, item := range items {
+			if err := assignValue(dst.Index(i), item); err != nil {
+				return fmt.Errorf("element %d: %w", i, err)
+			}
+		}
+		return nil
+
+	case reflect.Map:
+		entries, ok := src.(map[string]any)
+		if !ok || dst.Type().Key().Kind() != reflect.String {
+			break
+		}
+		out := reflect.MakeMapWithSize(dst.Type(), len(entries))
+		for k, item := range entries {
+			ev := reflect.New(dst.Type().Elem()).Elem()
+			if err := assignValue(ev, item); err != nil {
+				return fmt.Errorf("key %q: %w", k, err)
+			}
+			out.SetMapIndex(reflect.ValueOf(k).Convert(dst.Type().Key()), ev)
+		}
+		dst.Set(out)
+		return nil
+
+	case reflect.Struct:
+		entries, ok := src.(map[string]any)
+		if !ok || !isScanStruct(dst.Type()) {
+			break
+		}
+		fields := structInfoFor(dst.Type()).byName
+		for k, item := range entries {
+			idx, ok := fields[strings.ToLower(k)]
+			if !ok {
+				continue
+			}
+			if err := assignValue(fieldByIndexAlloc(dst, idx), item); err != nil {
+				return fmt.Errorf("field %q: %w", k, err)
+			}
+		}
+		return nil
+
+	case reflect.Interface:
+		if sv.Type().Implements(dst.Type()) {
+			dst.Set(sv)
+			return nil
+		}
+	}
+
+	if isNumericKind(sv.Kind()) && isNumericKind(dst.Kind()) {
+		return convertNumeric(dst, sv)
+	}
+	if convertibleScalar(sv.Type(), dst.Type()) {
+		dst.Set(sv.Convert(dst.Type()))
+		return nil
+	}
+	return fmt.Errorf("cannot assign %T to %s", src, dst.Type())
+}
+
+// convertNumeric stores the number sv in the numeric dst. Like the
+// conversions of database/sql, it fails rather than wrap around when sv
+// is out of the range of dst, and rather than truncate when a float
+// with a fractional part is stored in an integer.
+func convertNumeric(dst, sv reflect.Value) error {
+	switch {
+	case dst.CanInt():
+		var n int64
+		switch {
+		case sv.CanInt():
+			n = sv.Int()
+		case sv.CanUint():
+			if sv.Uint() > math.MaxInt64 {
+				return numericRangeError(dst, sv)
+			}
+			n = int64(sv.Uint())
+		default:
+			f := sv.Float()
+			if f != math.Trunc(f) {
+				return fmt.Errorf("cannot assign %v to %s without losing its fractional part", sv, dst.Type())
+			}
+			if f < math.MinInt64 || f >= math.MaxInt64 {
+				return numericRangeError(dst, sv)
+			}
+			n = int64(f)
+		}
+		if dst.OverflowInt(n) {
+			return numericRangeError(dst, sv)
+		}
+		dst.SetInt(n)
+
+	case dst.CanUint():
+		var n uint64
+		switch {
+		case sv.CanInt():
+			if sv.Int() < 0 {
+				return numericRangeError(dst, sv)
+			}
+			n = uint64(sv.Int())
+		case sv.CanUint():
+			n = sv.Uint()
+		default:
+			f := sv.Float()
+			if f != math.Trunc(f) {
+				return fmt.Errorf("cannot assign %v to %s without losing its fractional part", sv, dst.Type())
+			}
+			if f < 0 || f >= math.MaxUint64 {
+				return numericRangeError(dst, sv)
+			}
+			n = uint64(f)
+		}
+		if dst.OverflowUint(n) {
+			return numericRangeError(dst, sv)
+		}
+		dst.SetUint(n)
+
+	default:
+		var f float64
+		switch {
+		case sv.CanInt():
+			f = float64(sv.Int())
+		case sv.CanUint():
+			f = float64(sv.Uint())
+		default:
+			f = sv.Float()
+		}
+		if dst.OverflowFloat(f) {
+			return numericRangeError(dst, sv)
+		}
+		dst.SetFloat(f)
+	}
+	return nil
+}
+
+func numericRangeError(dst, sv reflect.Value) error {
+	return fmt.Errorf("value %v out of range for %s", sv, dst.Type())
+}
+
+// convertibleScalar reports whether a value of type from may be
+// converted to type to without changing its meaning: string to
+// string-kinded types, and string ↔ []byte. Numbers are converted by
+// [convertNumeric].
+func convertibleScalar(from, to reflect.Type) bool {
+	switch {
+	case from.Kind() == reflect.String && to.Kind() == reflect.String:
+		return true
+	case from.Kind() == reflect.Bool && to.Kind() == reflect.Bool:
+		return true
+	case from.Kind() == reflect.String && to.Kind() == reflect.Slice && to.Elem().Kind() == reflect.Uint8:
+		return true
+	case from == bytesType && to.Kind() == reflect.String:
+		return true
+	}
+	return false
+}
+
+// isNumericKind reports whether k is an integer or floating-point kind.
+func isNumericKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,172 @@
+package couac_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/loicalleyne/couac"
+)
+
+type scanAddress struct {
+	City string `couac:"city"`
+	Zip  int    `couac:"zip"`
+}
+
+type scanAudit struct {
+	CreatedAt time.Time `couac:"created_at"`
+}
+
+type scanUser struct {
+	scanAudit
+	ID      int            `couac:"id"`
+	Name    string         // matched case-insensitively
+	Email   *string        `couac:"email"`
+	Score   couac.Decimal  `couac:"score"`
+	Tags    []string       `couac:"tags"`
+	Addr    scanAddress    `couac:"addr"`
+	Attrs   map[string]int `couac:"attrs"`
+	Ignored string         `couac:"-"`
+}
+
+func TestQueryAs_Struct(t *testing.T) {
+	_, conn := newTestConn(t)
+	ctx := context.Background()
+
+	_, err := conn.Exec(ctx, `CREATE TABLE scan_users (
+		id INTEGER, name VARCHAR, email VARCHAR, score DECIMAL(10,2),
+		tags VARCHAR[], addr STRUCT(city VARCHAR, zip INTEGER),
+		attrs MAP(VARCHAR, INTEGER), created_at TIMESTAMP, ignored VARCHAR)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = conn.Exec(ctx, `INSERT INTO scan_users VALUES
+		(1, 'alice', 'a@x.io', 12.34, ['x', 'y'], {'city': 'Paris', 'zip': 75001}, MAP {'k': 7}, TIMESTAMP '2024-01-02 03:04:05', 'nope'),
+		(2, 'bob', NULL, 0.5, [], {'city': 'Lyon', 'zip': 69001}, MAP {}, TIMESTAMP '2024-02-03 00:00:00', 'nope')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users, err := couac.QueryAs[scanUser](ctx, conn, "SELECT * FROM scan_users WHERE id >= ? ORDER BY id", 1)
+	if err != nil {
+		t.Fatalf("QueryAs: %v", err)
+	}
+	if len(users) != 2 {
+		t.Fatalf("expected 2 users, got %d", len(users))
+	}
+
+	a := users[0]
+	if a.ID != 1 || a.Name != "alice" {
+		t.Errorf("unexpected id/name: %d %q", a.ID, a.Name)
+	}
+	if a.Email == nil || *a.Email != "a@x.io" {
+		t.Errorf("unexpected email: %v", a.Email)
+	}
+	if a.Score.String() != "12.34" {
+		t.Errorf("expected score 12.34, got %s", a.Score)
+	}
+	if len(a.Tags) != 2 || a.Tags[0] != "x" || a.Tags[1] != "y" {
+		t.Errorf("unexpected tags: %v", a.Tags)
+	}
+	if a.Addr.City != "Paris" || a.Addr.Zip != 75001 {
+		t.Errorf("unexpected addr: %+v", a.Addr)
+	}
+	if a.Attrs["k"] != 7 {
+		t.Errorf("unexpected attrs: %v", a.Attrs)
+	}
+	if !a.CreatedAt.Equal(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Errorf("unexpected created_at: %v", a.CreatedAt)
+	}
+	if a.Ignored != "" {
+		t.Errorf("expected ignored field to stay empty, got %q", a.Ignored)
+	}
+
+	if users[1].Email != nil {
+		t.Errorf("expected nil email for NULL, got %q", *users[1].Email)
+	}
+	if len(users[1].Tags) != 0 {
+		t.Errorf("expected empty tags, got %v", users[1].Tags)
+	}
+}
+
+func TestQueryAs_SingleColumn(t *testing.T) {
+	_, conn := newTestConn(t)
+	ctx := context.Background()
+
+	ids, err := couac.QueryAs[int64](ctx, conn, "SELECT * FROM range(5)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 5 || ids[4] != 4 {
+		t.Errorf("unexpected ids: %v", ids)
+	}
+
+	_, err = couac.QueryAs[int64](ctx, conn, "SELECT 1, 2")
+	if err == nil {
+		t.Error("expected error scanning two columns into a scalar")
+	}
+}
+
+func TestQueryAs_TypeMismatch(t *testing.T) {
+	_, conn := newTestConn(t)
+
+	type bad struct {
+		N int `couac:"n"`
+	}
+	_, err := couac.QueryAs[bad](context.Background(), conn, "SELECT 'text' AS n")
+	if err == nil {
+		t.Fatal("expected error assigning VARCHAR to int")
+	}
+}
+
+func TestQueryAs_NumericRange(t *testing.T) {
+	_, conn := newTestConn(t)
+	ctx := context.Background()
+
+	if _, err := couac.QueryAs[int8](ctx, conn, "SELECT 300"); err == nil {
+		t.Error("expected error assigning 300 to int8")
+	}
+	if _, err := couac.QueryAs[uint32](ctx, conn, "SELECT -1"); err == nil {
+		t.Error("expected error assigning -1 to uint32")
+	}
+	if _, err := couac.QueryAs[int](ctx, conn, "SELECT 1.9::DOUBLE"); err == nil {
+		t.Error("expected error assigning 1.9 to int")
+	}
+	if _, err := couac.QueryAs[float32](ctx, conn, "SELECT 1e300::DOUBLE"); err == nil {
+		t.Error("expected error assigning 1e300 to float32")
+	}
+
+	type row struct {
+		Small int8    `couac:"small"`
+		Whole int     `couac:"whole"`
+		F     float32 `couac:"f"`
+	}
+	rows, err := couac.QueryAs[row](ctx, conn, "SELECT 127 AS small, 2.0::DOUBLE AS whole, 1.5::DOUBLE AS f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows[0] != (row{Small: 127, Whole: 2, F: 1.5}) {
+		t.Errorf("unexpected row %+v", rows[0])
+	}
+}
+
+func TestQueryIter_EarlyBreak(t *testing.T) {
+	_, conn := newTestConn(t)
+
+	type row struct {
+		I int64 `couac:"range"`
+	}
+	var got []int64
+	for r, err := range couac.QueryIter[row](context.Background(), conn, "SELECT * FROM range(100)") {
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, r.I)
+		if len(got) == 3 {
+			break
+		}
+	}
+	if len(got) != 3 || got[2] != 2 {
+		t.Errorf("unexpected rows: %v", got)
+	}
+}
@@ -0,0 +1,511 @@
+package couac
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/apache/arrow-go/v18/arrow/array"
+)
+
+// SettingScope is the scope a setting is changed in by [Conn.Set] and
+// [Conn.Reset].
+type SettingScope string
+
+const (
+	// ScopeGlobal changes the setting for every connection (SET GLOBAL).
+	ScopeGlobal SettingScope = "GLOBAL"
+	// ScopeSession changes the setting for the connection only (SET
+	// SESSION). DuckDB rejects it for options that can only be set
+	// globally, such as threads.
+	ScopeSession SettingScope = "SESSION"
+)
+
+// SetOption configures a [Conn.Set] or [Conn.Reset] call.
+type SetOption func(*setConfig)
+
+type setConfig struct {
+	scope SettingScope
+}
+
+// newSetConfig applies opts and checks the scope they set.
+func newSetConfig(opts []SetOption) (setConfig, error) {
+	var cfg setConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	switch cfg.scope {
+	case "", ScopeGlobal, ScopeSession:
+		return cfg, nil
+	default:
+		return cfg, fmt.Errorf("couac: unknown setting scope %q", string(cfg.scope))
+	}
+}
+
+// global reports whether s is set or reset globally: in the global
+// scope if one is given, otherwise if s is a global setting.
+func (c setConfig) global(s Setting) bool {
+	return c.scope == ScopeGlobal || c.scope == "" && s.Scope == "GLOBAL"
+}
+
+// prefix returns the scope keyword of a SET or RESET statement.
+func (c setConfig) prefix() string {
+	if c.scope == "" {
+		return ""
+	}
+	return string(c.scope) + " "
+}
+
+// WithScope sets or resets the setting in scope, [ScopeGlobal] or
+// [ScopeSession], rather than in the setting's own scope. Other scopes
+// are rejected.
+func WithScope(scope SettingScope) SetOption {
+	return func(cfg *setConfig) {
+		cfg.scope = scope
+	}
+}
+
+// UnknownSettingError is returned by [Conn.Set], [Conn.Setting], and
+// [Conn.Reset] for a key that is not a DuckDB setting. It matches
+// [ErrUnknownSetting] with errors.Is.
+type UnknownSettingError struct {
+	// Name is the key as given.
+	Name string
+	// Suggestions are the settings with the closest names, closest
+	// first.
+	Suggestions []string
+}
+
+// Error names the key and the settings it may have been meant as.
+func (e *UnknownSettingError) Error() string {
+	msg := fmt.Sprintf("couac: unknown setting %q", e.Name)
+	switch len(e.Suggestions) {
+	case 0:
+		return msg
+	case 1:
+		return fmt.Sprintf("%s; did you mean %q?", msg, e.Suggestions[0])
+	default:
+		quoted := make([]string, len(e.Suggestions))
+		for i, s := range e.Suggestions {
+			quoted[i] = strconv.Quote(s)
+		}
+		return fmt.Sprintf("%s; did you mean one of %s?", msg, strings.Join(quoted, ", "))
+	}
+}
+
+// Is reports whether target is [ErrUnknownSetting].
+func (e *UnknownSettingError) Is(target error) bool { return target == ErrUnknownSetting }
+
+// lookupSetting returns the name, input type, and scope of the setting
+// key or one of its aliases, or an UnknownSettingError. Settings that
+// are aliases of each other, such as memory_limit and max_memory, are
+// both listed; the one named key is preferred.
+func (q *Conn) lookupSetting(ctx context.Context, key string) (Setting, error) {
+	if err := q.ensureConnOpen(); err != nil {
+		return Setting{}, err
+	}
+	q.parent.rlock()
+	defer q.parent.mu.RUnlock()
+
+	name := quoteString(strings.ToLower(strings.TrimSpace(key)))
+	row, err := q.queryRowInternal(ctx, fmt.Sprintf(
+		"SELECT arg_max(name, lower(name) = %s), any_value(input_type), any_value(scope) FROM duckdb_settings() WHERE lower(name) = %s OR list_contains(list_transform(aliases, a -> lower(a)), %s)",
+		name, name, name))
+	if err != nil {
+		return Setting{}, err
+	}
+	if row[0] != nil {
+		return Setting{Name: *row[0], InputType: *row[1], Scope: *row[2]}, nil
+	}
+	row, err = q.queryRowInternal(ctx, "SELECT string_agg(name, ',') FROM duckdb_settings()")
+	if err != nil {
+		return Setting{}, err
+	}
+	var names []string
+	if row[0] != nil {
+		names = strings.Split(*row[0], ",")
+	}
+	return Setting{}, &UnknownSettingError{Name: key, Suggestions: closeMatches(key, names)}
+}
+
+// settingLiteral returns value as a SQL literal of the input type of s.
+func settingLiteral(s Setting, value string) (string, error) {
+	typ := strings.ToUpper(s.InputType)
+	v := strings.TrimSpace(value)
+	invalid := func() (string, error) {
+		return "", fmt.Errorf("couac: set %s: %q is not a valid %s", s.Name, value, typ)
+	}
+	switch typ {
+	case "BOOLEAN":
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return invalid()
+		}
+		return strconv.FormatBool(b), nil
+	case "TINYINT", "SMALLINT", "INTEGER", "BIGINT":
+		if _, err := strconv.ParseInt(v, 10, 64); err != nil {
+			return invalid()
+		}
+		return v, nil
+	case "UTINYINT", "USMALLINT", "UINTEGER", "UBIGINT":
+		if _, err := strconv.ParseUint(v, 10, 64); err != nil {
+			return invalid()
+		}
+		return v, nil
+	case "FLOAT", "DOUBLE":
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+			return invalid()
+		}
+		return strconv.FormatFloat(f, 'g', -1, 64), nil
+	}
+	if strings.HasSuffix(typ, "[]") {
+		if strings.HasPrefix(v, "[") && strings.HasSuffix(v, "]") {
+			// DuckDB casts the bracketed form, as returned by Setting.
+			return quoteString(v), nil
+		}
+		var sb strings.Builder
+		sb.WriteByte('[')
+		if v != "" {
+			for i, elem := range strings.Split(v, ",") {
+				if i > 0 {
+					sb.WriteString(", ")
+				}
+				sb.WriteString(quoteString(strings.TrimSpace(elem)))
+			}
+		}
+		sb.WriteByte(']')
+		return sb.String(), nil
+	}
+	return quoteString(value), nil
+}
+
+// closeMatches returns up to five of names that are within a small
+// edit distance of key, or contain it, closest first. Case is ignored.
+func closeMatches(key string, names []string) []string {
+	type match struct {
+		name string
+		dist int
+	}
+	key = strings.ToLower(key)
+	var matches []match
+	for _, name := range names {
+		lower := strings.ToLower(name)
+		d := levenshtein(key, lower)
+		if d <= max(2, len(key)/3) || len(key) >= 4 && strings.Contains(lower, key) {
+			matches = append(matches, match{name, d})
+		}
+	}
+	slices.SortFunc(matches, func(a, b match) int {
+		return cmp.Or(cmp.Compare(a.dist, b.dist), strings.Compare(a.name, b.name))
+	})
+	var out []string
+	for _, m := range matches[:min(5, len(matches))] {
+		out = append(out, m.name)
+	}
+	return out
+}
+
+// levenshtein returns the edit distance between a and b.
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// SettingsSnapshot holds the values of DuckDB settings by name, as
+// taken by [Conn.SnapshotSettings]. It can be marshaled, e.g. to JSON,
+// and restored later, or on another connection, with
+// [Conn.RestoreSettings].
+type SettingsSnapshot map[string]SettingSnapshot
+
+// SettingSnapshot is the value of a setting in a [SettingsSnapshot].
+type SettingSnapshot struct {
+	// Value is the value as DuckDB displays it, or nil if it is NULL.
+	Value *string `json:"value"`
+	// Input is the value the setting was given with [Conn.Set] or at
+	// open, when DuckDB displays it differently, e.g. "4GB" for a
+	// memory limit displayed as "3.7 GiB". It is restored instead of
+	// Value, which may be rounded.
+	Input *string `json:"input,omitempty"`
+	// Default is set if the setting had its default value. It is
+	// restored with [Conn.Reset].
+	Default bool `json:"default,omitempty"`
+}
+
+// SettingChange is a setting whose current value differs from the
+// value in a [SettingsSnapshot].
+type SettingChange struct {
+	Name string
+	// Old is the value in the snapshot, and New the current value, as
+	// DuckDB displays them; nil is NULL.
+	Old, New *string
+}
+
+// String describes the change, such as "threads: 4 -> 8".
+func (c SettingChange) String() string {
+	show := func(v *string) string {
+		if v == nil {
+			return "NULL"
+		}
+		return *v
+	}
+	return fmt.Sprintf("%s: %s -> %s", c.Name, show(c.Old), show(c.New))
+}
+
+// Diff returns the settings of s whose value in current, as returned by
+// [Conn.Settings], differs, sorted by name. Settings that are not in
+// both are ignored.
+func (s SettingsSnapshot) Diff(current []Setting) []SettingChange {
+	var changes []SettingChange
+	for _, c := range current {
+		snap, ok := s[c.Name]
+		if !ok {
+			continue
+		}
+		old := snap.Value
+		if cur := settingValue(c); (old == nil) != (cur == nil) || old != nil && *old != *cur {
+			changes = append(changes, SettingChange{Name: c.Name, Old: old, New: cur})
+		}
+	}
+	slices.SortFunc(changes, func(a, b SettingChange) int { return strings.Compare(a.Name, b.Name) })
+	return changes
+}
+
+// settingValue returns the value of s, or nil if it is NULL.
+func settingValue(s Setting) *string {
+	if s.Value == array.NullValueStr {
+		return nil
+	}
+	return &s.Value
+}
+
+// settingInput is a value given to [Conn.Set], and how DuckDB displays
+// it.
+type settingInput struct {
+	value, display string
+}
+
+// recordSetting remembers value, the value the setting s was just set
+// to, and how DuckDB displays it, so that snapshots can restore value
+// rather than a rounded display. Global settings are remembered by the
+// DB, others by q.
+func (q *Conn) recordSetting(ctx context.Context, s Setting, global bool, value string) error {
+	q.parent.rlock()
+	row, err := q.queryRowInternal(ctx, fmt.Sprintf("SELECT value FROM duckdb_settings() WHERE name = %s", quoteString(s.Name)))
+	q.parent.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	in := settingInput{value: value, display: array.NullValueStr}
+	if row[0] != nil {
+		in.display = *row[0]
+	}
+	if global {
+		q.parent.settingInputs.Store(s.Name, in)
+	} else {
+		q.settingInputs.Store(s.Name, in)
+	}
+	return nil
+}
+
+// openedSettings are the settings of a DB as opened, before any
+// change.
+type openedSettings struct {
+	// values are the displayed values by setting name; nil is NULL.
+	values map[string]*string
+	// inputs are the values given at open by setting name.
+	inputs map[string]string
+}
+
+// loadOpenedSettings reads the settings of q right after it is opened,
+// before any SET: the options given at open, and the defaults
+// otherwise. Caller must hold no lock on q.
+func (q *DB) loadOpenedSettings(ctx context.Context) (*openedSettings, error) {
+	cnxn, err := q.db.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer cnxn.Close()
+
+	// No other connection exists yet, so no lock is needed.
+	c := &Conn{parent: q, conn: cnxn}
+	row, err := c.queryRowInternal(ctx,
+		"SELECT json_group_array(json_object('name', name, 'value', value, 'aliases', aliases))::VARCHAR FROM duckdb_settings()")
+	if err != nil {
+		return nil, err
+	}
+	var settings []struct {
+		Name    string
+		Value   *string
+		Aliases []string
+	}
+	if row[0] != nil {
+		if err := json.Unmarshal([]byte(*row[0]), &settings); err != nil {
+			return nil, err
+		}
+	}
+
+	opened := &openedSettings{
+		values: make(map[string]*string, len(settings)),
+		inputs: make(map[string]string),
+	}
+	for _, s := range settings {
+		opened.values[s.Name] = s.Value
+		for _, name := range append([]string{s.Name}, s.Aliases...) {
+			if v, ok := q.dbOpts[strings.ToLower(name)]; ok {
+				opened.inputs[s.Name] = v
+			}
+		}
+	}
+	return opened, nil
+}
+
+// snapshotSetting returns the snapshot of the current setting s, with
+// the value it was last given through couac or at open, as long as
+// DuckDB still displays that value, and whether it has its default
+// value.
+func (q *Conn) snapshotSetting(s Setting, opened *openedSettings) SettingSnapshot {
+	snap := SettingSnapshot{Value: settingValue(s)}
+	if snap.Value == nil {
+		return snap
+	}
+	input := func(v string) {
+		if v != s.Value {
+			snap.Input = &v
+		}
+	}
+	for _, inputs := range []*sync.Map{&q.settingInputs, &q.parent.settingInputs} {
+		if v, ok := inputs.Load(s.Name); ok && v.(settingInput).display == s.Value {
+			input(v.(settingInput).value)
+			return snap
+		}
+	}
+	if v := opened.values[s.Name]; v != nil && *v == s.Value {
+		if in, ok := opened.inputs[s.Name]; ok {
+			input(in)
+		} else {
+			snap.Default = true
+		}
+	}
+	return snap
+}
+
+// SnapshotSettings returns the current values of the settings keys, or
+// of every setting if no key is given. Unknown keys return an
+// [UnknownSettingError].
+//
+// A setting keeps the value it was given with [Conn.Set] or at open,
+// e.g. "4GB", when DuckDB displays it differently, so that it is
+// restored exactly; settings that have their default value are
+// restored with [Conn.Reset]. Only the displayed value is known for
+// settings changed otherwise, e.g. with a SET statement run with
+// [Conn.Exec]; memory sizes among them are restored rounded to DuckDB's
+// display, such as "3.7 GiB".
+func (q *Conn) SnapshotSettings(ctx context.Context, keys ...string) (SettingsSnapshot, error) {
+	names := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		s, err := q.lookupSetting(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		names[s.Name] = true
+	}
+	settings, err := q.Settings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	snap := make(SettingsSnapshot)
+	for _, s := range settings {
+		if len(keys) == 0 || names[s.Name] {
+			snap[s.Name] = q.snapshotSetting(s, q.parent.opened)
+		}
+	}
+	return snap, nil
+}
+
+// RestoreSettings sets the settings of snap that have changed back to
+// their value in snap: their Input if known and their Value otherwise.
+// Settings that had their default value, or were NULL, are reset. It
+// attempts every setting and returns the errors of those it could not
+// restore.
+func (q *Conn) RestoreSettings(ctx context.Context, snap SettingsSnapshot) error {
+	current, err := q.Settings(ctx)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, c := range snap.Diff(current) {
+		switch old := snap[c.Name]; {
+		case old.Default || old.Value == nil:
+			err = q.Reset(ctx, c.Name)
+		case old.Input != nil:
+			err = q.Set(ctx, c.Name, *old.Input)
+		default:
+			err = q.Set(ctx, c.Name, *old.Value)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// WithSettings sets the settings in overrides, runs fn with q, and then
+// restores the settings it changed to their previous values, even when
+// fn fails or panics. The restore error, if any, is returned when fn
+// succeeds.
+//
+// Settings are changed in their own scope (see [Conn.Set]): GLOBAL
+// settings, such as threads, apply to every connection of the database
+// while fn runs. Settings that fn changes itself are not restored.
+//
+// Example:
+//
+//	err := conn.WithSettings(ctx, map[string]string{
+//	    "threads":                  "16",
+//	    "preserve_insertion_order": "false",
+//	}, func(conn *couac.Conn) error {
+//	    _, err := conn.Export(ctx, query, "out.parquet", couac.FormatParquet)
+//	    return err
+//	})
+func (q *Conn) WithSettings(ctx context.Context, overrides map[string]string, fn func(*Conn) error) (err error) {
+	keys := slices.Sorted(maps.Keys(overrides))
+	snap, err := q.SnapshotSettings(ctx, keys...)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if rerr := q.RestoreSettings(context.WithoutCancel(ctx), snap); rerr != nil && err == nil {
+			err = fmt.Errorf("couac: restore settings: %w", rerr)
+		}
+	}()
+	for _, key := range keys {
+		if err := q.Set(ctx, key, overrides[key]); err != nil {
+			return err
+		}
+	}
+	return fn(q)
+}
@@ -125,9 +125,31 @@ func (c *sqlConn) PrepareContext(_ context.Context, query string) (driver.Stmt,
 	}
 	if err := stmt.SetSqlQuery(query); err != nil {
 		stmt.Close()
-		return nil, fmt.Errorf("couac: sql set query: %w", err)
+		return nil, fmt.Errorf("couac: sql set query: %w", c.sqlError(err, query))
 	}
-	return &sqlStmt{stmt: stmt}, nil
+	return &sqlStmt{stmt: stmt, query: query, conn: c}, nil
+}
+
+// sqlError classifies an error returned while executing query.
+func (c *sqlConn) sqlError(err error, query string) error {
+	return classifyError(err, query, c.db.redactSQL)
+}
+
+// before runs the Before hooks of kind for a database/sql statement
+// and returns the context, statement, and arguments to run it with.
+func (c *sqlConn) before(ctx context.Context, kind hookKind, op, query string, args []driver.NamedValue) (context.Context, string, []driver.NamedValue, afterFunc, error) {
+	if !c.db.instrumented() {
+		return ctx, query, args, nil, nil
+	}
+	ctx, query, hargs, after, err := c.db.beforeStatement(ctx, kind, op, query, hookArgs(args))
+	if err != nil {
+		return ctx, query, nil, nil, err
+	}
+	if args, err = argsToNamedValues(hargs); err != nil {
+		after.run(-1, err)
+		return ctx, query, nil, nil, err
+	}
+	return ctx, query, args, after, nil
 }
 
 // Close implements [driver.Conn]. It closes the underlying ADBC connection.
@@ -137,51 +159,66 @@ func (c *sqlConn) Close() error {
 
 // ExecContext implements [driver.ExecerContext], allowing one-shot
 // parameterized statements without an explicit Prepare round-trip.
-func (c *sqlConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+func (c *sqlConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (_ driver.Result, err error) {
+	ctx, query, args, after, err := c.before(ctx, hookExec, "StdDB.Exec", query, args)
+	if err != nil {
+		return nil, err
+	}
+	n := int64(-1)
+	defer func() { after.run(n, err) }()
 	stmt, err := c.conn.NewStatement()
 	if err != nil {
 		return nil, fmt.Errorf("couac: sql exec: %w", err)
 	}
 	defer stmt.Close()
 	if err := stmt.SetSqlQuery(query); err != nil {
-		return nil, fmt.Errorf("couac: sql set query: %w", err)
+		return nil, fmt.Errorf("couac: sql set query: %w", c.sqlError(err, query))
 	}
 	if err := bindArgs(ctx, stmt, args); err != nil {
 		return nil, fmt.Errorf("couac: sql bind: %w", err)
 	}
-	n, err := stmt.ExecuteUpdate(ctx)
+	n, err = executeUpdate(ctx, stmt)
 	if err != nil {
-		return nil, fmt.Errorf("couac: sql exec: %w", err)
+		return nil, fmt.Errorf("couac: sql exec: %w", c.sqlError(err, query))
 	}
 	return &sqlResult{rowsAffected: n}, nil
 }
 
 // QueryContext implements [driver.QueryerContext], allowing one-shot
 // parameterized queries without an explicit Prepare round-trip.
-func (c *sqlConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+func (c *sqlConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (_ driver.Rows, err error) {
+	ctx, query, args, after, err := c.before(ctx, hookQuery, "StdDB.Query", query, args)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			after.run(-1, err)
+		}
+	}()
 	stmt, err := c.conn.NewStatement()
 	if err != nil {
 		return nil, fmt.Errorf("couac: sql query: %w", err)
 	}
 	if err := stmt.SetSqlQuery(query); err != nil {
 		stmt.Close()
-		return nil, fmt.Errorf("couac: sql set query: %w", err)
+		return nil, fmt.Errorf("couac: sql set query: %w", c.sqlError(err, query))
 	}
 	if err := bindArgs(ctx, stmt, args); err != nil {
 		stmt.Close()
 		return nil, fmt.Errorf("couac: sql bind: %w", err)
 	}
-	rr, _, err := stmt.ExecuteQuery(ctx)
+	rr, _, watch, err := executeQuery(ctx, stmt)
 	if err != nil {
 		stmt.Close()
-		return nil, fmt.Errorf("couac: sql query: %w", err)
+		return nil, fmt.Errorf("couac: sql query: %w", c.sqlError(err, query))
 	}
 	// stmt is intentionally NOT closed here — the Arrow RecordReader
 	// returned by ExecuteQuery holds a reference to the statement's
 	// result set. Closing stmt would invalidate the reader. The
 	// statement will be closed when sqlRows.Close() releases the reader
 	// (ADBC manages the lifecycle).
-	return &sqlRows{rr: rr, stmt: stmt}, nil
+	return newSQLRows(c.db, rr, stmt, watch, after), nil
 }
 
 // CheckNamedValue implements [driver.NamedValueChecker]. It allows
@@ -190,55 +227,7 @@ func (c *sqlConn) QueryContext(ctx context.Context, query string, args []driver.
 // database/sql rejecting them as unsupported types.
 // Nested types are JSON-serialized for parameter binding.
 func (c *sqlConn) CheckNamedValue(nv *driver.NamedValue) error {
-	switch v := nv.Value.(type) {
-	case Decimal:
-		return nil // accepted as-is; namedValuesToRecord handles it
-	case NullDecimal:
-		if !v.Valid {
-			nv.Value = nil
-		} else {
-			nv.Value = v.Decimal
-		}
-		return nil
-	case List:
-		s, _ := v.Value()
-		nv.Value = s
-		return nil
-	case NullList:
-		if !v.Valid {
-			nv.Value = nil
-		} else {
-			s, _ := v.List.Value()
-			nv.Value = s
-		}
-		return nil
-	case Struct:
-		s, _ := v.Value()
-		nv.Value = s
-		return nil
-	case NullStruct:
-		if !v.Valid {
-			nv.Value = nil
-		} else {
-			s, _ := v.Struct.Value()
-			nv.Value = s
-		}
-		return nil
-	case Map:
-		s, _ := v.Value()
-		nv.Value = s
-		return nil
-	case NullMap:
-		if !v.Valid {
-			nv.Value = nil
-		} else {
-			s, _ := v.Map.Value()
-			nv.Value = s
-		}
-		return nil
-	default:
-		return driver.ErrSkip // let database/sql apply default conversion
-	}
+	return checkNamedValue(nv)
 }
 
 // Begin implements [driver.Conn]. It delegates to [sqlConn.BeginTx] with a
@@ -259,7 +248,7 @@ func (c *sqlConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx
 	if opts.ReadOnly {
 		beginSQL = "BEGIN TRANSACTION READ ONLY"
 	}
-	if err := execOnTxConn(ctx, c.conn, beginSQL); err != nil {
+	if err := c.db.execOnTxConn(ctx, c.conn, beginSQL); err != nil {
 		return nil, fmt.Errorf("couac: sql begin: %w", err)
 	}
 	return &sqlTx{conn: c}, nil
@@ -272,19 +261,21 @@ type sqlTx struct {
 
 // Commit implements [driver.Tx]. It commits the current transaction.
 func (t *sqlTx) Commit() error {
-	return execOnTxConn(context.Background(), t.conn.conn, "COMMIT")
+	return t.conn.db.execOnTxConn(context.Background(), t.conn.conn, "COMMIT")
 }
 
 // Rollback implements [driver.Tx]. It rolls back the current transaction.
 func (t *sqlTx) Rollback() error {
-	return execOnTxConn(context.Background(), t.conn.conn, "ROLLBACK")
+	return t.conn.db.execOnTxConn(context.Background(), t.conn.conn, "ROLLBACK")
 }
 
 // sqlStmt implements [driver.Stmt], [driver.StmtExecContext], and
 // [driver.StmtQueryContext]. It wraps an ADBC statement and supports
 // parameterized execution via ? or $N placeholders.
 type sqlStmt struct {
-	stmt adbc.Statement
+	stmt  adbc.Statement
+	query string
+	conn  *sqlConn
 }
 
 // Close implements [driver.Stmt]. It closes the underlying ADBC statement.
@@ -307,17 +298,39 @@ func (s *sqlStmt) Exec(_ []driver.Value) (driver.Result, error) {
 // ExecContext implements [driver.StmtExecContext]. It binds the given
 // parameters (if any) and executes the statement, returning the number
 // of rows affected.
-func (s *sqlStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+func (s *sqlStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (_ driver.Result, err error) {
+	ctx, args, after, err := s.before(ctx, hookExec, "StdDB.Exec", args)
+	if err != nil {
+		return nil, err
+	}
+	n := int64(-1)
+	defer func() { after.run(n, err) }()
 	if err := bindArgs(ctx, s.stmt, args); err != nil {
 		return nil, fmt.Errorf("couac: sql bind: %w", err)
 	}
-	n, err := s.stmt.ExecuteUpdate(ctx)
+	n, err = executeUpdate(ctx, s.stmt)
 	if err != nil {
-		return nil, fmt.Errorf("couac: sql exec: %w", err)
+		return nil, fmt.Errorf("couac: sql exec: %w", s.conn.sqlError(err, s.query))
 	}
 	return &sqlResult{rowsAffected: n}, nil
 }
 
+// before runs the Before hooks of kind for an execution of the
+// statement, resetting its SQL if a hook rewrote it.
+func (s *sqlStmt) before(ctx context.Context, kind hookKind, op string, args []driver.NamedValue) (context.Context, []driver.NamedValue, afterFunc, error) {
+	ctx, query, args, after, err := s.conn.before(ctx, kind, op, s.query, args)
+	if err != nil || query == s.query {
+		return ctx, args, after, err
+	}
+	if err := s.stmt.SetSqlQuery(query); err != nil {
+		err = fmt.Errorf("couac: sql set query: %w", s.conn.sqlError(err, query))
+		after.run(-1, err)
+		return ctx, nil, nil, err
+	}
+	s.query = query
+	return ctx, args, after, nil
+}
+
 // Query implements [driver.Stmt]. It delegates to [sqlStmt.QueryContext]
 // with a background context and no parameters.
 func (s *sqlStmt) Query(_ []driver.Value) (driver.Rows, error) {
@@ -327,15 +340,24 @@ func (s *sqlStmt) Query(_ []driver.Value) (driver.Rows, error) {
 // QueryContext implements [driver.StmtQueryContext]. It binds the given
 // parameters (if any) and executes the query, returning a [driver.Rows]
 // that iterates over Arrow record batches.
-func (s *sqlStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+func (s *sqlStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (_ driver.Rows, err error) {
+	ctx, args, after, err := s.before(ctx, hookQuery, "StdDB.Query", args)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			after.run(-1, err)
+		}
+	}()
 	if err := bindArgs(ctx, s.stmt, args); err != nil {
 		return nil, fmt.Errorf("couac: sql bind: %w", err)
 	}
-	rr, _, err := s.stmt.ExecuteQuery(ctx)
+	rr, _, watch, err := executeQuery(ctx, s.stmt)
 	if err != nil {
-		return nil, fmt.Errorf("couac: sql query: %w", err)
+		return nil, fmt.Errorf("couac: sql query: %w", s.conn.sqlError(err, s.query))
 	}
-	return &sqlRows{rr: rr}, nil
+	return newSQLRows(s.conn.db, rr, nil, watch, after), nil
 }
 
 // sqlResult implements [driver.Result].
@@ -362,11 +384,21 @@ type sqlRows struct {
 	rr     array.RecordReader
 	rec    arrow.RecordBatch
 	stmt   adbc.Statement // non-nil when created by QueryerContext (owns the statement)
+	watch  *cancelWatch   // cancels the statement when the query's context is done
+	after  afterFunc      // runs the AfterQuery hooks on Close
+	db     *DB            // counts the rows as an open result until Close
+	rows   int64          // rows returned by Next
 	rowIdx int
 	cols   []string
 	closed bool
 }
 
+// newSQLRows returns the rows of a query executed on db.
+func newSQLRows(db *DB, rr array.RecordReader, stmt adbc.Statement, watch *cancelWatch, after afterFunc) *sqlRows {
+	db.openResults.Add(1)
+	return &sqlRows{rr: rr, stmt: stmt, watch: watch, after: after, db: db}
+}
+
 // Columns implements [driver.Rows]. It returns the column names from the
 // Arrow schema of the result set.
 func (r *sqlRows) Columns() []string {
@@ -389,7 +421,10 @@ func (r *sqlRows) Close() error {
 		return nil
 	}
 	r.closed = true
+	r.db.openResults.Add(-1)
+	r.after.run(r.rows, r.rr.Err())
 	r.rr.Release()
+	r.watch.stop()
 	if r.stmt != nil {
 		return r.stmt.Close()
 	}
@@ -411,6 +446,7 @@ func (r *sqlRows) Next(dest []driver.Value) error {
 				}
 			}
 			r.rowIdx++
+			r.rows++
 			return nil
 		}
 		if !r.rr.Next() {
@@ -140,3 +140,85 @@ func bindArgs(ctx context.Context, stmt adbcStatement, args []driver.NamedValue)
 type adbcStatement interface {
 	Bind(ctx context.Context, values arrow.RecordBatch) error
 }
+
+// checkNamedValue normalizes couac's rich parameter types into values
+// understood by [namedValuesToRecord]. [NullDecimal] and the nested Null*
+// wrappers become nil when invalid; [List], [Struct], and [Map] are
+// JSON-serialized. It returns [driver.ErrSkip] for all other types so
+// the caller can apply the default conversion.
+func checkNamedValue(nv *driver.NamedValue) error {
+	switch v := nv.Value.(type) {
+	case Decimal:
+		return nil // accepted as-is; namedValuesToRecord handles it
+	case NullDecimal:
+		if !v.Valid {
+			nv.Value = nil
+		} else {
+			nv.Value = v.Decimal
+		}
+		return nil
+	case List:
+		s, _ := v.Value()
+		nv.Value = s
+		return nil
+	case NullList:
+		if !v.Valid {
+			nv.Value = nil
+		} else {
+			s, _ := v.List.Value()
+			nv.Value = s
+		}
+		return nil
+	case Struct:
+		s, _ := v.Value()
+		nv.Value = s
+		return nil
+	case NullStruct:
+		if !v.Valid {
+			nv.Value = nil
+		} else {
+			s, _ := v.Struct.Value()
+			nv.Value = s
+		}
+		return nil
+	case Map:
+		s, _ := v.Value()
+		nv.Value = s
+		return nil
+	case NullMap:
+		if !v.Valid {
+			nv.Value = nil
+		} else {
+			s, _ := v.Map.Value()
+			nv.Value = s
+		}
+		return nil
+	default:
+		return driver.ErrSkip // let database/sql apply default conversion
+	}
+}
+
+// argsToNamedValues converts Go query arguments into ordinal
+// [driver.NamedValue]s for [namedValuesToRecord]. Rich couac types are
+// normalized with [checkNamedValue]; everything else goes through
+// [driver.DefaultParameterConverter], which widens sized integers and
+// float32 to int64/float64, dereferences pointers, and calls
+// [driver.Valuer] implementations, exactly as database/sql does.
+func argsToNamedValues(args []any) ([]driver.NamedValue, error) {
+	nvs := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		nv := driver.NamedValue{Ordinal: i + 1, Value: arg}
+		if err := checkNamedValue(&nv); err != nil {
+			if err != driver.ErrSkip {
+				return nil, err
+			}
+			v, err := driver.DefaultParameterConverter.ConvertValue(arg)
+			if err != nil {
+				return nil, fmt.Errorf("couac: convert parameter at ordinal %d: %w", nv.Ordinal, err)
+			}
+			nv.Value = v
+		}
+		nvs[i] = nv
+	}
+	return nvs, nil
+}
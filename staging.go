@@ -0,0 +1,173 @@
+package couac
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"sync"
+)
+
+// stagingPrefix starts the name of every staging table created by
+// couac. Staging tables are TEMPORARY, so they are private to their
+// connection and vanish with it.
+const stagingPrefix = "__couac_staging_"
+
+// legacyStagingSuffix ends the name of the regular "<table>mergetmp"
+// staging tables of earlier versions, which a crash could leave behind.
+const legacyStagingSuffix = "mergetmp"
+
+// newStagingTable returns a unique staging table name for destTable.
+func newStagingTable(destTable string) string {
+	return fmt.Sprintf("%s%s_%016x", stagingPrefix, destTable, rand.Uint64())
+}
+
+// tableLock is a per-destination lock, counted so that it is freed
+// once no ingest holds or waits for it.
+type tableLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// lockTable acquires the per-destination lock for a table and returns
+// the function that releases it. It serializes ingests that alter or
+// stage into the same table across connections of this DB. Caller must
+// already hold the parent's RWMutex read lock.
+func (q *Conn) lockTable(ctx context.Context, table string) (func(), error) {
+	key, err := q.tableLockKey(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+	return q.parent.lockTableKey(key), nil
+}
+
+// lockTableKey is [Conn.lockTable] for a key from [Conn.tableLockKey].
+func (q *DB) lockTableKey(key string) func() {
+	q.tableLocksMu.Lock()
+	l := q.tableLocks[key]
+	if l == nil {
+		if q.tableLocks == nil {
+			q.tableLocks = make(map[string]*tableLock)
+		}
+		l = &tableLock{}
+		q.tableLocks[key] = l
+	}
+	l.refs++
+	q.tableLocksMu.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		q.tableLocksMu.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(q.tableLocks, key)
+		}
+		q.tableLocksMu.Unlock()
+	}
+}
+
+// tableLockKey returns the key of the per-destination lock of a table.
+// An empty catalog or schema of the connection is resolved to the
+// current one, so that ingests naming the same table with or without
+// ConnectAs share a lock. Table names are case-insensitive in DuckDB,
+// and so are keys. Caller must already hold the parent's RWMutex read
+// lock.
+func (q *Conn) tableLockKey(ctx context.Context, table string) (string, error) {
+	catalog, dbSchema := q.catalog, q.dbSchema
+	if catalog == "" || dbSchema == "" {
+		row, err := q.queryRowInternal(ctx, "SELECT current_database(), current_schema()")
+		if err != nil {
+			return "", fmt.Errorf("couac: resolve table lock: %w", err)
+		}
+		if catalog == "" && row[0] != nil {
+			catalog = *row[0]
+		}
+		if dbSchema == "" && row[1] != nil {
+			dbSchema = *row[1]
+		}
+	}
+	return strings.ToLower(catalog + "." + dbSchema + "." + table), nil
+}
+
+// OrphanedStagingTables lists the staging tables that earlier versions
+// of couac left behind when an ingest was interrupted, e.g. by a crash,
+// across all attached databases: regular tables named
+// "<table>mergetmp" whose destination table exists. Current staging
+// tables are TEMPORARY and never outlive their connection, so they are
+// not reported.
+//
+// Orphaned tables are never merged automatically: inspect them and
+// either copy the rows you need into the destination or pass them to
+// [Conn.DiscardStagingTables].
+func (q *Conn) OrphanedStagingTables(ctx context.Context) ([]StagingTable, error) {
+	if err := q.ensureConnOpen(); err != nil {
+		return nil, err
+	}
+
+	type tableRow struct {
+		Catalog  string `couac:"database_name"`
+		DBSchema string `couac:"schema_name"`
+		Name     string `couac:"table_name"`
+	}
+	tables, err := QueryAs[tableRow](ctx, q,
+		"SELECT database_name, schema_name, table_name FROM duckdb_tables() WHERE NOT temporary AND NOT internal")
+	if err != nil {
+		return nil, fmt.Errorf("couac: list staging tables: %w", err)
+	}
+
+	exists := make(map[string]bool, len(tables))
+	for _, t := range tables {
+		exists[strings.ToLower(t.Catalog+"."+t.DBSchema+"."+t.Name)] = true
+	}
+
+	var orphans []StagingTable
+	for _, t := range tables {
+		dest, ok := strings.CutSuffix(t.Name, legacyStagingSuffix)
+		if ok && dest != "" && exists[strings.ToLower(t.Catalog+"."+t.DBSchema+"."+dest)] {
+			orphans = append(orphans, StagingTable{Catalog: t.Catalog, DBSchema: t.DBSchema, Name: t.Name, Destination: dest})
+		}
+	}
+	return orphans, nil
+}
+
+// DiscardStagingTables drops the given staging tables, typically the
+// result of [Conn.OrphanedStagingTables]. Tables that no longer exist
+// are ignored; the errors of tables that fail to drop are joined.
+//
+// Only staging tables are dropped: each name must be its Destination
+// followed by "mergetmp". If any name is not, no table is dropped.
+func (q *Conn) DiscardStagingTables(ctx context.Context, tables []StagingTable) error {
+	if err := q.ensureWritable(); err != nil {
+		return err
+	}
+	for _, t := range tables {
+		if !isStagingTable(t) {
+			return fmt.Errorf("couac: discard staging tables: %s is not a staging table", t.Name)
+		}
+	}
+
+	q.parent.rlock()
+	defer q.parent.mu.RUnlock()
+
+	var errs []error
+	for _, t := range tables {
+		var parts []string
+		for _, p := range []string{t.Catalog, t.DBSchema, t.Name} {
+			if p != "" {
+				parts = append(parts, quoteIdentifier(p))
+			}
+		}
+		name := strings.Join(parts, ".")
+		if _, err := q.execInternal(ctx, "DROP TABLE IF EXISTS "+name); err != nil {
+			errs = append(errs, fmt.Errorf("couac: drop staging table %s: %w", t.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// isStagingTable reports whether t is named like the staging table of
+// its destination.
+func isStagingTable(t StagingTable) bool {
+	return t.Destination != "" && t.Name == t.Destination+legacyStagingSuffix
+}
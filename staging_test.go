@@ -0,0 +1,220 @@
+package couac_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/loicalleyne/couac"
+)
+
+func TestIngestMerge_ConcurrentSameTable(t *testing.T) {
+	db, conn := newTestConn(t)
+	ctx := context.Background()
+
+	rec1 := makeTestRecord(t, 2)
+	defer rec1.Release()
+	rec2 := makeTestRecordExtended(t, 3)
+	defer rec2.Release()
+
+	const workers = 4
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for i := range workers {
+		c, err := db.Connect()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		rec := rec1
+		if i%2 == 1 {
+			rec = rec2
+		}
+		wg.Go(func() {
+			if _, err := c.IngestMerge(ctx, "concurrent_merge", rec); err != nil {
+				errs <- err
+			}
+		})
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("IngestMerge: %v", err)
+	}
+
+	res, err := conn.Query(ctx, "SELECT count(*) FROM concurrent_merge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Close()
+	if res.Reader.Next() {
+		if count := res.Reader.RecordBatch().Column(0).ValueStr(0); count != "10" {
+			t.Errorf("expected 10 rows, got %s", count)
+		}
+	}
+}
+
+func TestIngestUpsert_ConcurrentSameTable(t *testing.T) {
+	db, conn := newTestConn(t)
+	ctx := context.Background()
+
+	const workers = 4
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for i := range workers {
+		c, err := db.Connect()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		rec := upsertRecord(t, upsertRow{ID: int64(i), Name: "w"}, upsertRow{ID: 100, Name: "shared"})
+		defer rec.Release()
+		wg.Go(func() {
+			if _, err := c.IngestUpsert(ctx, "concurrent_upsert", rec, []string{"id"}); err != nil {
+				errs <- err
+			}
+		})
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("IngestUpsert: %v", err)
+	}
+
+	ids, err := couac.QueryAs[int64](ctx, conn, "SELECT id FROM concurrent_upsert ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != workers+1 {
+		t.Errorf("expected %d distinct keys, got %v", workers+1, ids)
+	}
+
+	// Staging tables are temporary, so only the upserting connection
+	// would see one left behind.
+	rec := upsertRecord(t, upsertRow{ID: 200, Name: "last"})
+	defer rec.Release()
+	if _, err := conn.IngestUpsert(ctx, "concurrent_upsert", rec, []string{"id"}); err != nil {
+		t.Fatal(err)
+	}
+	staged, err := couac.QueryAs[string](ctx, conn,
+		"SELECT table_name FROM duckdb_tables() WHERE starts_with(table_name, '__couac_staging_')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(staged) != 0 {
+		t.Errorf("expected no staging tables left, got %v", staged)
+	}
+}
+
+func TestIngestMerge_QualifiedAndDefaultShareLock(t *testing.T) {
+	db, conn := newTestConn(t)
+	ctx := context.Background()
+
+	rec1 := makeTestRecord(t, 2)
+	defer rec1.Release()
+	rec2 := makeTestRecordExtended(t, 3)
+	defer rec2.Release()
+
+	const workers = 4
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for i := range workers {
+		var c *couac.Conn
+		var err error
+		if i%2 == 0 {
+			c, err = db.Connect()
+		} else {
+			c, err = db.ConnectAs("memory", "main")
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		rec := rec1
+		if i >= workers/2 {
+			rec = rec2
+		}
+		wg.Go(func() {
+			if _, err := c.IngestMerge(ctx, "qualified_merge", rec); err != nil {
+				errs <- err
+			}
+		})
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("IngestMerge: %v", err)
+	}
+
+	n, err := couac.QueryAs[int64](ctx, conn, "SELECT count(*) FROM qualified_merge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n[0] != 10 {
+		t.Errorf("expected 10 rows, got %d", n[0])
+	}
+}
+
+func TestOrphanedStagingTables(t *testing.T) {
+	_, conn := newTestConn(t)
+	ctx := context.Background()
+
+	for _, q := range []string{
+		`CREATE TABLE events (id INTEGER)`,
+		`CREATE TABLE "__couac_staging_events_0123456789abcdef" (id INTEGER)`, // not an earlier version's
+		`CREATE TABLE eventsmergetmp (id INTEGER)`,
+		`CREATE TABLE unrelatedmergetmp (id INTEGER)`, // no "unrelated" table
+	} {
+		if _, err := conn.Exec(ctx, q); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	orphans, err := conn.OrphanedStagingTables(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orphans) != 1 || orphans[0].Name != "eventsmergetmp" || orphans[0].Destination != "events" {
+		t.Fatalf("expected eventsmergetmp, got %+v", orphans)
+	}
+
+	// Orphans are left alone by later ingests.
+	rec := makeTestRecord(t, 1)
+	defer rec.Release()
+	if _, err := conn.IngestMerge(ctx, "events", rec); err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := conn.OrphanedStagingTables(ctx); len(again) != 1 {
+		t.Errorf("expected orphans to survive IngestMerge, got %+v", again)
+	}
+
+	for _, bad := range []couac.StagingTable{
+		{Name: "events", Destination: "events"},
+		{Name: "unrelatedmergetmp"},
+		{Name: "__couac_staging_events_0123456789abcdef", Destination: "events"},
+	} {
+		if err := conn.DiscardStagingTables(ctx, append([]couac.StagingTable{bad}, orphans...)); err == nil {
+			t.Errorf("expected %s to be refused", bad.Name)
+		}
+	}
+	if again, _ := conn.OrphanedStagingTables(ctx); len(again) != 1 {
+		t.Errorf("expected a refused discard to drop nothing, got %+v", again)
+	}
+	if err := conn.DiscardStagingTables(ctx, orphans); err != nil {
+		t.Fatal(err)
+	}
+	orphans, err = conn.OrphanedStagingTables(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orphans) != 0 {
+		t.Errorf("expected no orphans after discard, got %+v", orphans)
+	}
+	tables, err := conn.ShowTables(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tables) != 3 {
+		t.Errorf("expected events, unrelatedmergetmp and the regular __couac_staging_ table to remain, got %v", tables)
+	}
+}
@@ -33,13 +33,21 @@ import (
 //
 // DuckDB's in-memory cache is preserved because at least one internal
 // connection remains open during the operation.
-func (q *DB) Compact(ctx context.Context) error {
+func (q *DB) Compact(ctx context.Context) (err error) {
 	if err := q.ensureOpen(); err != nil {
 		return err
 	}
+	if q.readOnly {
+		return ErrReadOnly
+	}
+	ctx, done, err := q.beforeMaintenance(ctx, "Compact")
+	if err != nil {
+		return err
+	}
+	defer func() { done(err) }()
 
 	// Acquire write lock — blocks all concurrent operations
-	q.mu.Lock()
+	q.lock()
 	defer q.mu.Unlock()
 
 	// Open a dedicated internal connection for maintenance
@@ -49,6 +57,13 @@ func (q *DB) Compact(ctx context.Context) error {
 	}
 	defer conn.Close()
 
+	// phase runs fn in a child span named after a step of Compact.
+	phase := func(name string, fn func() error) error {
+		_, end := q.startSpan(ctx, "couac.compact."+name)
+		err := fn()
+		end(err)
+		return err
+	}
 	execSQL := func(sql string) error {
 		stmt, err := conn.NewStatement()
 		if err != nil {
@@ -56,14 +71,14 @@ func (q *DB) Compact(ctx context.Context) error {
 		}
 		defer stmt.Close()
 		if err := stmt.SetSqlQuery(sql); err != nil {
-			return fmt.Errorf("couac: compact set query: %w", err)
+			return fmt.Errorf("couac: compact set query: %w", classifyError(err, sql, q.redactSQL))
 		}
 		_, err = stmt.ExecuteUpdate(ctx)
-		return err
+		return classifyError(err, sql, q.redactSQL)
 	}
 
 	// Step 1: Force checkpoint
-	if err := execSQL("FORCE CHECKPOINT"); err != nil {
+	if err := phase("checkpoint", func() error { return execSQL("FORCE CHECKPOINT") }); err != nil {
 		return fmt.Errorf("couac: compact checkpoint: %w", err)
 	}
 
@@ -78,22 +93,25 @@ func (q *DB) Compact(ctx context.Context) error {
 
 	quotedTmp := quoteString(tmpPath)
 
-	if err := execSQL(fmt.Sprintf("ATTACH %s AS _couac_compact", quotedTmp)); err != nil {
+	if err := phase("attach", func() error { return execSQL(fmt.Sprintf("ATTACH %s AS _couac_compact", quotedTmp)) }); err != nil {
 		return fmt.Errorf("couac: compact attach: %w", err)
 	}
 
 	// Step 3: Copy data to compacted file
-	copyErr := execSQL("COPY FROM DATABASE memory TO _couac_compact")
-	// Try to figure out the current database name for file-backed DBs
-	if copyErr != nil {
-		// For file-backed DBs the catalog name may differ; try generic approach
-		baseName := filepath.Base(q.path)
-		baseName = strings.TrimSuffix(baseName, filepath.Ext(baseName))
-		copyErr = execSQL(fmt.Sprintf("COPY FROM DATABASE %s TO _couac_compact", quoteIdentifier(baseName)))
-	}
+	copyErr := phase("copy", func() error {
+		err := execSQL("COPY FROM DATABASE memory TO _couac_compact")
+		// Try to figure out the current database name for file-backed DBs
+		if err != nil {
+			// For file-backed DBs the catalog name may differ; try generic approach
+			baseName := filepath.Base(q.path)
+			baseName = strings.TrimSuffix(baseName, filepath.Ext(baseName))
+			err = execSQL(fmt.Sprintf("COPY FROM DATABASE %s TO _couac_compact", quoteIdentifier(baseName)))
+		}
+		return err
+	})
 
 	// Always try to detach, even on copy error
-	detachErr := execSQL("DETACH _couac_compact")
+	detachErr := phase("detach", func() error { return execSQL("DETACH _couac_compact") })
 
 	if copyErr != nil {
 		return fmt.Errorf("couac: compact copy: %w", copyErr)
@@ -103,12 +121,12 @@ func (q *DB) Compact(ctx context.Context) error {
 	}
 
 	// Step 4: Replace original with compacted copy
-	if err := replaceFile(tmpPath, q.path); err != nil {
+	if err := phase("replace", func() error { return replaceFile(tmpPath, q.path) }); err != nil {
 		return fmt.Errorf("couac: compact replace: %w", err)
 	}
 
 	// Step 5: Final checkpoint to sync
-	if err := execSQL("FORCE CHECKPOINT"); err != nil {
+	if err := phase("final_checkpoint", func() error { return execSQL("FORCE CHECKPOINT") }); err != nil {
 		// Non-fatal: the compaction succeeded, just the final sync failed
 		return fmt.Errorf("couac: compact final checkpoint: %w", err)
 	}
@@ -122,11 +140,19 @@ func (q *DB) Compact(ctx context.Context) error {
 //
 // Checkpoint acquires a read lock, allowing it to run concurrently
 // with queries but not with maintenance operations.
-func (q *DB) Checkpoint(ctx context.Context) error {
+func (q *DB) Checkpoint(ctx context.Context) (err error) {
 	if err := q.ensureOpen(); err != nil {
 		return err
 	}
-	q.mu.RLock()
+	if q.readOnly {
+		return ErrReadOnly
+	}
+	ctx, done, err := q.beforeMaintenance(ctx, "Checkpoint")
+	if err != nil {
+		return err
+	}
+	defer func() { done(err) }()
+	q.rlock()
 	defer q.mu.RUnlock()
 
 	conn, err := q.db.Open(ctx)
@@ -135,7 +161,7 @@ func (q *DB) Checkpoint(ctx context.Context) error {
 	}
 	defer conn.Close()
 
-	return execOnConn(ctx, conn, "CHECKPOINT")
+	return q.execOnConn(ctx, conn, "CHECKPOINT")
 }
 
 // ForceCheckpoint synchronizes the WAL to the database file, waiting
@@ -144,11 +170,19 @@ func (q *DB) Checkpoint(ctx context.Context) error {
 // ForceCheckpoint acquires the write lock, blocking all concurrent
 // operations until the checkpoint completes. Open connections remain
 // valid afterward.
-func (q *DB) ForceCheckpoint(ctx context.Context) error {
+func (q *DB) ForceCheckpoint(ctx context.Context) (err error) {
 	if err := q.ensureOpen(); err != nil {
 		return err
 	}
-	q.mu.Lock()
+	if q.readOnly {
+		return ErrReadOnly
+	}
+	ctx, done, err := q.beforeMaintenance(ctx, "ForceCheckpoint")
+	if err != nil {
+		return err
+	}
+	defer func() { done(err) }()
+	q.lock()
 	defer q.mu.Unlock()
 
 	conn, err := q.db.Open(ctx)
@@ -157,7 +191,7 @@ func (q *DB) ForceCheckpoint(ctx context.Context) error {
 	}
 	defer conn.Close()
 
-	return execOnConn(ctx, conn, "FORCE CHECKPOINT")
+	return q.execOnConn(ctx, conn, "FORCE CHECKPOINT")
 }
 
 // Attach attaches an additional database file to the current DuckDB
@@ -369,18 +403,19 @@ func SecretsDir() string {
 	return filepath.Join(home, ".duckdb", "stored_secrets")
 }
 
-// execOnConn executes a single SQL statement on a raw ADBC connection.
-func execOnConn(ctx context.Context, conn interface{ NewStatement() (adbc.Statement, error) }, sql string) error {
+// execOnConn executes a single SQL statement on a raw ADBC connection
+// of q, classifying errors like statements on its connections.
+func (q *DB) execOnConn(ctx context.Context, conn interface{ NewStatement() (adbc.Statement, error) }, sql string) error {
 	stmt, err := conn.NewStatement()
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 	if err := stmt.SetSqlQuery(sql); err != nil {
-		return err
+		return classifyError(err, sql, q.redactSQL)
 	}
 	_, err = stmt.ExecuteUpdate(ctx)
-	return err
+	return classifyError(err, sql, q.redactSQL)
 }
 
 // replaceFile atomically replaces dst with src. On Windows, os.Rename
@@ -0,0 +1,130 @@
+package couac
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation scope of the spans couac emits.
+const tracerName = "github.com/loicalleyne/couac"
+
+// WithTracerProvider emits OpenTelemetry spans from tp for the calls
+// that run hooks (see [Hook]): Exec and Query calls, including the
+// time spent reading a [QueryResult], every Ingest call, database/sql
+// operations through [DB.StdDB], and maintenance. IngestMerge schema
+// changes and the phases of [DB.Compact] get child spans.
+//
+// Spans follow the OpenTelemetry database conventions, with db.system
+// set to "duckdb". The text of statements is only recorded with
+// [WithTraceStatements].
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(cfg config) {
+		cfg.tracer = tp.Tracer(tracerName)
+	}
+}
+
+// WithTraceStatements records the SQL text of statements as the
+// db.query.text attribute of spans. With [WithRedactedSQL], literals
+// are replaced with ? first.
+func WithTraceStatements() Option {
+	return func(cfg config) {
+		cfg.traceStatements = true
+	}
+}
+
+// instrumented reports whether calls must build a [HookEvent], for
+// hooks, tracing, or metrics.
+func (q *DB) instrumented() bool {
+	return len(q.hooks) > 0 || q.tracer != nil || q.metrics != nil
+}
+
+// startOpSpan starts the span of the call described by ev, or returns
+// a nil span without a tracer.
+func (q *DB) startOpSpan(ctx context.Context, ev *HookEvent) (context.Context, trace.Span) {
+	if q.tracer == nil {
+		return ctx, nil
+	}
+	attrs := []attribute.KeyValue{
+		attribute.String("db.system", "duckdb"),
+		attribute.String("couac.operation", ev.Op),
+	}
+	if q.path != "" {
+		attrs = append(attrs, attribute.String("db.namespace", q.path))
+	}
+	if ev.Table != "" {
+		attrs = append(attrs, attribute.String("db.collection.name", ev.Table))
+	}
+	if ev.Path != "" {
+		attrs = append(attrs, attribute.String("couac.ingest.path", ev.Path))
+	}
+	if ev.Table != "" && ev.Rows >= 0 {
+		attrs = append(attrs, attribute.Int64("couac.ingest.rows", ev.Rows))
+	}
+	if ev.Bytes > 0 {
+		attrs = append(attrs, attribute.Int64("couac.ingest.bytes", ev.Bytes))
+	}
+	return q.tracer.Start(ctx, "couac."+ev.Op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithTimestamp(ev.Start),
+		trace.WithAttributes(attrs...))
+}
+
+// endOpSpan completes span with the outcome recorded in ev.
+func (q *DB) endOpSpan(span trace.Span, ev *HookEvent) {
+	if span == nil {
+		return
+	}
+	if ev.SQL != "" {
+		if op, _, _ := strings.Cut(strings.TrimSpace(ev.SQL), " "); op != "" {
+			span.SetAttributes(attribute.String("db.operation.name", strings.ToUpper(op)))
+		}
+		if q.traceStatements {
+			text := ev.SQL
+			if q.redactSQL {
+				text = redactSQL(text)
+			}
+			span.SetAttributes(attribute.String("db.query.text", text))
+		}
+	}
+	if ev.Rows >= 0 {
+		span.SetAttributes(attribute.Int64("db.response.returned_rows", ev.Rows))
+	}
+	q.endSpan(span, ev.Err)
+}
+
+// startSpan starts a child span for a step of a larger operation, such
+// as a phase of [DB.Compact]. The returned function ends it with the
+// step's error; both are no-ops without a tracer.
+func (q *DB) startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, func(error)) {
+	if q.tracer == nil {
+		return ctx, func(error) {}
+	}
+	attrs = append(attrs, attribute.String("db.system", "duckdb"))
+	ctx, span := q.tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+	return ctx, func(err error) { q.endSpan(span, err) }
+}
+
+// endSpan records err, if any, on span and ends it. Unless statement
+// text is traced without redaction, only the first line of the error is
+// kept, since DuckDB appends an excerpt of the offending statement.
+func (q *DB) endSpan(span trace.Span, err error) {
+	if err != nil {
+		msg, _, cut := strings.Cut(err.Error(), "\n")
+		if cut && (!q.traceStatements || q.redactSQL) {
+			span.RecordError(errors.New(msg))
+		} else {
+			span.RecordError(err)
+		}
+		span.SetStatus(codes.Error, msg)
+		var e *Error
+		if errors.As(err, &e) && e.Type != "" {
+			span.SetAttributes(attribute.String("error.type", e.Type))
+		}
+	}
+	span.End()
+}
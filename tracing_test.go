@@ -0,0 +1,214 @@
+package couac_test
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/loicalleyne/couac"
+)
+
+// newTracedDB opens a database whose spans are kept by the returned
+// recorder.
+func newTracedDB(t *testing.T, opts ...couac.Option) (*couac.DB, *tracetest.SpanRecorder) {
+	t.Helper()
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	t.Cleanup(func() { tp.Shutdown(context.Background()) })
+	return newTestDB(t, append([]couac.Option{couac.WithTracerProvider(tp)}, opts...)...), sr
+}
+
+// spanAttrs returns the attributes of span as a map.
+func spanAttrs(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+// spanNames returns the names of the ended spans of sr.
+func spanNames(sr *tracetest.SpanRecorder) []string {
+	var names []string
+	for _, s := range sr.Ended() {
+		names = append(names, s.Name())
+	}
+	return names
+}
+
+func TestTracing_ExecAndQuery(t *testing.T) {
+	db, sr := newTracedDB(t)
+	conn, err := db.Connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ctx := context.Background()
+
+	if _, err := conn.Exec(ctx, "CREATE TABLE t AS SELECT * FROM range(5)"); err != nil {
+		t.Fatal(err)
+	}
+	res, err := conn.Query(ctx, "SELECT * FROM t WHERE range > 'x'")
+	if err == nil {
+		res.Close()
+		t.Fatal("expected a conversion error")
+	}
+	res, err = conn.Query(ctx, "SELECT * FROM t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(sr.Ended()); n != 2 {
+		t.Fatalf("expected the query span to stay open until Close, got %d ended spans", n)
+	}
+	for res.Reader.Next() {
+	}
+	res.Close()
+
+	spans := sr.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("expected 3 spans, got %v", spanNames(sr))
+	}
+	exec := spanAttrs(spans[0])
+	if spans[0].Name() != "couac.Exec" || exec["db.system"].AsString() != "duckdb" || exec["db.operation.name"].AsString() != "CREATE" {
+		t.Errorf("unexpected Exec span %s %v", spans[0].Name(), exec)
+	}
+	if _, ok := exec["db.query.text"]; ok {
+		t.Error("expected statement text to be omitted by default")
+	}
+	if spans[1].Status().Code != codes.Error || len(spans[1].Events()) == 0 {
+		t.Errorf("expected failed query span to record the error, got %+v", spans[1].Status())
+	}
+	if rows := spanAttrs(spans[2])["db.response.returned_rows"].AsInt64(); rows != 5 {
+		t.Errorf("expected 5 returned rows, got %d", rows)
+	}
+}
+
+func TestTracing_Statements(t *testing.T) {
+	db, sr := newTracedDB(t, couac.WithTraceStatements(), couac.WithRedactedSQL())
+	conn, err := db.Connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Exec(context.Background(), "SELECT 'secret', 42"); err != nil {
+		t.Fatal(err)
+	}
+	if got := spanAttrs(sr.Ended()[0])["db.query.text"].AsString(); got != "SELECT ?, ?" {
+		t.Errorf("expected redacted statement text, got %q", got)
+	}
+
+	if _, err := conn.Exec(context.Background(), "SELECT 'secret' + bogus"); err == nil {
+		t.Fatal("expected error")
+	}
+	for _, ev := range sr.Ended()[1].Events() {
+		for _, kv := range ev.Attributes {
+			if strings.Contains(kv.Value.Emit(), "secret") {
+				t.Errorf("expected redacted error event, got %s = %q", kv.Key, kv.Value.Emit())
+			}
+		}
+	}
+}
+
+func TestTracing_IngestMerge(t *testing.T) {
+	db, sr := newTracedDB(t)
+	conn, err := db.Connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ctx := context.Background()
+
+	rec := makeTestRecord(t, 3)
+	defer rec.Release()
+	if _, err := conn.Ingest(ctx, "m", rec); err != nil {
+		t.Fatal(err)
+	}
+	ext := makeTestRecordExtended(t, 2)
+	defer ext.Release()
+	if _, err := conn.IngestMerge(ctx, "m", ext); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"couac.Ingest", "couac.merge.plan", "couac.merge.evolve", "couac.merge.append", "couac.IngestMerge"}
+	names := spanNames(sr)
+	if len(names) != len(want) {
+		t.Fatalf("spans = %v, want %v", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("spans = %v, want %v", names, want)
+		}
+	}
+	spans := sr.Ended()
+	ingest := spanAttrs(spans[0])
+	if ingest["db.collection.name"].AsString() != "m" || ingest["couac.ingest.rows"].AsInt64() != 3 || ingest["couac.ingest.bytes"].AsInt64() <= 0 {
+		t.Errorf("unexpected Ingest span attributes %v", ingest)
+	}
+	merge := spans[4].SpanContext().SpanID()
+	for _, s := range spans[1:4] {
+		if s.Parent().SpanID() != merge {
+			t.Errorf("expected %s to be a child of the IngestMerge span", s.Name())
+		}
+	}
+	if added := spanAttrs(spans[2])["couac.merge.added"].AsInt64(); added != 1 {
+		t.Errorf("expected 1 added column, got %d", added)
+	}
+}
+
+func TestTracing_Compact(t *testing.T) {
+	db, sr := newTracedDB(t, couac.WithPath(filepath.Join(t.TempDir(), "traced.db")))
+	conn, err := db.Connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ctx := context.Background()
+
+	if _, err := conn.Exec(ctx, "CREATE TABLE t AS SELECT * FROM range(100)"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Compact(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]bool{
+		"couac.compact.checkpoint": true, "couac.compact.attach": true, "couac.compact.copy": true,
+		"couac.compact.detach": true, "couac.compact.replace": true, "couac.compact.final_checkpoint": true,
+	}
+	spans := sr.Ended()
+	root := spans[len(spans)-1]
+	if root.Name() != "couac.Compact" {
+		t.Fatalf("expected the Compact span to end last, got %v", spanNames(sr))
+	}
+	for _, s := range spans[1 : len(spans)-1] {
+		if !want[s.Name()] || s.Parent().SpanID() != root.SpanContext().SpanID() {
+			t.Errorf("unexpected span %s", s.Name())
+		}
+		delete(want, s.Name())
+	}
+	if len(want) > 0 {
+		t.Errorf("missing Compact phases %v", want)
+	}
+}
+
+func TestTracing_StdDB(t *testing.T) {
+	db, sr := newTracedDB(t)
+	sqlDB := db.StdDB()
+	defer sqlDB.Close()
+
+	var n int
+	if err := sqlDB.QueryRowContext(context.Background(), "SELECT 42").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	spans := sr.Ended()
+	if len(spans) != 1 || spans[0].Name() != "couac.StdDB.Query" {
+		t.Fatalf("unexpected spans %v", spanNames(sr))
+	}
+}
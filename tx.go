@@ -0,0 +1,461 @@
+package couac
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+)
+
+// Default backoff between transaction attempts: exponential from
+// defaultTxBackoffBase, capped at defaultTxBackoffMax, with jitter.
+const (
+	defaultTxBackoffBase = 10 * time.Millisecond
+	defaultTxBackoffMax  = time.Second
+)
+
+// WithTransactionOpts is like [DB.WithTransaction] but takes options.
+// When fn or the commit fails with an error that opts.RetryOn accepts
+// (by default one matching [ErrTransactionConflict]), the transaction is
+// rolled back and fn runs again in a new transaction on a fresh
+// connection, up to opts.MaxRetries more times, waiting opts.Backoff in
+// between. fn can read the attempt number with [Conn.Attempt]; it must
+// be safe to run more than once.
+//
+// Waiting for a retry stops when ctx is done. A panic in fn rolls back
+// and re-panics without retrying. Retries are counted in [DB.TxStats].
+//
+// Example:
+//
+//	err := db.WithTransactionOpts(ctx, couac.TxOptions{MaxRetries: 5}, func(tx *couac.Conn) error {
+//	    _, err := tx.Exec(ctx, "UPDATE totals SET n = n + 1 WHERE day = current_date")
+//	    return err
+//	})
+func (q *DB) WithTransactionOpts(ctx context.Context, opts TxOptions, fn func(*Conn) error) error {
+	retryOn := opts.RetryOn
+	if retryOn == nil {
+		retryOn = func(err error) bool { return errors.Is(err, ErrTransactionConflict) }
+	}
+	backoff := opts.Backoff
+	if backoff == nil {
+		backoff = defaultTxBackoff
+	}
+
+	q.txStats.transactions.Add(1)
+	for attempt := 1; ; attempt++ {
+		err := q.runTransaction(ctx, opts.ReadOnly, attempt, fn)
+		if err == nil {
+			q.txStats.commits.Add(1)
+			return nil
+		}
+		if errors.Is(err, ErrTransactionConflict) {
+			q.txStats.conflicts.Add(1)
+		}
+		if !retryOn(err) {
+			return err
+		}
+		if attempt > opts.MaxRetries {
+			if opts.MaxRetries > 0 {
+				q.txStats.exhausted.Add(1)
+				return fmt.Errorf("couac: transaction failed after %d attempts: %w", attempt, err)
+			}
+			return err
+		}
+
+		t := time.NewTimer(backoff(attempt))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return fmt.Errorf("couac: transaction retry: %w", errors.Join(ctx.Err(), err))
+		case <-t.C:
+		}
+		q.txStats.retries.Add(1)
+	}
+}
+
+// runTransaction runs one attempt of fn in a transaction on a dedicated
+// connection and commits it, or rolls it back if fn or the commit fails
+// or fn panics. Rollbacks are counted in q.txStats once BEGIN has
+// succeeded.
+func (q *DB) runTransaction(ctx context.Context, readOnly bool, attempt int, fn func(*Conn) error) (retErr error) {
+	if err := q.ensureOpen(); err != nil {
+		return err
+	}
+
+	// Open a dedicated connection for the transaction
+	conn, err := q.db.Open(ctx)
+	if err != nil {
+		return fmt.Errorf("couac: open transaction connection: %w", err)
+	}
+
+	txConn := &Conn{
+		parent:  q,
+		conn:    conn,
+		inTx:    true,
+		attempt: attempt,
+	}
+	began := false
+	defer func() {
+		// Don't track this connection in ducklings - it's ephemeral
+		if r := recover(); r != nil {
+			q.rollbackConn(ctx, conn)
+			if began {
+				q.txStats.rollbacks.Add(1)
+			}
+			txConn.closed.Store(true)
+			conn.Close()
+			panic(r) // re-panic after rollback
+		}
+		txConn.closed.Store(true)
+		conn.Close()
+	}()
+
+	begin := "BEGIN TRANSACTION"
+	if readOnly {
+		begin = "BEGIN TRANSACTION READ ONLY"
+	}
+	if err := q.execOnTxConn(ctx, conn, begin); err != nil {
+		return fmt.Errorf("couac: begin transaction: %w", err)
+	}
+	began = true
+
+	retErr = fn(txConn)
+
+	if retErr != nil {
+		q.rollbackConn(ctx, conn)
+		q.txStats.rollbacks.Add(1)
+		return retErr
+	}
+
+	if err := q.execOnTxConn(ctx, conn, "COMMIT"); err != nil {
+		q.rollbackConn(ctx, conn)
+		q.txStats.rollbacks.Add(1)
+		return fmt.Errorf("couac: commit: %w", err)
+	}
+	return nil
+}
+
+// defaultTxBackoff waits exponentially longer after each failed attempt,
+// with "equal jitter": a random duration between half and all of the
+// exponential delay.
+func defaultTxBackoff(attempt int) time.Duration {
+	d := defaultTxBackoffMax
+	if attempt < 8 {
+		d = min(defaultTxBackoffBase<<(attempt-1), defaultTxBackoffMax)
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// Attempt returns the attempt number, starting at 1, of the transaction
+// run by [DB.WithTransactionOpts] or [DB.WithTransaction] that this
+// connection belongs to, or 0 for other connections.
+func (q *Conn) Attempt() int { return q.attempt }
+
+// TxStats returns counters of the transactions run by
+// [DB.WithTransaction] and [DB.WithTransactionOpts].
+func (q *DB) TxStats() TxStats {
+	return TxStats{
+		Transactions: q.txStats.transactions.Load(),
+		Commits:      q.txStats.commits.Load(),
+		Rollbacks:    q.txStats.rollbacks.Load(),
+		Conflicts:    q.txStats.conflicts.Load(),
+		Retries:      q.txStats.retries.Load(),
+		Exhausted:    q.txStats.exhausted.Load(),
+	}
+}
+
+// Begin starts a transaction on the connection and returns a handle to
+// it. Statements run through the [Tx], or directly on q while the
+// transaction is active, are part of the transaction until [Tx.Commit]
+// or [Tx.Rollback]; methods such as [Conn.ExecBatch] and
+// [Conn.IngestBatch] that otherwise run in their own transaction join
+// it. Of opts only ReadOnly applies; explicit transactions are not
+// retried.
+//
+// A connection has at most one active transaction; Begin returns
+// [ErrTxActive] otherwise. Closing the connection rolls back an active
+// transaction.
+//
+// Example:
+//
+//	tx, err := conn.Begin(ctx, couac.TxOptions{})
+//	if err != nil { ... }
+//	defer tx.Rollback(ctx) // returns ErrTxDone after Commit, ignored here
+//
+//	if _, err := tx.Exec(ctx, "INSERT INTO orders VALUES (1)"); err != nil {
+//	    return err
+//	}
+//	if err := reserveStock(ctx, tx); err != nil {
+//	    return err
+//	}
+//	return tx.Commit(ctx)
+func (q *Conn) Begin(ctx context.Context, opts TxOptions) (*Tx, error) {
+	if err := q.ensureConnOpen(); err != nil {
+		return nil, err
+	}
+	if q.inTx {
+		return nil, ErrTxActive
+	}
+	tx := &Tx{
+		owner: q,
+		conn: &Conn{
+			parent:   q.parent,
+			conn:     q.conn,
+			catalog:  q.catalog,
+			dbSchema: q.dbSchema,
+			inTx:     true,
+			borrowed: true,
+		},
+	}
+	if !q.tx.CompareAndSwap(nil, tx) {
+		return nil, ErrTxActive
+	}
+
+	begin := "BEGIN TRANSACTION"
+	if opts.ReadOnly {
+		begin = "BEGIN TRANSACTION READ ONLY"
+	}
+	q.parent.rlock()
+	defer q.parent.mu.RUnlock()
+	if _, err := q.execInternal(ctx, begin); err != nil {
+		q.tx.Store(nil)
+		return nil, fmt.Errorf("couac: begin transaction: %w", err)
+	}
+	return tx, nil
+}
+
+// Commit commits the transaction. It returns [ErrTxDone] if the
+// transaction has already been committed or rolled back. If the commit
+// fails, e.g. with [ErrTransactionConflict], the transaction is rolled
+// back.
+func (tx *Tx) Commit(ctx context.Context) error {
+	return tx.finish(ctx, "COMMIT")
+}
+
+// Rollback aborts the transaction. It returns [ErrTxDone] if the
+// transaction has already been committed or rolled back, as
+// [database/sql.Tx.Rollback] does, so it can be deferred right after
+// [Conn.Begin] with its error ignored.
+func (tx *Tx) Rollback(ctx context.Context) error {
+	return tx.finish(ctx, "ROLLBACK")
+}
+
+// finish ends the transaction with COMMIT or ROLLBACK. The parent's
+// RWMutex is acquired before tx.mu, as [DB.Reopen] ends transactions
+// while holding the write lock.
+func (tx *Tx) finish(ctx context.Context, stmt string) error {
+	parent := tx.conn.parent
+	parent.rlock()
+	defer parent.mu.RUnlock()
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return ErrTxDone
+	}
+	if err := tx.owner.ensureConnOpen(); err != nil {
+		tx.end()
+		return err
+	}
+
+	if stmt == "ROLLBACK" {
+		ctx = context.WithoutCancel(ctx)
+	}
+	_, err := tx.owner.execInternal(ctx, stmt)
+	if err != nil && stmt == "COMMIT" {
+		tx.owner.execInternal(context.WithoutCancel(ctx), "ROLLBACK")
+	}
+	tx.end()
+	if err != nil {
+		return fmt.Errorf("couac: %s: %w", strings.ToLower(stmt), err)
+	}
+	return nil
+}
+
+// end marks the transaction finished and detaches it from its
+// connection. Caller must hold tx.mu.
+func (tx *Tx) end() {
+	tx.done = true
+	tx.conn.closed.Store(true)
+	tx.owner.tx.CompareAndSwap(tx, nil)
+}
+
+// inTransaction reports whether statements on q run in a transaction
+// owned by the caller: q belongs to [DB.WithTransaction] or a [Tx], or
+// has an active transaction from [Conn.Begin]. Methods that otherwise
+// wrap their work in their own transaction then join it instead.
+func (q *Conn) inTransaction() bool {
+	return q.inTx || q.tx.Load() != nil
+}
+
+// trackTxStatement records whether query, run through Exec or
+// ExecArgs with the outcome err, opened or closed a transaction, so
+// that [Pool.Release] rolls back only connections left in one. Only
+// single statements are recognized. DuckDB ends a transaction whose
+// COMMIT fails, so any COMMIT or ROLLBACK closes it.
+func (q *Conn) trackTxStatement(query string, err error) {
+	query = strings.TrimSpace(strings.TrimRight(strings.TrimSpace(query), ";"))
+	if strings.Contains(query, ";") {
+		return
+	}
+	keyword, _, _ := strings.Cut(query, " ")
+	switch strings.ToUpper(strings.TrimSpace(keyword)) {
+	case "BEGIN", "START":
+		if err == nil {
+			q.sqlTx.Store(true)
+		}
+	case "COMMIT", "END", "ROLLBACK", "ABORT":
+		q.sqlTx.Store(false)
+	}
+}
+
+// rollbackOnClose rolls back the active transaction of q, if any, before
+// q closes.
+func (q *Conn) rollbackOnClose() {
+	tx := q.tx.Load()
+	if tx == nil || q.parent == nil {
+		return
+	}
+	q.parent.rlock()
+	defer q.parent.mu.RUnlock()
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if !tx.done {
+		q.execInternal(context.Background(), "ROLLBACK")
+		tx.end()
+	}
+}
+
+// check returns ErrTxDone once the transaction has finished, and
+// ErrConnectionClosed if its connection has been closed.
+func (tx *Tx) check() error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return ErrTxDone
+	}
+	return tx.owner.ensureConnOpen()
+}
+
+// Conn returns a connection bound to the transaction, for use with
+// functions that take a [*Conn] such as [QueryAs] or [IngestSlice].
+// It fails with [ErrConnectionClosed] once the transaction has finished;
+// closing it only detaches it from the transaction.
+func (tx *Tx) Conn() *Conn { return tx.conn }
+
+// Exec is [Conn.Exec] within the transaction.
+func (tx *Tx) Exec(ctx context.Context, query string) (int64, error) {
+	if err := tx.check(); err != nil {
+		return 0, err
+	}
+	return tx.conn.Exec(ctx, query)
+}
+
+// ExecArgs is [Conn.ExecArgs] within the transaction.
+func (tx *Tx) ExecArgs(ctx context.Context, query string, args ...any) (int64, error) {
+	if err := tx.check(); err != nil {
+		return 0, err
+	}
+	return tx.conn.ExecArgs(ctx, query, args...)
+}
+
+// ExecBatch is [Conn.ExecBatch] within the transaction.
+func (tx *Tx) ExecBatch(ctx context.Context, query string, args [][]any) (*BatchResult, error) {
+	if err := tx.check(); err != nil {
+		return nil, err
+	}
+	return tx.conn.ExecBatch(ctx, query, args)
+}
+
+// Query is [Conn.Query] within the transaction.
+func (tx *Tx) Query(ctx context.Context, query string) (*QueryResult, error) {
+	if err := tx.check(); err != nil {
+		return nil, err
+	}
+	return tx.conn.Query(ctx, query)
+}
+
+// QueryArgs is [Conn.QueryArgs] within the transaction.
+func (tx *Tx) QueryArgs(ctx context.Context, query string, args ...any) (*QueryResult, error) {
+	if err := tx.check(); err != nil {
+		return nil, err
+	}
+	return tx.conn.QueryArgs(ctx, query, args...)
+}
+
+// Prepare is [Conn.Prepare] within the transaction. The statement must
+// not be used after the transaction has finished.
+func (tx *Tx) Prepare(ctx context.Context, query string) (Statement, error) {
+	if err := tx.check(); err != nil {
+		return nil, err
+	}
+	return tx.conn.Prepare(ctx, query)
+}
+
+// Ingest is [Conn.Ingest] within the transaction.
+func (tx *Tx) Ingest(ctx context.Context, destTable string, rec arrow.RecordBatch) (int64, error) {
+	if err := tx.check(); err != nil {
+		return 0, err
+	}
+	return tx.conn.Ingest(ctx, destTable, rec)
+}
+
+// IngestMerge is [Conn.IngestMerge] within the transaction.
+func (tx *Tx) IngestMerge(ctx context.Context, destTable string, rec arrow.RecordBatch) (int64, error) {
+	if err := tx.check(); err != nil {
+		return 0, err
+	}
+	return tx.conn.IngestMerge(ctx, destTable, rec)
+}
+
+// IngestReplace is [Conn.IngestReplace] within the transaction.
+func (tx *Tx) IngestReplace(ctx context.Context, destTable string, rec arrow.RecordBatch) (int64, error) {
+	if err := tx.check(); err != nil {
+		return 0, err
+	}
+	return tx.conn.IngestReplace(ctx, destTable, rec)
+}
+
+// IngestMergePolicy is [Conn.IngestMergePolicy] within the transaction.
+func (tx *Tx) IngestMergePolicy(ctx context.Context, destTable string, rec arrow.RecordBatch, policy SchemaPolicy) (int64, *SchemaChange, error) {
+	if err := tx.check(); err != nil {
+		return 0, nil, err
+	}
+	return tx.conn.IngestMergePolicy(ctx, destTable, rec, policy)
+}
+
+// IngestUpsert is [Conn.IngestUpsert] within the transaction.
+func (tx *Tx) IngestUpsert(ctx context.Context, destTable string, rec arrow.RecordBatch, keyColumns []string, opts ...UpsertOption) (int64, error) {
+	if err := tx.check(); err != nil {
+		return 0, err
+	}
+	return tx.conn.IngestUpsert(ctx, destTable, rec, keyColumns, opts...)
+}
+
+// IngestStream is [Conn.IngestStream] within the transaction.
+func (tx *Tx) IngestStream(ctx context.Context, destTable string, reader array.RecordReader) (int64, error) {
+	if err := tx.check(); err != nil {
+		return 0, err
+	}
+	return tx.conn.IngestStream(ctx, destTable, reader)
+}
+
+// IngestBatch is [Conn.IngestBatch] within the transaction.
+func (tx *Tx) IngestBatch(ctx context.Context, entries []IngestEntry) (*IngestSummary, error) {
+	if err := tx.check(); err != nil {
+		return nil, err
+	}
+	return tx.conn.IngestBatch(ctx, entries)
+}
+
+// IngestFile is [Conn.IngestFile] within the transaction.
+func (tx *Tx) IngestFile(ctx context.Context, destTable, path string, opts ...FileOption) (int64, error) {
+	if err := tx.check(); err != nil {
+		return 0, err
+	}
+	return tx.conn.IngestFile(ctx, destTable, path, opts...)
+}
@@ -0,0 +1,372 @@
+package couac_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/loicalleyne/couac"
+)
+
+// conflictOnce makes the transaction's update of row 1 in table c
+// conflict with a concurrent transaction on the first attempts.
+func conflictOnce(t *testing.T, other *couac.Conn, conflicts int) func(*couac.Conn) error {
+	ctx := context.Background()
+	return func(tx *couac.Conn) error {
+		if tx.Attempt() <= conflicts {
+			if _, err := other.Exec(ctx, "BEGIN TRANSACTION"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := other.Exec(ctx, "UPDATE c SET v = v + 10 WHERE id = 1"); err != nil {
+				t.Fatal(err)
+			}
+			defer other.Exec(ctx, "COMMIT")
+		}
+		_, err := tx.Exec(ctx, "UPDATE c SET v = v + 1 WHERE id = 1")
+		return err
+	}
+}
+
+func newConflictTable(t *testing.T) (*couac.DB, *couac.Conn, *couac.Conn) {
+	db, conn := newTestConn(t)
+	ctx := context.Background()
+	if _, err := conn.Exec(ctx, "CREATE TABLE c (id INT, v INT)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Exec(ctx, "INSERT INTO c VALUES (1, 0)"); err != nil {
+		t.Fatal(err)
+	}
+	other, err := db.Connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { other.Close() })
+	return db, conn, other
+}
+
+func TestWithTransactionOpts_RetriesConflict(t *testing.T) {
+	db, conn, other := newConflictTable(t)
+	ctx := context.Background()
+
+	var attempts []int
+	fn := conflictOnce(t, other, 1)
+	err := db.WithTransactionOpts(ctx, couac.TxOptions{MaxRetries: 3}, func(tx *couac.Conn) error {
+		attempts = append(attempts, tx.Attempt())
+		return fn(tx)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attempts) != 2 || attempts[1] != 2 {
+		t.Errorf("expected attempts [1 2], got %v", attempts)
+	}
+
+	v, err := couac.QueryAs[struct {
+		V int64 `couac:"v"`
+	}](ctx, conn, "SELECT v FROM c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v[0].V != 11 {
+		t.Errorf("expected v = 11, got %d", v[0].V)
+	}
+
+	s := db.TxStats()
+	if s.Transactions != 1 || s.Commits != 1 || s.Conflicts != 1 || s.Retries != 1 || s.Exhausted != 0 {
+		t.Errorf("unexpected stats: %+v", s)
+	}
+}
+
+func TestWithTransactionOpts_Exhausted(t *testing.T) {
+	db, _, other := newConflictTable(t)
+
+	var waits []int
+	opts := couac.TxOptions{
+		MaxRetries: 2,
+		Backoff: func(attempt int) time.Duration {
+			waits = append(waits, attempt)
+			return time.Millisecond
+		},
+	}
+	err := db.WithTransactionOpts(context.Background(), opts, conflictOnce(t, other, 100))
+	if !errors.Is(err, couac.ErrTransactionConflict) {
+		t.Fatalf("expected ErrTransactionConflict, got %v", err)
+	}
+	if len(waits) != 2 || waits[0] != 1 || waits[1] != 2 {
+		t.Errorf("expected backoff for attempts [1 2], got %v", waits)
+	}
+	if s := db.TxStats(); s.Rollbacks != 3 || s.Retries != 2 || s.Exhausted != 1 {
+		t.Errorf("unexpected stats: %+v", s)
+	}
+}
+
+func TestWithTransactionOpts_NoRetryByDefault(t *testing.T) {
+	db, _, other := newConflictTable(t)
+
+	err := db.WithTransaction(context.Background(), conflictOnce(t, other, 1))
+	if !errors.Is(err, couac.ErrTransactionConflict) {
+		t.Fatalf("expected ErrTransactionConflict, got %v", err)
+	}
+	if s := db.TxStats(); s.Retries != 0 {
+		t.Errorf("expected no retries, got %+v", s)
+	}
+}
+
+func TestWithTransactionOpts_RetryOn(t *testing.T) {
+	db := newTestDB(t)
+	errBusy := errors.New("busy")
+
+	calls := 0
+	opts := couac.TxOptions{
+		MaxRetries: 5,
+		Backoff:    func(int) time.Duration { return 0 },
+		RetryOn:    func(err error) bool { return errors.Is(err, errBusy) },
+	}
+	err := db.WithTransactionOpts(context.Background(), opts, func(tx *couac.Conn) error {
+		calls++
+		if tx.Attempt() < 3 {
+			return errBusy
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 calls, got %d", calls)
+	}
+}
+
+func TestWithTransactionOpts_ContextDoneDuringBackoff(t *testing.T) {
+	db, _, other := newConflictTable(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	opts := couac.TxOptions{
+		MaxRetries: 5,
+		Backoff:    func(int) time.Duration { return time.Minute },
+	}
+	err := db.WithTransactionOpts(ctx, opts, conflictOnce(t, other, 100))
+	if !errors.Is(err, context.DeadlineExceeded) || !errors.Is(err, couac.ErrTransactionConflict) {
+		t.Errorf("expected deadline and conflict errors, got %v", err)
+	}
+}
+
+func TestWithTransactionOpts_ReadOnly(t *testing.T) {
+	db, _, _ := newConflictTable(t)
+	ctx := context.Background()
+
+	err := db.WithTransactionOpts(ctx, couac.TxOptions{ReadOnly: true}, func(tx *couac.Conn) error {
+		_, err := tx.Exec(ctx, "UPDATE c SET v = 1")
+		return err
+	})
+	if err == nil {
+		t.Fatal("expected write in read-only transaction to fail")
+	}
+	err = db.WithTransactionOpts(ctx, couac.TxOptions{ReadOnly: true}, func(tx *couac.Conn) error {
+		_, err := tx.Exec(ctx, "SELECT count(*) FROM c")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTx_CommitAndRollback(t *testing.T) {
+	_, conn := newTestConn(t)
+	ctx := context.Background()
+	if _, err := conn.Exec(ctx, "CREATE TABLE t (i INT)"); err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := conn.Begin(ctx, couac.TxOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec(ctx, "INSERT INTO t VALUES (1)"); err != nil {
+		t.Fatal(err)
+	}
+	rec := makeTestRecord(t, 3)
+	defer rec.Release()
+	if _, err := tx.Ingest(ctx, "t_ingest", rec); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := tableCount(t, conn, "t"); n != 1 {
+		t.Errorf("expected 1 committed row, got %d", n)
+	}
+	if n := tableCount(t, conn, "t_ingest"); n != 3 {
+		t.Errorf("expected 3 ingested rows, got %d", n)
+	}
+
+	tx, err = conn.Begin(ctx, couac.TxOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec(ctx, "INSERT INTO t VALUES (2)"); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := couac.QueryAs[struct {
+		N int64 `couac:"n"`
+	}](ctx, tx.Conn(), "SELECT count(*) AS n FROM t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows[0].N != 2 {
+		t.Errorf("expected the transaction to see its own insert, got %d rows", rows[0].N)
+	}
+	if err := tx.Rollback(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := tableCount(t, conn, "t"); n != 1 {
+		t.Errorf("expected rollback to discard the insert, got %d rows", n)
+	}
+}
+
+func TestTx_OwnerJoinsTransaction(t *testing.T) {
+	_, conn := newTestConn(t)
+	ctx := context.Background()
+	if _, err := conn.Exec(ctx, "CREATE TABLE t (i INT)"); err != nil {
+		t.Fatal(err)
+	}
+	rec := makeTestRecord(t, 3)
+	defer rec.Release()
+
+	tx, err := conn.Begin(ctx, couac.TxOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.ExecBatch(ctx, "INSERT INTO t VALUES (?)", [][]any{{1}, {2}}); err != nil {
+		t.Fatalf("ExecBatch on the owner: %v", err)
+	}
+	if _, err := conn.IngestBatch(ctx, []couac.IngestEntry{{Table: "t_batch", Record: rec}}); err != nil {
+		t.Fatalf("IngestBatch on the owner: %v", err)
+	}
+	ext := makeTestRecordExtended(t, 2)
+	defer ext.Release()
+	if _, _, err := conn.IngestMergePolicy(ctx, "t_batch", ext, couac.AllowAdd); err != nil {
+		t.Fatalf("IngestMergePolicy on the owner: %v", err)
+	}
+	if n := tableCount(t, tx.Conn(), "t"); n != 2 {
+		t.Errorf("expected the transaction to see 2 rows, got %d", n)
+	}
+	if err := tx.Rollback(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := tableCount(t, conn, "t"); n != 0 {
+		t.Errorf("expected rollback to discard the batch, got %d rows", n)
+	}
+	if _, err := conn.Exec(ctx, "SELECT * FROM t_batch"); err == nil {
+		t.Error("expected rollback to discard table t_batch")
+	}
+}
+
+func TestTx_Finished(t *testing.T) {
+	_, conn := newTestConn(t)
+	ctx := context.Background()
+
+	tx, err := conn.Begin(ctx, couac.TxOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Begin(ctx, couac.TxOptions{}); !errors.Is(err, couac.ErrTxActive) {
+		t.Errorf("expected ErrTxActive, got %v", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(ctx); !errors.Is(err, couac.ErrTxDone) {
+		t.Errorf("expected ErrTxDone on double commit, got %v", err)
+	}
+	if err := tx.Rollback(ctx); !errors.Is(err, couac.ErrTxDone) {
+		t.Errorf("expected ErrTxDone on rollback after commit, got %v", err)
+	}
+	if _, err := tx.Exec(ctx, "SELECT 1"); !errors.Is(err, couac.ErrTxDone) {
+		t.Errorf("expected ErrTxDone on use after commit, got %v", err)
+	}
+	if _, err := tx.Conn().Exec(ctx, "SELECT 1"); !errors.Is(err, couac.ErrConnectionClosed) {
+		t.Errorf("expected ErrConnectionClosed from the transaction's Conn, got %v", err)
+	}
+
+	// The connection can start a new transaction once the first finished.
+	tx, err = conn.Begin(ctx, couac.TxOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.Rollback(ctx)
+}
+
+func TestTx_ReadOnly(t *testing.T) {
+	_, conn := newTestConn(t)
+	ctx := context.Background()
+	if _, err := conn.Exec(ctx, "CREATE TABLE t (i INT)"); err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := conn.Begin(ctx, couac.TxOptions{ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, "INSERT INTO t VALUES (1)"); err == nil {
+		t.Error("expected write in read-only transaction to fail")
+	}
+}
+
+func TestTx_RollbackOnConnClose(t *testing.T) {
+	db, conn := newTestConn(t)
+	ctx := context.Background()
+	if _, err := conn.Exec(ctx, "CREATE TABLE t (i INT)"); err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := db.Connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := other.Begin(ctx, couac.TxOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec(ctx, "INSERT INTO t VALUES (1)"); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(ctx); !errors.Is(err, couac.ErrTxDone) {
+		t.Errorf("expected ErrTxDone after close, got %v", err)
+	}
+	if n := tableCount(t, conn, "t"); n != 0 {
+		t.Errorf("expected close to roll back, got %d rows", n)
+	}
+}
+
+func TestWithTransaction_RollbackStats(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected the panic to propagate")
+			}
+		}()
+		db.WithTransaction(ctx, func(*couac.Conn) error { panic("boom") })
+	}()
+	if s := db.TxStats(); s.Rollbacks != 1 || s.Commits != 0 {
+		t.Errorf("expected the panic to count a rollback, got %+v", s)
+	}
+
+	// No transaction begins on a closed database.
+	db.Close()
+	if err := db.WithTransaction(ctx, func(*couac.Conn) error { return nil }); err == nil {
+		t.Fatal("expected WithTransaction on a closed database to fail")
+	}
+	if s := db.TxStats(); s.Rollbacks != 1 {
+		t.Errorf("expected a failed BEGIN not to count a rollback, got %+v", s)
+	}
+}
@@ -6,7 +6,7 @@
 //   - Connection pooling with concurrency-safe tracking
 //   - Query execution returning Apache Arrow record batches
 //   - Bulk ingestion from Arrow record batches with automatic table creation
-//   - Schema evolution via UNION BY NAME merge strategy
+//   - In-place schema evolution (ADD COLUMN, type widening) with configurable policy
 //   - Hierarchical catalog/schema/table metadata with typed navigation
 //   - Safe database compaction without disrupting open connections
 //   - Extension and secret management
@@ -46,14 +46,17 @@ package couac
 
 import (
 	"errors"
+	"fmt"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"context"
 
 	"github.com/apache/arrow-adbc/go/adbc"
 	"github.com/apache/arrow-go/v18/arrow"
 	"github.com/apache/arrow-go/v18/arrow/array"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Sentinel errors returned by couac functions.
@@ -71,6 +74,72 @@ var (
 	// ErrPathAlreadyOpen is returned when attempting to open a database file that
 	// is already open in this process.
 	ErrPathAlreadyOpen = errors.New("couac: database file is already open in this process")
+	// ErrReadOnly is returned by the methods that modify a database
+	// opened with [WithReadOnly]. Statements that DuckDB rejects because
+	// the database is read-only also match it (see [Error]).
+	ErrReadOnly = errors.New("couac: database is read-only")
+	// ErrLockedByOtherProcess is matched by the [LockError] returned by
+	// [NewDuck] when another process holds the lock on the database file.
+	ErrLockedByOtherProcess = errors.New("couac: database file is locked by another process")
+	// ErrNoKeyColumns is returned when an upsert is requested without key columns.
+	ErrNoKeyColumns = errors.New("couac: upsert requires at least one key column")
+	// ErrSchemaMismatch is returned when an ingested batch's schema is
+	// incompatible with its destination table under the active [SchemaPolicy].
+	ErrSchemaMismatch = errors.New("couac: schema mismatch")
+	// ErrUnknownFileFormat is returned when the format of a file to
+	// ingest cannot be determined from its extension.
+	ErrUnknownFileFormat = errors.New("couac: unknown file format")
+	// ErrPoolClosed is returned when a connection is acquired from a
+	// closed [Pool].
+	ErrPoolClosed = errors.New("couac: pool is closed")
+	// ErrTxDone is returned when a [Tx] is used after it has been
+	// committed or rolled back.
+	ErrTxDone = errors.New("couac: transaction has already been committed or rolled back")
+	// ErrTxActive is returned by [Conn.Begin] when the connection
+	// already has an active transaction.
+	ErrTxActive = errors.New("couac: connection already has an active transaction")
+	// ErrRejected is returned when a [Hook] rejects a statement, ingest,
+	// or maintenance operation. The error also wraps the hook's error.
+	ErrRejected = errors.New("couac: rejected by hook")
+	// ErrUnknownSetting is matched by the [UnknownSettingError] returned
+	// for keys that are not DuckDB settings.
+	ErrUnknownSetting = errors.New("couac: unknown setting")
+	// ErrInvalidConfig is returned by [NewDuck] when a [Config] field or
+	// [WithSetting] option is invalid.
+	ErrInvalidConfig = errors.New("couac: invalid configuration")
+	// ErrCancelNotSupported is wrapped by the errors of statements whose
+	// context was cancelled when the running statement could not be
+	// interrupted: the driver implements neither AdbcStatementCancel nor
+	// a known DuckDB interrupt. Such statements run to completion.
+	ErrCancelNotSupported = errors.New("couac: cancel not supported")
+	// ErrResultsOpen is returned by [DB.Reopen] while query results
+	// read from the database's connections are not closed yet.
+	ErrResultsOpen = errors.New("couac: query results still open")
+)
+
+// Error class sentinels matched by DuckDB errors (see [Error]) with
+// errors.Is.
+var (
+	// ErrConstraintViolation matches primary key, unique, NOT NULL,
+	// CHECK and foreign key violations.
+	ErrConstraintViolation = errors.New("couac: constraint violation")
+	// ErrTransactionConflict matches write-write conflicts between
+	// concurrent transactions; the transaction can be retried.
+	ErrTransactionConflict = errors.New("couac: transaction conflict")
+	// ErrCatalog matches references to tables, schemas, functions or
+	// other catalog entries that do not exist or already exist.
+	ErrCatalog = errors.New("couac: catalog error")
+	// ErrParser matches SQL syntax errors.
+	ErrParser = errors.New("couac: parser error")
+	// ErrBinder matches errors resolving columns, types or function
+	// overloads in a syntactically valid statement.
+	ErrBinder = errors.New("couac: binder error")
+	// ErrOutOfMemory matches statements that exceeded DuckDB's memory
+	// limit.
+	ErrOutOfMemory = errors.New("couac: out of memory")
+	// ErrInterrupted matches statements interrupted before completion,
+	// e.g. because their context was cancelled.
+	ErrInterrupted = errors.New("couac: interrupted")
 )
 
 // ObjectDepth controls how deep [Conn.Objects] recurses into the
@@ -127,7 +196,8 @@ type DB struct {
 	drv adbc.Driver
 	db  adbc.Database
 	// mu protects ducklings and is used by Compact/ForceCheckpoint to
-	// pause all concurrent operations.
+	// pause all concurrent operations. Operations acquire it with
+	// rlock and lock, which record waits for Stats.
 	mu sync.RWMutex
 	// duckdb database connections
 	ducklings []*Conn
@@ -135,6 +205,51 @@ type DB struct {
 	path       string
 	driverPath string
 	closed     atomic.Bool
+	// tableLocks serializes schema-changing ingests per destination
+	// table; entries are removed once unused. tableLocksMu protects it.
+	tableLocksMu sync.Mutex
+	tableLocks   map[string]*tableLock
+	// pool is the default pool used by DB.Do, created on first use
+	// with poolOpts.
+	pool     *Pool
+	poolOnce sync.Once
+	poolOpts []PoolOption
+	// redactSQL replaces literals in the SQL carried by errors.
+	redactSQL bool
+	// txStats counts transactions run by WithTransactionOpts.
+	txStats txCounters
+	// hooks are the hooks installed with WithHooks, in call order.
+	hooks []Hook
+	// tracer emits spans when set with WithTracerProvider;
+	// traceStatements adds the SQL text to them.
+	tracer          trace.Tracer
+	traceStatements bool
+	// metrics records the counters of Stats when set with WithMetrics.
+	metrics *metrics
+	// openResults counts the query results that are not closed yet.
+	openResults atomic.Int64
+	// dbConfig holds the settings applied at open by WithConfig and
+	// WithSetting.
+	dbConfig Config
+	// readOnly is set by WithReadOnly; mutating methods return
+	// ErrReadOnly.
+	readOnly bool
+	// dbOpts are the options the database was opened with, kept for
+	// Reopen.
+	dbOpts map[string]string
+	// lockWait and lockPoll are set by WithLockWait.
+	lockWait, lockPoll time.Duration
+	// settingInputs holds the settingInput of global settings changed
+	// with Conn.Set, by setting name.
+	settingInputs sync.Map
+	// opened holds the settings of the database as opened, loaded by
+	// NewDuck.
+	opened *openedSettings
+}
+
+// txCounters holds the counters reported by [DB.TxStats].
+type txCounters struct {
+	transactions, commits, rollbacks, conflicts, retries, exhausted atomic.Int64
 }
 
 // Conn represents a single connection to a DuckDB database.
@@ -153,7 +268,37 @@ type Conn struct {
 	conn     adbc.Connection
 	catalog  string
 	dbSchema string
+	// inTx is set on connections created by WithTransaction, whose
+	// transaction is owned by the caller.
+	inTx bool
+	// attempt is the WithTransactionOpts attempt number of a
+	// transaction connection.
+	attempt int
+	// tx is the active transaction started by Begin, if any.
+	tx atomic.Pointer[Tx]
+	// sqlTx is set while a transaction started with a BEGIN statement
+	// through Exec or ExecArgs is open.
+	sqlTx atomic.Bool
+	// borrowed is set on the connection of a Tx, which shares the ADBC
+	// connection of its owner and must not close it.
+	borrowed bool
 	closed   atomic.Bool
+	// settingInputs holds the settingInput of the session settings
+	// changed with Set, by setting name.
+	settingInputs sync.Map
+}
+
+// Tx is an explicit transaction started by [Conn.Begin]. It is finished
+// by [Tx.Commit] or [Tx.Rollback]; after that every method returns
+// [ErrTxDone]. Like its connection, a Tx must not be used from several
+// goroutines at once.
+type Tx struct {
+	owner *Conn
+	// conn shares owner's ADBC connection and is marked closed once
+	// the transaction finishes.
+	conn *Conn
+	mu   sync.Mutex
+	done bool
 }
 
 // Option configures a [DB] during construction via [NewDuck].
@@ -175,8 +320,28 @@ type QueryResult struct {
 	Reader array.RecordReader
 	// stmt is the underlying ADBC statement (closed by QueryResult.Close).
 	stmt adbc.Statement
+	// watch cancels stmt when the query's context is done.
+	watch *cancelWatch
 	// RowsAffected is the number of rows affected, or -1 if unknown.
 	RowsAffected int64
+	// after runs the AfterQuery hooks on Close with the rows counted
+	// by counter.
+	after   afterFunc
+	counter *countingReader
+	// db counts the result as open until Close.
+	db *DB
+}
+
+// newQueryResult returns the result of a query executed on db. When
+// after is set, the rows read are counted for the AfterQuery hooks.
+func newQueryResult(db *DB, rr array.RecordReader, stmt adbc.Statement, watch *cancelWatch, n int64, after afterFunc) *QueryResult {
+	db.openResults.Add(1)
+	qr := &QueryResult{Reader: rr, stmt: stmt, watch: watch, RowsAffected: n, after: after, db: db}
+	if after != nil {
+		qr.counter = &countingReader{RecordReader: rr}
+		qr.Reader = qr.counter
+	}
+	return qr
 }
 
 // Close releases the resources associated with the query result.
@@ -184,10 +349,20 @@ type QueryResult struct {
 // Close is idempotent.
 func (qr *QueryResult) Close() error {
 	var errs []error
+	if qr.after != nil {
+		qr.after(qr.counter.rows, qr.counter.Err())
+		qr.after = nil
+	}
+	if qr.db != nil {
+		qr.db.openResults.Add(-1)
+		qr.db = nil
+	}
 	if qr.Reader != nil {
 		qr.Reader.Release()
 		qr.Reader = nil
 	}
+	qr.watch.stop()
+	qr.watch = nil
 	if qr.stmt != nil {
 		if err := qr.stmt.Close(); err != nil {
 			errs = append(errs, err)
@@ -206,6 +381,18 @@ func (qr *QueryResult) Schema() *arrow.Schema {
 	return qr.Reader.Schema()
 }
 
+// BatchResult reports the outcome of a [Conn.ExecBatch] or
+// [Conn.ExecBatchRecord] call.
+type BatchResult struct {
+	// RowsAffected holds the rows affected by each parameter row that
+	// executed successfully, in order; -1 entries mean unknown. On
+	// failure the batch is rolled back, so these counts were not applied.
+	RowsAffected []int64
+	// FailedRow is the index of the first parameter row that failed,
+	// or -1 if every row succeeded.
+	FailedRow int
+}
+
 // ObjectsOption configures a [Conn.Objects] call.
 type ObjectsOption func(*objectsConfig)
 
@@ -298,6 +485,404 @@ func WithEncryptionKey(key string) AttachOption {
 	}
 }
 
+// UpsertOption configures a [Conn.IngestUpsert] call.
+type UpsertOption func(*upsertConfig)
+
+type upsertConfig struct {
+	versionColumn string
+	deleteMarker  string
+}
+
+// WithVersionColumn enables "last write wins" resolution for an upsert:
+// an incoming row only replaces an existing row when its value in the
+// named column is greater than the stored value (or the stored value is
+// NULL). Within the batch, the row with the highest version per key wins.
+func WithVersionColumn(column string) UpsertOption {
+	return func(cfg *upsertConfig) {
+		cfg.versionColumn = column
+	}
+}
+
+// WithDeleteMarker names a BOOLEAN column of the incoming batch whose
+// true values mark deletions: the matching row is deleted from the
+// destination instead of being updated, and the marker column itself
+// is not written to the destination table.
+func WithDeleteMarker(column string) UpsertOption {
+	return func(cfg *upsertConfig) {
+		cfg.deleteMarker = column
+	}
+}
+
+// SchemaPolicy controls which schema changes [Conn.IngestMergePolicy]
+// may apply to an existing table. Policies are bit flags and can be
+// combined, e.g. AllowAdd|AllowWiden.
+type SchemaPolicy int
+
+const (
+	// Strict rejects any difference in column names or types between
+	// the batch and the table. Column order is still ignored.
+	Strict SchemaPolicy = 0
+	// AllowAdd adds columns that are new in the batch with
+	// ALTER TABLE ADD COLUMN.
+	AllowAdd SchemaPolicy = 1 << 0
+	// AllowWiden widens table columns when the batch carries a wider
+	// type of the same kind (e.g. INTEGER→BIGINT, FLOAT→DOUBLE), or a
+	// type of another kind (e.g. INTEGER→DOUBLE, INTEGER→VARCHAR) or a
+	// decimal or timestamp with other parameters (e.g.
+	// DECIMAL(10,2)→DECIMAL(18,4), TIMESTAMP→TIMESTAMPTZ) to the type
+	// DuckDB's UNION BY NAME combines both into, with ALTER TABLE ALTER
+	// COLUMN TYPE.
+	AllowWiden SchemaPolicy = 1 << 1
+	// AllowDrop drops table columns that are absent from the batch
+	// instead of filling them with NULL.
+	AllowDrop SchemaPolicy = 1 << 2
+
+	// DefaultSchemaPolicy is the policy used by [Conn.IngestMerge].
+	DefaultSchemaPolicy = AllowAdd | AllowWiden
+)
+
+// SchemaChange reports the schema differences between an ingested
+// batch and its destination table, and how they were resolved.
+// When an ingest is rejected by its [SchemaPolicy], the report lists
+// the differences that were found but nothing has been applied.
+type SchemaChange struct {
+	// Table is the destination table name.
+	Table string
+	// Created is true when the table did not exist and was created
+	// from the batch schema.
+	Created bool
+	// Added lists columns added to the table.
+	Added []arrow.Field
+	// Widened lists columns whose type was widened.
+	Widened []ColumnWidening
+	// Dropped lists columns removed from the table (AllowDrop only).
+	Dropped []string
+	// Missing lists table columns absent from the batch that were
+	// filled with NULL.
+	Missing []string
+	// Reordered is true when the batch columns were reordered to match
+	// the table.
+	Reordered bool
+}
+
+// ColumnWidening describes a column whose type was widened.
+type ColumnWidening struct {
+	Name string
+	From arrow.DataType
+	To   arrow.DataType
+}
+
+// Altered reports whether the table's schema was modified, i.e. any
+// column was added, widened, or dropped.
+func (c *SchemaChange) Altered() bool {
+	return len(c.Added) > 0 || len(c.Widened) > 0 || len(c.Dropped) > 0
+}
+
+// IngestMode selects how an [IngestEntry] is written by [Conn.IngestBatch].
+type IngestMode int
+
+const (
+	// IngestModeAppend creates the table if needed, then appends, like
+	// [Conn.Ingest].
+	IngestModeAppend IngestMode = iota
+	// IngestModeMerge evolves the table schema with [DefaultSchemaPolicy]
+	// and appends, like [Conn.IngestMerge].
+	IngestModeMerge
+	// IngestModeReplace drops and recreates the table from the record,
+	// like [Conn.IngestReplace].
+	IngestModeReplace
+)
+
+// String returns the mode name.
+func (m IngestMode) String() string {
+	switch m {
+	case IngestModeAppend:
+		return "append"
+	case IngestModeMerge:
+		return "merge"
+	case IngestModeReplace:
+		return "replace"
+	default:
+		return fmt.Sprintf("IngestMode(%d)", int(m))
+	}
+}
+
+// IngestEntry is one table load of a [Conn.IngestBatch] call.
+type IngestEntry struct {
+	Table  string
+	Record arrow.RecordBatch
+	Mode   IngestMode
+}
+
+// IngestSummary reports the outcome of a successful [Conn.IngestBatch].
+type IngestSummary struct {
+	// Rows is the number of rows ingested per destination table.
+	Rows map[string]int64
+	// SchemaChanges holds the schema changes applied by
+	// [IngestModeMerge] entries, per destination table, in entry order.
+	SchemaChanges map[string][]*SchemaChange
+}
+
+// FileFormat selects the reader used by [Conn.IngestFile].
+type FileFormat int
+
+const (
+	// FormatAuto detects the format from the file extension.
+	FormatAuto FileFormat = iota
+	// FormatParquet reads Parquet files with DuckDB's read_parquet.
+	FormatParquet
+	// FormatCSV reads CSV files with DuckDB's read_csv.
+	FormatCSV
+	// FormatJSON reads JSON or newline-delimited JSON files with
+	// DuckDB's read_json.
+	FormatJSON
+	// FormatArrowIPC reads Arrow IPC files or streams in Go and feeds
+	// them to the ADBC ingest path, without a DuckDB reader.
+	FormatArrowIPC
+)
+
+// FileOption configures a [Conn.IngestFile] call.
+type FileOption func(*fileConfig)
+
+type fileConfig struct {
+	format      FileFormat
+	mode        IngestMode
+	hive        bool
+	readOptions []readOption
+}
+
+type readOption struct {
+	name  string
+	value any
+}
+
+// WithFileFormat sets the file format instead of detecting it from the
+// file extension.
+func WithFileFormat(format FileFormat) FileOption {
+	return func(cfg *fileConfig) {
+		cfg.format = format
+	}
+}
+
+// WithFileMode sets how the file contents are written to the target
+// table. The default is [IngestModeAppend].
+func WithFileMode(mode IngestMode) FileOption {
+	return func(cfg *fileConfig) {
+		cfg.mode = mode
+	}
+}
+
+// WithHivePartitioning reads hive-style partition directories
+// (e.g. year=2024/month=01/) and adds the partition keys as columns.
+// It is not supported for [FormatArrowIPC].
+func WithHivePartitioning() FileOption {
+	return func(cfg *fileConfig) {
+		cfg.hive = true
+	}
+}
+
+// WithReadOption passes a named parameter to the DuckDB reader
+// function, e.g. WithReadOption("delim", ";") for read_csv. Values may
+// be strings, booleans, or numbers. It is ignored for [FormatArrowIPC].
+func WithReadOption(name string, value any) FileOption {
+	return func(cfg *fileConfig) {
+		cfg.readOptions = append(cfg.readOptions, readOption{name: name, value: value})
+	}
+}
+
+// ExportOption configures a [Conn.Export] call, or the
+// [QueryResult.WriteParquet] and [QueryResult.WriteIPC] writers.
+type ExportOption func(*exportConfig)
+
+type exportConfig struct {
+	compression     string
+	rowGroupSize    int
+	partitionBy     []string
+	perThreadOutput bool
+	overwrite       bool
+	copyOptions     []readOption
+}
+
+// WithCompression sets the compression codec, e.g. "zstd", "snappy",
+// "gzip" or "uncompressed" for Parquet, "gzip" or "zstd" for CSV and
+// JSON, and "zstd" or "lz4" for Arrow IPC.
+func WithCompression(codec string) ExportOption {
+	return func(cfg *exportConfig) {
+		cfg.compression = codec
+	}
+}
+
+// WithRowGroupSize sets the maximum number of rows per Parquet row group.
+func WithRowGroupSize(rows int) ExportOption {
+	return func(cfg *exportConfig) {
+		cfg.rowGroupSize = rows
+	}
+}
+
+// WithPartitionBy writes a hive-partitioned directory tree, one
+// directory level per column (e.g. year=2024/month=01/). The export
+// path is then a directory.
+func WithPartitionBy(columns ...string) ExportOption {
+	return func(cfg *exportConfig) {
+		cfg.partitionBy = columns
+	}
+}
+
+// WithPerThreadOutput writes one file per DuckDB thread into the
+// export path, which is then a directory. This is faster for large
+// results.
+func WithPerThreadOutput() ExportOption {
+	return func(cfg *exportConfig) {
+		cfg.perThreadOutput = true
+	}
+}
+
+// WithOverwrite allows an export to replace the contents of an existing
+// output directory. Arrow IPC exports refuse to replace an existing file
+// unless it is set.
+func WithOverwrite() ExportOption {
+	return func(cfg *exportConfig) {
+		cfg.overwrite = true
+	}
+}
+
+// WithCopyOption passes any other named option to DuckDB's COPY
+// statement, e.g. WithCopyOption("delimiter", "|"). Values may be
+// strings, booleans, or numbers.
+func WithCopyOption(name string, value any) ExportOption {
+	return func(cfg *exportConfig) {
+		cfg.copyOptions = append(cfg.copyOptions, readOption{name: name, value: value})
+	}
+}
+
+// StagingTable describes a staging table left behind by an ingest of
+// an earlier version of couac, as returned by
+// [Conn.OrphanedStagingTables].
+type StagingTable struct {
+	Catalog  string
+	DBSchema string
+	Name     string
+	// Destination is the table the staged rows were meant for.
+	Destination string
+}
+
+// TxOptions configures [DB.WithTransactionOpts].
+type TxOptions struct {
+	// ReadOnly starts the transaction with BEGIN TRANSACTION READ ONLY.
+	ReadOnly bool
+	// MaxRetries is how many times a failed transaction is retried when
+	// RetryOn accepts its error. Zero disables retries.
+	MaxRetries int
+	// Backoff returns how long to wait before the retry that follows
+	// failed attempt number attempt (starting at 1). If nil, the wait
+	// grows exponentially from 10ms up to 1s, with random jitter so
+	// that conflicting writers do not retry in lockstep.
+	Backoff func(attempt int) time.Duration
+	// RetryOn reports whether a failed attempt should be retried. If
+	// nil, errors matching [ErrTransactionConflict] are retried.
+	RetryOn func(err error) bool
+}
+
+// TxStats reports counters of the transactions run by
+// [DB.WithTransaction] and [DB.WithTransactionOpts].
+type TxStats struct {
+	// Transactions is the number of WithTransaction calls.
+	Transactions int64
+	// Commits and Rollbacks count attempts that committed and that
+	// rolled back, including on a panic in fn. Attempts whose
+	// connection or BEGIN failed count as neither.
+	Commits   int64
+	Rollbacks int64
+	// Conflicts counts attempts that failed with a transaction conflict.
+	Conflicts int64
+	// Retries counts attempts that were retried.
+	Retries int64
+	// Exhausted counts transactions that still failed after their last
+	// allowed retry.
+	Exhausted int64
+}
+
+// PoolOption configures a [Pool] created by [DB.Pool] or [WithPool].
+type PoolOption func(*poolConfig)
+
+type poolConfig struct {
+	maxOpen     int
+	maxIdle     int
+	idleTimeout time.Duration
+	initSQL     []string
+	catalog     string
+	dbSchema    string
+}
+
+// WithMaxOpen limits the number of connections the pool has open at
+// once; [Pool.Acquire] blocks when the limit is reached. Zero (the
+// default) means no limit.
+func WithMaxOpen(n int) PoolOption {
+	return func(cfg *poolConfig) {
+		cfg.maxOpen = n
+	}
+}
+
+// WithMaxIdle sets how many released connections the pool keeps open
+// for reuse. The default is 2; zero closes every connection on release.
+func WithMaxIdle(n int) PoolOption {
+	return func(cfg *poolConfig) {
+		cfg.maxIdle = n
+	}
+}
+
+// WithIdleTimeout closes pooled connections that have been idle for
+// longer than d. Zero (the default) keeps idle connections open.
+func WithIdleTimeout(d time.Duration) PoolOption {
+	return func(cfg *poolConfig) {
+		cfg.idleTimeout = d
+	}
+}
+
+// WithInitSQL sets statements run on a connection each time it is
+// acquired from the pool, e.g. SET search_path or session settings.
+// If a statement fails the connection is closed and Acquire returns
+// the error.
+func WithInitSQL(stmts ...string) PoolOption {
+	return func(cfg *poolConfig) {
+		cfg.initSQL = stmts
+	}
+}
+
+// WithPoolCatalog opens the pool's connections with [DB.ConnectAs]
+// using the given catalog and schema.
+func WithPoolCatalog(catalog, schema string) PoolOption {
+	return func(cfg *poolConfig) {
+		cfg.catalog = catalog
+		cfg.dbSchema = schema
+	}
+}
+
+// PoolStats reports the state and counters of a [Pool].
+type PoolStats struct {
+	// MaxOpen is the configured limit on open connections (0 = none).
+	MaxOpen int
+	// Open is the number of connections open or being opened.
+	Open int
+	// InUse is the number of acquired connections.
+	InUse int
+	// Idle is the number of connections kept for reuse.
+	Idle int
+	// Acquired is the total number of successful Acquire calls.
+	Acquired int64
+	// Created is the total number of connections opened by the pool.
+	Created int64
+	// WaitCount is the number of Acquire calls that had to wait for a
+	// connection, and WaitDuration the total time spent waiting.
+	WaitCount    int64
+	WaitDuration time.Duration
+	// MaxIdleClosed counts connections closed on release because the
+	// pool already held WithMaxIdle idle connections.
+	MaxIdleClosed int64
+	// IdleTimeoutClosed counts connections closed by WithIdleTimeout.
+	IdleTimeoutClosed int64
+}
+
 // CatalogInfo represents a single catalog in the DuckDB database hierarchy.
 // When multiple databases are ATTACHed, each appears as a separate CatalogInfo.
 type CatalogInfo struct {